@@ -0,0 +1,230 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"sync"
+
+	"golang.org/x/time/rate"
+
+	"github.com/Tnze/go-mc/chat"
+	"github.com/Tnze/go-mc/chat/sign"
+	"github.com/Tnze/go-mc/data/packetid"
+	pk "github.com/Tnze/go-mc/net/packet"
+	"github.com/go-mc/server/world"
+)
+
+const (
+	// LastSeenCount is the max number of the messages acknowledged by a chat message.
+	LastSeenCount = 20
+	// maxPendingChats is the max number of the messages sent to the client but not acknowledged, same as vanilla.
+	maxPendingChats = 4096
+	// signatureCacheSize is the size of the signature cache of the client.
+	signatureCacheSize = 128
+)
+
+// chatTracker tracks the signed messages sent to the client.
+// The signatures are cached by both sides, so they are sent as indexes when the client has seen them,
+// and the client acknowledges the messages it has seen when sending chat messages.
+type chatTracker struct {
+	sync.Mutex
+	cache [signatureCacheSize]*sign.Signature
+	// tracked is the window of the last seen messages, followed by the pending ones.
+	tracked     []trackedChat
+	lastPending *sign.Signature
+}
+
+type trackedChat struct {
+	signature *sign.Signature // nil if the slot is empty
+	pending   bool
+}
+
+// ChatMode returns the chat visibility chosen in the settings of the client, one of the world.ChatMode* values.
+func (c *Client) ChatMode() int32 {
+	c.Inputs.Lock()
+	defer c.Inputs.Unlock()
+	return c.Inputs.ChatMode
+}
+
+// CanChat reports whether the chat mode of the client allows sending a chat message, or a command if command is set.
+// If not, the player is told to change the settings.
+func (c *Client) CanChat(command bool) bool {
+	switch c.ChatMode() {
+	case world.ChatModeHidden:
+	case world.ChatModeCommandsOnly:
+		if command {
+			return true
+		}
+	default:
+		return true
+	}
+	// sent without checking the chat mode, otherwise the hidden chat drops it
+	c.sendSystemChat(chat.TranslateMsg("chat.disabled.options").SetColor(chat.Red), false)
+	return false
+}
+
+// SetChatLimiter limits the rate of the chat messages and commands sent by the client, see ChatSpam.
+// It should be set before the client starts.
+func (c *Client) SetChatLimiter(limiter *rate.Limiter) { c.chatLimiter = limiter }
+
+// ChatSpam counts a chat message or command sent by the client, and reports whether the rate limit is exceeded.
+func (c *Client) ChatSpam() bool {
+	return c.chatLimiter != nil && !c.chatLimiter.Allow()
+}
+
+// SendPlayerChat sends the message, packing the signatures with the cache of the client.
+// The client is disconnected if it doesn't acknowledge the messages for too long.
+// Nothing is sent if the client only shows commands or hides the chat.
+func (c *Client) SendPlayerChat(msg *sign.Message, chatType *chat.Type) {
+	if c.ChatMode() != world.ChatModeEnabled {
+		return
+	}
+	c.chat.Lock()
+	defer c.chat.Unlock()
+	lastSeen := make([]sign.PackedSignature, len(msg.LastSeen))
+	for i, v := range msg.LastSeen {
+		lastSeen[i] = c.chat.pack(v)
+	}
+	c.SendPacket(
+		packetid.ClientboundPlayerChat,
+		pk.UUID(msg.Prev.Sender),
+		pk.VarInt(msg.Prev.Index),
+		pk.OptionEncoder[*sign.Signature]{
+			Has: msg.Signature != nil,
+			Val: msg.Signature,
+		},
+		&sign.PackedMessageBody{
+			PlainMsg:  msg.PlainMsg,
+			Timestamp: msg.Timestamp,
+			Salt:      msg.Salt,
+			LastSeen:  lastSeen,
+		},
+		pk.OptionEncoder[*chat.Message]{
+			Has: msg.Unsigned != nil,
+			Val: msg.Unsigned,
+		},
+		&msg.FilterMask,
+		chatType,
+	)
+	if msg.Signature != nil {
+		c.chat.push(msg)
+		if !c.chat.addPending(msg.Signature) {
+			c.SendDisconnect(chat.TranslateMsg("multiplayer.disconnect.too_many_pending_chats"))
+		}
+	}
+}
+
+// SendDisguisedChat sends the message which isn't signed, decorated by the chat type like a player chat message.
+// Nothing is sent if the client only shows commands or hides the chat.
+func (c *Client) SendDisguisedChat(msg chat.Message, chatType *chat.Type) {
+	if c.ChatMode() != world.ChatModeEnabled {
+		return
+	}
+	c.SendPacket(packetid.ClientboundDisguisedChat, msg, chatType)
+}
+
+// AcknowledgeChats applies the last seen messages sent with a chat message,
+// and returns the signatures of them. The ok is false if the update is invalid.
+func (c *Client) AcknowledgeChats(update sign.HistoryUpdate) (lastSeen []*sign.Signature, ok bool) {
+	c.chat.Lock()
+	defer c.chat.Unlock()
+	if !c.chat.applyOffset(int(update.Offset)) {
+		return nil, false
+	}
+	// the bit set is read in whole bytes, only the bits out of the window are invalid
+	for i := LastSeenCount; i < update.Acknowledged.Len(); i++ {
+		if update.Acknowledged.Get(i) {
+			return nil, false
+		}
+	}
+	lastSeen = make([]*sign.Signature, 0, LastSeenCount)
+	for i := 0; i < LastSeenCount; i++ {
+		entry := &c.chat.tracked[i]
+		if update.Acknowledged.Get(i) {
+			if entry.signature == nil {
+				return nil, false
+			}
+			entry.pending = false
+			lastSeen = append(lastSeen, entry.signature)
+		} else {
+			if entry.signature != nil && !entry.pending {
+				return nil, false
+			}
+			*entry = trackedChat{}
+		}
+	}
+	return lastSeen, true
+}
+
+func clientChatAck(p pk.Packet, c *Client) error {
+	var offset pk.VarInt
+	if err := p.Scan(&offset); err != nil {
+		return err
+	}
+	c.chat.Lock()
+	ok := c.chat.applyOffset(int(offset))
+	c.chat.Unlock()
+	if !ok {
+		c.SendDisconnect(chat.TranslateMsg("multiplayer.disconnect.chat_validation_failed"))
+	}
+	return nil
+}
+
+// applyOffset drops the messages which are moved out of the window of the last seen messages by the client.
+func (t *chatTracker) applyOffset(offset int) bool {
+	if offset < 0 || offset > len(t.tracked)-LastSeenCount {
+		return false
+	}
+	t.tracked = append(t.tracked[:0], t.tracked[offset:]...)
+	return true
+}
+
+func (t *chatTracker) addPending(signature *sign.Signature) bool {
+	if t.lastPending == nil || *t.lastPending != *signature {
+		t.tracked = append(t.tracked, trackedChat{signature: signature, pending: true})
+		t.lastPending = signature
+	}
+	return len(t.tracked) <= maxPendingChats
+}
+
+// pack returns the index of the signature in the cache, or the signature itself if it isn't cached.
+func (t *chatTracker) pack(signature *sign.Signature) sign.PackedSignature {
+	for i, v := range t.cache {
+		if v != nil && *v == *signature {
+			return sign.PackedSignature{ID: int32(i)}
+		}
+	}
+	return sign.PackedSignature{ID: -1, Signature: signature}
+}
+
+// push moves the signatures of the message to the front of the cache, the same as the client does.
+func (t *chatTracker) push(msg *sign.Message) {
+	queue := make([]*sign.Signature, 0, len(msg.LastSeen)+1)
+	queue = append(queue, msg.LastSeen...)
+	queue = append(queue, msg.Signature)
+	pushed := make(map[sign.Signature]bool, len(queue))
+	for _, v := range queue {
+		pushed[*v] = true
+	}
+	for i := 0; len(queue) > 0 && i < len(t.cache); i++ {
+		old := t.cache[i]
+		t.cache[i], queue = queue[len(queue)-1], queue[:len(queue)-1]
+		if old != nil && !pushed[*old] {
+			queue = append([]*sign.Signature{old}, queue...)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/Tnze/go-mc/chat/sign"
+	pk "github.com/Tnze/go-mc/net/packet"
+	"github.com/go-mc/server/world"
+)
+
+func signature(b byte) *sign.Signature { return &sign.Signature{b} }
+
+// acknowledged returns the bit set of the last seen messages with the bits set.
+func acknowledged(bits ...int) pk.FixedBitSet {
+	set := pk.NewFixedBitSet(LastSeenCount)
+	for _, i := range bits {
+		set.Set(i, true)
+	}
+	return set
+}
+
+func TestChatTracker_applyOffset(t *testing.T) {
+	for _, tt := range []struct {
+		offset int
+		ok     bool
+	}{
+		{-1, false},
+		{0, true},
+		{2, true},
+		{3, true},
+		{4, false},
+	} {
+		c := New(zap.NewNop(), nil, &world.Player{})
+		a, b, d := signature(1), signature(2), signature(3)
+		for _, v := range []*sign.Signature{a, b, b, d} {
+			c.chat.addPending(v)
+		}
+		if ok := c.chat.applyOffset(tt.offset); ok != tt.ok {
+			t.Errorf("applyOffset(%d) = %v, want %v", tt.offset, ok, tt.ok)
+			continue
+		}
+		if !tt.ok {
+			if len(c.chat.tracked) != LastSeenCount+3 {
+				t.Errorf("applyOffset(%d) changed the tracked messages to %d", tt.offset, len(c.chat.tracked))
+			}
+			continue
+		}
+		if len(c.chat.tracked) != LastSeenCount+3-tt.offset {
+			t.Errorf("applyOffset(%d): got %d tracked messages", tt.offset, len(c.chat.tracked))
+		}
+		// the repeated signature is tracked once, and the pending messages are kept in order
+		if tail := c.chat.tracked[len(c.chat.tracked)-3:]; tail[0].signature != a || tail[1].signature != b || tail[2].signature != d {
+			t.Errorf("applyOffset(%d): got %v", tt.offset, tail)
+		}
+	}
+}
+
+func TestClient_AcknowledgeChats(t *testing.T) {
+	a, b, d, e := signature(1), signature(2), signature(3), signature(4)
+	for _, tt := range []struct {
+		name    string
+		pending []*sign.Signature
+		offset  int32
+		bits    []int
+		want    []*sign.Signature
+		ok      bool
+	}{
+		{"nothing", nil, 0, nil, []*sign.Signature{}, true},
+		{"all", []*sign.Signature{a, b, d}, 3, []int{17, 18, 19}, []*sign.Signature{a, b, d}, true},
+		{"some", []*sign.Signature{a, b, d}, 3, []int{17, 19}, []*sign.Signature{a, d}, true},
+		{"not yet moved in", []*sign.Signature{a, b, d}, 1, []int{19}, []*sign.Signature{a}, true},
+		{"empty slot", []*sign.Signature{a}, 1, []int{18, 19}, nil, false},
+		{"offset too large", []*sign.Signature{a}, 2, []int{19}, nil, false},
+		{"negative offset", []*sign.Signature{a}, -1, nil, nil, false},
+		{"out of window", []*sign.Signature{a}, 1, []int{19, 20}, nil, false},
+		{"last bit of the set", []*sign.Signature{a, e}, 2, []int{18, 19, 23}, nil, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(zap.NewNop(), nil, &world.Player{})
+			for _, v := range tt.pending {
+				c.chat.addPending(v)
+			}
+			got, ok := c.AcknowledgeChats(sign.HistoryUpdate{Offset: pk.VarInt(tt.offset), Acknowledged: acknowledged(tt.bits...)})
+			if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v %v, want %v %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+// TestClient_AcknowledgeChatsSequence acknowledges the messages in several updates, like a client chatting.
+func TestClient_AcknowledgeChatsSequence(t *testing.T) {
+	a, b, d := signature(1), signature(2), signature(3)
+	c := New(zap.NewNop(), nil, &world.Player{})
+	for _, v := range []*sign.Signature{a, b} {
+		c.chat.addPending(v)
+	}
+	for i, tt := range []struct {
+		send   *sign.Signature
+		offset int32
+		bits   []int
+		want   []*sign.Signature
+		ok     bool
+	}{
+		// a is ignored, b is seen
+		{nil, 2, []int{19}, []*sign.Signature{b}, true},
+		// d is sent, the window moves by one
+		{d, 1, []int{18, 19}, []*sign.Signature{b, d}, true},
+		// the same window again
+		{nil, 0, []int{18, 19}, []*sign.Signature{b, d}, true},
+		// the seen messages can't be unacknowledged
+		{nil, 0, []int{19}, nil, false},
+	} {
+		if tt.send != nil {
+			c.chat.addPending(tt.send)
+		}
+		got, ok := c.AcknowledgeChats(sign.HistoryUpdate{Offset: pk.VarInt(tt.offset), Acknowledged: acknowledged(tt.bits...)})
+		if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("update %d: got %v %v, want %v %v", i, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -18,6 +18,7 @@ package client
 
 import (
 	"go.uber.org/zap"
+	"golang.org/x/time/rate"
 
 	"github.com/Tnze/go-mc/data/packetid"
 	"github.com/Tnze/go-mc/net"
@@ -33,6 +34,9 @@ type Client struct {
 	player   *world.Player
 	queue    server.PacketQueue
 	handlers []PacketHandler
+	chat     chatTracker
+	// chatLimiter detects the chat spam, nil if not limited.
+	chatLimiter *rate.Limiter
 	// pointer to the Player.Input
 	*world.Inputs
 }
@@ -40,7 +44,7 @@ type Client struct {
 type PacketHandler func(p pk.Packet, c *Client) error
 
 func New(log *zap.Logger, conn *net.Conn, player *world.Player) *Client {
-	return &Client{
+	c := &Client{
 		log:      log,
 		conn:     conn,
 		player:   player,
@@ -48,6 +52,8 @@ func New(log *zap.Logger, conn *net.Conn, player *world.Player) *Client {
 		handlers: defaultHandlers[:],
 		Inputs:   &player.Inputs,
 	}
+	c.chat.tracked = make([]trackedChat, LastSeenCount)
+	return c
 }
 
 func (c *Client) Start() {
@@ -109,10 +115,19 @@ func (c *Client) GetPlayer() *world.Player { return c.player }
 
 var defaultHandlers = [packetid.ServerboundPacketIDGuard]PacketHandler{
 	packetid.ServerboundAcceptTeleportation:  clientAcceptTeleportation,
+	packetid.ServerboundChatAck:              clientChatAck,
 	packetid.ServerboundClientInformation:    clientInformation,
+	packetid.ServerboundContainerClick:       clientContainerClick,
+	packetid.ServerboundContainerClose:       clientContainerClose,
 	packetid.ServerboundMovePlayerPos:        clientMovePlayerPos,
 	packetid.ServerboundMovePlayerPosRot:     clientMovePlayerPosRot,
 	packetid.ServerboundMovePlayerRot:        clientMovePlayerRot,
 	packetid.ServerboundMovePlayerStatusOnly: clientMovePlayerStatusOnly,
 	packetid.ServerboundMoveVehicle:          clientMoveVehicle,
+	packetid.ServerboundPlayerCommand:        clientPlayerCommand,
+	packetid.ServerboundSetCarriedItem:       clientSetCarriedItem,
+	packetid.ServerboundSetCreativeModeSlot:  clientSetCreativeModeSlot,
 }
+
+// RemoteAddr returns the network address of the client, in the form of "host:port".
+func (c *Client) RemoteAddr() string { return c.conn.Socket.RemoteAddr().String() }
@@ -0,0 +1,186 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Tnze/go-mc/data/item"
+	"github.com/Tnze/go-mc/data/packetid"
+	pk "github.com/Tnze/go-mc/net/packet"
+	"github.com/go-mc/server/world"
+)
+
+// the window ID of the player inventory
+const inventoryWindow = 0
+
+// maxChangedSlots is the max number of the changed slots in a ContainerClick packet, same as vanilla.
+const maxChangedSlots = 128
+
+// SendInventory sends all the items in the inventory of the player.
+func (c *Client) SendInventory() {
+	c.player.Inventory.Lock()
+	defer c.player.Inventory.Unlock()
+	c.sendInventory()
+}
+
+// sendInventory is SendInventory with the inventory locked.
+func (c *Client) sendInventory() {
+	inv := &c.player.Inventory
+	c.SendPacket(
+		packetid.ClientboundContainerSetContent,
+		pk.UnsignedByte(inventoryWindow),
+		pk.VarInt(inv.NextStateID()),
+		pk.Array(inv.Slots[:]),
+		inv.Carried,
+	)
+}
+
+// SendSetCarriedItem selects the hotbar slot held in the main hand.
+func (c *Client) SendSetCarriedItem(slot int16) {
+	c.SendPacket(packetid.ClientboundSetCarriedItem, pk.Byte(slot))
+}
+
+func clientSetCarriedItem(p pk.Packet, c *Client) error {
+	var slot pk.Short
+	if err := p.Scan(&slot); err != nil {
+		return err
+	}
+	if slot < 0 || slot >= 9 {
+		return errors.New("invalid carried item slot")
+	}
+	c.Inputs.Lock()
+	c.Inputs.HeldSlot = int16(slot)
+	c.Inputs.Unlock()
+	return nil
+}
+
+func clientSetCreativeModeSlot(p pk.Packet, c *Client) error {
+	var (
+		slot  pk.Short
+		stack world.ItemStack
+	)
+	if err := p.Scan(&slot, &stack); err != nil {
+		return err
+	}
+	if c.player.Gamemode() != 1 {
+		return nil // only creative players are allowed to take items from nowhere
+	}
+	// same as vanilla, the count is limited to 64 but not to the stack size of the item.
+	if stack.IsEmpty() {
+		stack = world.ItemStack{}
+	} else if _, ok := item.ByID[stack.ID]; !ok || stack.Count > 64 {
+		return nil
+	}
+	// slot -1 is dropping the item, which isn't yet supported
+	if slot >= world.SlotCraftingStart && slot < world.InventorySize {
+		c.player.Inventory.Lock()
+		c.player.Inventory.Slots[slot] = stack
+		c.player.Inventory.Unlock()
+	}
+	return nil
+}
+
+// changedSlot is the item in a slot predicted by the client after a click.
+type changedSlot struct {
+	slot  int16
+	stack world.ItemStack
+}
+
+func (s *changedSlot) ReadFrom(r io.Reader) (int64, error) {
+	return pk.Tuple{(*pk.Short)(&s.slot), &s.stack}.ReadFrom(r)
+}
+
+// changedSlots is the array of changedSlot, the length is checked before allocating.
+type changedSlots []changedSlot
+
+func (s *changedSlots) ReadFrom(r io.Reader) (int64, error) {
+	var count pk.VarInt
+	n, err := count.ReadFrom(r)
+	if err != nil {
+		return n, err
+	}
+	if count < 0 || count > maxChangedSlots {
+		return n, fmt.Errorf("invalid number of changed slots: %d", count)
+	}
+	*s = make(changedSlots, count)
+	for i := range *s {
+		n1, err := (*s)[i].ReadFrom(r)
+		n += n1
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// clientContainerClick applies the click to the inventory, and sends the whole inventory back
+// if the result isn't the same as the prediction of the client.
+func clientContainerClick(p pk.Packet, c *Client) error {
+	var (
+		windowID pk.UnsignedByte
+		stateID  pk.VarInt
+		slot     pk.Short
+		button   pk.Byte
+		mode     pk.VarInt
+		changed  changedSlots
+		carried  world.ItemStack
+	)
+	if err := p.Scan(&windowID, &stateID, &slot, &button, &mode, &changed, &carried); err != nil {
+		return err
+	}
+	if windowID != inventoryWindow {
+		return nil // other containers are not yet supported
+	}
+	inv := &c.player.Inventory
+	inv.Lock()
+	defer inv.Unlock()
+	expected := inv.Slots
+	for _, v := range changed {
+		if v.slot < 0 || v.slot >= world.InventorySize {
+			return errors.New("invalid container click slot")
+		}
+		expected[v.slot] = v.stack
+	}
+	ok := inv.Click(int16(slot), int8(button), int32(mode), c.player.Gamemode() == 1)
+	synced := ok && int32(stateID) == inv.StateID && inv.Carried.Equal(carried)
+	for i := range expected {
+		synced = synced && inv.Slots[i].Equal(expected[i])
+	}
+	if !synced {
+		c.sendInventory()
+	}
+	return nil
+}
+
+func clientContainerClose(p pk.Packet, c *Client) error {
+	var windowID pk.UnsignedByte
+	if err := p.Scan(&windowID); err != nil {
+		return err
+	}
+	if windowID != inventoryWindow {
+		return nil
+	}
+	inv := &c.player.Inventory
+	inv.Lock()
+	defer inv.Unlock()
+	inv.ReturnCrafting()
+	c.sendInventory()
+	return nil
+}
@@ -0,0 +1,68 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/Tnze/go-mc/data/item"
+	"github.com/Tnze/go-mc/data/packetid"
+	pk "github.com/Tnze/go-mc/net/packet"
+	"github.com/go-mc/server/world"
+)
+
+// containerClick returns a ContainerClick packet picking up the first item of the main inventory,
+// with the count of the changed slots and the changed slots following it.
+func containerClick(count int32, changed ...pk.FieldEncoder) pk.Packet {
+	fields := []pk.FieldEncoder{
+		pk.UnsignedByte(inventoryWindow), pk.VarInt(0),
+		pk.Short(world.SlotMainStart), pk.Byte(0), pk.VarInt(world.ClickPickup),
+		pk.VarInt(count),
+	}
+	fields = append(fields, changed...)
+	fields = append(fields, world.ItemStack{ID: item.Stone.ID, Count: 1})
+	return pk.Marshal(packetid.ServerboundContainerClick, fields...)
+}
+
+func TestClientContainerClick(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		packet  pk.Packet
+		wantErr bool
+	}{
+		{"valid", containerClick(1, pk.Short(world.SlotMainStart), world.ItemStack{}), false},
+		{"negative count", containerClick(-1), true},
+		{"oversized count", containerClick(maxChangedSlots + 1), true},
+		{"huge count", containerClick(1 << 30), true},
+		{"missing slots", containerClick(2, pk.Short(world.SlotMainStart), world.ItemStack{}), true},
+		{"invalid slot", containerClick(1, pk.Short(world.InventorySize), world.ItemStack{}), true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(zap.NewNop(), nil, &world.Player{})
+			c.player.Inventory.Slots[world.SlotMainStart] = world.ItemStack{ID: item.Stone.ID, Count: 1}
+			err := clientContainerClick(tt.packet, c)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !c.player.Inventory.Carried.Equal(world.ItemStack{ID: item.Stone.ID, Count: 1}) {
+				t.Errorf("the click isn't applied, carried %v", c.player.Inventory.Carried)
+			}
+		})
+	}
+}
@@ -86,3 +86,32 @@ func clientMovePlayerStatusOnly(p pk.Packet, c *Client) error {
 func clientMoveVehicle(_ pk.Packet, _ *Client) error {
 	return nil
 }
+
+// Actions of the player commands
+const (
+	playerCommandPressShift = iota
+	playerCommandReleaseShift
+	playerCommandStopSleeping
+	playerCommandStartSprinting
+	playerCommandStopSprinting
+)
+
+func clientPlayerCommand(p pk.Packet, c *Client) error {
+	var EntityID, Action, JumpBoost pk.VarInt
+	if err := p.Scan(&EntityID, &Action, &JumpBoost); err != nil {
+		return err
+	}
+	c.Inputs.Lock()
+	switch Action {
+	case playerCommandPressShift:
+		c.Inputs.Sneaking = true
+	case playerCommandReleaseShift:
+		c.Inputs.Sneaking = false
+	case playerCommandStartSprinting:
+		c.Inputs.Sprinting = true
+	case playerCommandStopSprinting:
+		c.Inputs.Sprinting = false
+	}
+	c.Inputs.Unlock()
+	return nil
+}
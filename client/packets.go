@@ -18,19 +18,18 @@ package client
 
 import (
 	"bytes"
-	"encoding/binary"
 	"sync/atomic"
 	"unsafe"
 
-	"github.com/google/uuid"
 	"go.uber.org/zap"
 
 	"github.com/Tnze/go-mc/chat"
-	"github.com/Tnze/go-mc/chat/sign"
 	"github.com/Tnze/go-mc/data/packetid"
 	"github.com/Tnze/go-mc/level"
+	"github.com/Tnze/go-mc/level/block"
 	pk "github.com/Tnze/go-mc/net/packet"
 	"github.com/go-mc/server/world"
+	"github.com/go-mc/server/world/entity"
 )
 
 func (c *Client) SendPacket(id packetid.ClientboundPacketID, fields ...pk.FieldEncoder) {
@@ -61,21 +60,24 @@ func (c *Client) SendDisconnect(reason chat.Message) {
 	c.SendPacket(packetid.ClientboundDisconnect, reason)
 }
 
-func (c *Client) SendLogin(w *world.World, p *world.Player) {
-	hashedSeed := w.HashedSeed()
+// SendLogin send ClientboundLogin packet to client.
+// The dimensions are names of all worlds in the server, and w is the one the player spawns in.
+func (c *Client) SendLogin(dimensions []string, w *world.World, p *world.Player) {
+	dimensionNames := make([]pk.Identifier, len(dimensions))
+	for i, name := range dimensions {
+		dimensionNames[i] = pk.Identifier(name)
+	}
 	c.SendPacket(
 		packetid.ClientboundLogin,
 		pk.Int(p.EntityID),
 		pk.Boolean(false), // Is Hardcore
-		pk.Byte(p.Gamemode),
+		pk.Byte(p.Gamemode()),
 		pk.Byte(-1),
-		pk.Array([]pk.Identifier{
-			pk.Identifier(w.Name()),
-		}),
+		pk.Array(dimensionNames),
 		pk.NBT(world.NetworkCodec),
-		pk.Identifier("minecraft:overworld"),
+		pk.Identifier(w.DimensionType()),
 		pk.Identifier(w.Name()),
-		pk.Long(binary.BigEndian.Uint64(hashedSeed[:8])),
+		pk.Long(w.HashedSeed()),
 		pk.VarInt(0),              // Max players (ignored by client)
 		pk.VarInt(p.ViewDistance), // View Distance
 		pk.VarInt(p.ViewDistance), // Simulation Distance
@@ -87,6 +89,28 @@ func (c *Client) SendLogin(w *world.World, p *world.Player) {
 	)
 }
 
+// Flags of the data kept by the client when respawning, used by [SendRespawn]
+const (
+	RespawnKeepAttributes = 1 << iota
+	RespawnKeepMetadata
+)
+
+// SendRespawn send ClientboundRespawn packet to client, which makes the client switch to the world w.
+func (c *Client) SendRespawn(w *world.World, p *world.Player, dataKept byte) {
+	c.SendPacket(
+		packetid.ClientboundRespawn,
+		pk.Identifier(w.DimensionType()),
+		pk.Identifier(w.Name()),
+		pk.Long(w.HashedSeed()),
+		pk.UnsignedByte(p.Gamemode()),
+		pk.Byte(-1),       // Previous Gamemode
+		pk.Boolean(false), // Is Debug
+		pk.Boolean(false), // Is Flat
+		pk.Byte(dataKept),
+		pk.Boolean(false), // Has Death Location
+	)
+}
+
 func (c *Client) SendServerData(motd *chat.Message, favIcon string, enforceSecureProfile bool) {
 	c.SendPacket(
 		packetid.ClientboundServerData,
@@ -130,10 +154,14 @@ func (c *Client) SendPlayerInfoUpdate(actions pk.FixedBitSet, players []*world.P
 			_, _ = pk.Array(player.Properties).WriteTo(&buf)
 		}
 		if actions.Get(PlayerInfoInitializeChat) {
-			panic("not yet support InitializeChat")
+			session := player.ChatSession()
+			_, _ = pk.Boolean(session != nil).WriteTo(&buf)
+			if session != nil {
+				_, _ = session.WriteTo(&buf)
+			}
 		}
 		if actions.Get(PlayerInfoUpdateGameMode) {
-			_, _ = pk.VarInt(player.Gamemode).WriteTo(&buf)
+			_, _ = pk.VarInt(player.Gamemode()).WriteTo(&buf)
 		}
 		if actions.Get(PlayerInfoUpdateListed) {
 			_, _ = pk.Boolean(true).WriteTo(&buf)
@@ -177,6 +205,34 @@ func (c *Client) SendForgetLevelChunk(pos level.ChunkPos) {
 	c.SendPacket(packetid.ClientboundForgetLevelChunk, pos)
 }
 
+func (c *Client) SendBlockUpdate(pos [3]int32, state block.StateID) {
+	c.SendPacket(
+		packetid.ClientboundBlockUpdate,
+		pk.Position{X: int(pos[0]), Y: int(pos[1]), Z: int(pos[2])},
+		pk.VarInt(state),
+	)
+}
+
+// SendBlockChangedAck acknowledges the block changes predicted by the client up to the sequence.
+func (c *Client) SendBlockChangedAck(sequence int32) {
+	c.SendPacket(packetid.ClientboundBlockChangedAck, pk.VarInt(sequence))
+}
+
+// SendSectionBlocksUpdate send the changes of blocks in the same chunk section.
+func (c *Client) SendSectionBlocksUpdate(sectionPos [3]int32, changes []world.BlockChange) {
+	blocks := make([]pk.VarLong, len(changes))
+	for i, change := range changes {
+		local := int64(change.Pos[0]&15)<<8 | int64(change.Pos[2]&15)<<4 | int64(change.Pos[1]&15)
+		blocks[i] = pk.VarLong(int64(change.State)<<12 | local)
+	}
+	c.SendPacket(
+		packetid.ClientboundSectionBlocksUpdate,
+		pk.Long(int64(sectionPos[0]&0x3FFFFF)<<42|int64(sectionPos[2]&0x3FFFFF)<<20|int64(sectionPos[1]&0xFFFFF)),
+		pk.Boolean(false), // Suppress Light Updates
+		pk.Array(blocks),
+	)
+}
+
 func (c *Client) SendAddPlayer(p *world.Player) {
 	c.SendPacket(
 		packetid.ClientboundAddPlayer,
@@ -190,6 +246,53 @@ func (c *Client) SendAddPlayer(p *world.Player) {
 	)
 }
 
+func (c *Client) SendAddEntity(e *world.GenericEntity) {
+	c.SendPacket(
+		packetid.ClientboundAddEntity,
+		pk.VarInt(e.EntityID),
+		pk.UUID(e.UUID),
+		pk.VarInt(e.Type),
+		pk.Double(e.Position[0]),
+		pk.Double(e.Position[1]),
+		pk.Double(e.Position[2]),
+		toAngle(e.Rotation[1]),
+		toAngle(e.Rotation[0]),
+		toAngle(e.Rotation[0]), // head yaw
+		pk.VarInt(e.Data),
+		entityVelocity(e.Velocity[0]),
+		entityVelocity(e.Velocity[1]),
+		entityVelocity(e.Velocity[2]),
+	)
+}
+
+// toAngle converts the degrees to the steps of 1/256 of a full turn.
+func toAngle(deg float32) pk.Angle {
+	return pk.Angle(int32(deg * 256 / 360))
+}
+
+// entityVelocity converts the velocity in blocks per tick to the unit of the packets, clamped like vanilla.
+func entityVelocity(v float64) pk.Short {
+	const limit = 3.9
+	if v > limit {
+		v = limit
+	} else if v < -limit {
+		v = -limit
+	}
+	return pk.Short(v * 8000)
+}
+
+func (c *Client) SendSetEntityData(eid int32, data entity.MetadataSet) {
+	c.SendPacket(packetid.ClientboundSetEntityData, pk.VarInt(eid), data)
+}
+
+func (c *Client) SendAnimate(eid int32, animation byte) {
+	c.SendPacket(packetid.ClientboundAnimate, pk.VarInt(eid), pk.UnsignedByte(animation))
+}
+
+func (c *Client) SendHurtAnimation(eid int32, yaw float32) {
+	c.SendPacket(packetid.ClientboundHurtAnimation, pk.VarInt(eid), pk.Float(yaw))
+}
+
 func (c *Client) SendMoveEntitiesPos(eid int32, delta [3]int16, onGround bool) {
 	c.SendPacket(
 		packetid.ClientboundMoveEntityPos,
@@ -278,31 +381,52 @@ func (c *Client) SendRemoveEntities(entityIDs []int32) {
 	)
 }
 
+// SendSystemChat sends the message unless the client hides the chat, while the overlay messages are always sent.
 func (c *Client) SendSystemChat(msg chat.Message, overlay bool) {
+	if !overlay && c.ChatMode() == world.ChatModeHidden {
+		return
+	}
+	c.sendSystemChat(msg, overlay)
+}
+
+func (c *Client) sendSystemChat(msg chat.Message, overlay bool) {
 	c.SendPacket(packetid.ClientboundSystemChat, msg, pk.Boolean(overlay))
 }
 
-func (c *Client) SendPlayerChat(
-	sender uuid.UUID,
-	index int32,
-	signature pk.Option[sign.Signature, *sign.Signature],
-	body *sign.PackedMessageBody,
-	unsignedContent *chat.Message,
-	filter *sign.FilterMask,
-	chatType *chat.Type,
-) {
+// Statuses of [SendEntityEvent]
+const (
+	// EntityEventOpLevel0 to EntityEventOpLevel0+4 set the permission level of the player.
+	EntityEventOpLevel0 = 24
+)
+
+// SendEntityEvent send ClientboundEntityEvent packet, which triggers an event of the entity.
+func (c *Client) SendEntityEvent(eid int32, status byte) {
+	c.SendPacket(packetid.ClientboundEntityEvent, pk.Int(eid), pk.Byte(status))
+}
+
+// Events of [SendGameEvent]
+const (
+	GameEventChangeGameMode = 3
+)
+
+// SendGameEvent send ClientboundGameEvent packet, the meaning of the value depends on the event.
+func (c *Client) SendGameEvent(event byte, value float32) {
+	c.SendPacket(packetid.ClientboundGameEvent, pk.UnsignedByte(event), pk.Float(value))
+}
+
+// SendCommandSuggestions replies the ServerboundCommandSuggestion with the same id.
+// The matches replace the text from start, which has the length.
+func (c *Client) SendCommandSuggestions(id, start, length int32, matches []string) {
+	suggestions := make([]pk.Tuple, len(matches))
+	for i, v := range matches {
+		suggestions[i] = pk.Tuple{pk.String(v), pk.Boolean(false)}
+	}
 	c.SendPacket(
-		packetid.ClientboundPlayerChat,
-		pk.UUID(sender),
-		pk.VarInt(index),
-		signature,
-		body,
-		pk.OptionEncoder[*chat.Message]{
-			Has: unsignedContent != nil,
-			Val: unsignedContent,
-		},
-		filter,
-		chatType,
+		packetid.ClientboundCommandSuggestions,
+		pk.VarInt(id),
+		pk.VarInt(start),
+		pk.VarInt(length),
+		pk.Array(suggestions),
 	)
 }
 
@@ -319,7 +443,21 @@ func (c *Client) ViewChunkLoad(pos level.ChunkPos, chunk *level.Chunk) {
 }
 func (c *Client) ViewChunkUnload(pos level.ChunkPos)   { c.SendForgetLevelChunk(pos) }
 func (c *Client) ViewAddPlayer(p *world.Player)        { c.SendAddPlayer(p) }
-func (c *Client) ViewRemoveEntities(entityIDs []int32) { c.SendRemoveEntities(entityIDs) }
+func (c *Client) ViewAddEntity(e *world.GenericEntity) { c.SendAddEntity(e) }
+func (c *Client) ViewSetEntityData(id int32, data entity.MetadataSet) {
+	c.SendSetEntityData(id, data)
+}
+func (c *Client) ViewAnimate(id int32, animation byte)    { c.SendAnimate(id, animation) }
+func (c *Client) ViewHurtAnimation(id int32, yaw float32) { c.SendHurtAnimation(id, yaw) }
+func (c *Client) ViewRemoveEntities(entityIDs []int32)    { c.SendRemoveEntities(entityIDs) }
+func (c *Client) ViewBlockUpdate(pos [3]int32, state block.StateID) {
+	c.SendBlockUpdate(pos, state)
+}
+
+func (c *Client) ViewSectionBlocksUpdate(sectionPos [3]int32, changes []world.BlockChange) {
+	c.SendSectionBlocksUpdate(sectionPos, changes)
+}
+
 func (c *Client) ViewMoveEntityPos(id int32, delta [3]int16, onGround bool) {
 	c.SendMoveEntitiesPos(id, delta, onGround)
 }
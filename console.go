@@ -0,0 +1,169 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+	"golang.org/x/term"
+
+	"github.com/Tnze/go-mc/chat"
+	"github.com/go-mc/server/game"
+)
+
+// console reads the commands from stdin and runs them as the server.
+// If stdin and stdout are a terminal, the line editing, history and tab completion are supported,
+// and the log is written above the prompt.
+type console struct {
+	// term is nil if the console isn't a terminal
+	term    *term.Terminal
+	restore func()
+	scanner *bufio.Scanner
+}
+
+func newConsole() (*console, error) {
+	in, out := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	if !term.IsTerminal(in) || !term.IsTerminal(out) {
+		return &console{scanner: bufio.NewScanner(os.Stdin)}, nil
+	}
+	state, err := term.MakeRaw(in)
+	if err != nil {
+		return nil, err
+	}
+	rw := struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}
+	return &console{
+		term:    term.NewTerminal(rw, "> "),
+		restore: func() { _ = term.Restore(in, state) },
+	}, nil
+}
+
+// Write prints p above the prompt, so the console works as a zap.Sink.
+func (c *console) Write(p []byte) (int, error) {
+	if c.term != nil {
+		return c.term.Write(p)
+	}
+	return os.Stdout.Write(p)
+}
+
+func (c *console) Sync() error { return nil }
+
+// Close restores the state of the terminal.
+func (c *console) Close() error {
+	if c.restore != nil {
+		c.restore()
+	}
+	return nil
+}
+
+func (c *console) readLine() (string, error) {
+	if c.term != nil {
+		return c.term.ReadLine()
+	}
+	if !c.scanner.Scan() {
+		if err := c.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return c.scanner.Text(), nil
+}
+
+// Run executes the commands until stdin is closed.
+// Ctrl-C and Ctrl-D are read by the terminal instead of sending a signal, so they stop the server.
+func (c *console) Run(logger *zap.Logger, g *game.Game) {
+	src := consoleSource{c}
+	if c.term != nil {
+		c.term.AutoCompleteCallback = c.completer(g.Commands(), src)
+	}
+	for {
+		line, err := c.readLine()
+		if errors.Is(err, io.EOF) {
+			if c.term != nil {
+				g.Stop()
+			}
+			return
+		} else if err != nil {
+			logger.Error("Read console error", zap.Error(err))
+			return
+		}
+		command := strings.TrimPrefix(strings.TrimSpace(line), "/")
+		if command == "" {
+			continue
+		}
+		logger.Info("Console issued command", zap.String("command", command))
+		g.Commands().Execute(src, command)
+	}
+}
+
+// completer completes the word before the cursor when the tab key is pressed.
+// The candidates are printed if there are more than one.
+func (c *console) completer(d *game.CommandDispatcher, src game.CommandSource) func(line string, pos int, key rune) (string, int, bool) {
+	return func(line string, pos int, key rune) (string, int, bool) {
+		if key != '\t' {
+			return "", 0, false
+		}
+		input := strings.TrimPrefix(line[:pos], "/")
+		offset := pos - len(input)
+		start, matches := d.Suggest(src, input)
+		if len(matches) == 0 {
+			return "", 0, false
+		}
+		completion := commonPrefix(matches)
+		if len(matches) == 1 {
+			completion += " "
+		} else if len(completion) <= len(input)-start {
+			_, _ = c.Write([]byte(strings.Join(matches, "  ") + "\n"))
+		}
+		start += offset
+		return line[:start] + completion + line[pos:], start + len(completion), true
+	}
+}
+
+// commonPrefix returns the longest prefix shared by all the strings, ignoring the case.
+func commonPrefix(s []string) string {
+	prefix := s[0]
+	for _, v := range s[1:] {
+		i := 0
+		for i < len(prefix) && i < len(v) && strings.EqualFold(prefix[i:i+1], v[i:i+1]) {
+			i++
+		}
+		prefix = prefix[:i]
+	}
+	return prefix
+}
+
+// consoleSource is the CommandSource of the commands typed in the console, which has all permissions.
+type consoleSource struct{ *console }
+
+func (consoleSource) Name() string           { return "Server" }
+func (consoleSource) PermissionLevel() int32 { return game.PermissionOwner }
+
+func (s consoleSource) SendMessage(msg chat.Message) {
+	text := msg.ClearString()
+	if s.term != nil {
+		text = msg.String() // with ANSI colors
+	}
+	_, _ = s.Write([]byte(text + "\n"))
+}
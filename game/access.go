@@ -0,0 +1,617 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package game
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/Tnze/go-mc/chat"
+	"github.com/Tnze/go-mc/data/packetid"
+	mcnet "github.com/Tnze/go-mc/net"
+	pk "github.com/Tnze/go-mc/net/packet"
+	"github.com/Tnze/go-mc/offline"
+	"github.com/Tnze/go-mc/server"
+	"github.com/Tnze/go-mc/yggdrasil/user"
+)
+
+const (
+	whitelistFile     = "whitelist.json"
+	bannedPlayersFile = "banned-players.json"
+	bannedIPsFile     = "banned-ips.json"
+)
+
+// whitelistEntry is an element in the whitelist.json.
+type whitelistEntry struct {
+	UUID uuid.UUID `json:"uuid"`
+	Name string    `json:"name"`
+}
+
+// banTime is the time in the ban lists, the zero value is written as "forever".
+type banTime struct{ time.Time }
+
+const banTimeLayout = "2006-01-02 15:04:05 -0700"
+
+// MarshalJSON overrides the method of time.Time, so the layout of vanilla is used.
+func (t banTime) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return json.Marshal("forever")
+	}
+	return json.Marshal(t.Format(banTimeLayout))
+}
+
+func (t *banTime) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	if text == "forever" {
+		t.Time = time.Time{}
+		return nil
+	}
+	v, err := time.Parse(banTimeLayout, text)
+	if err != nil {
+		return err
+	}
+	t.Time = v
+	return nil
+}
+
+// banEntry is the common part of the elements in banned-players.json and banned-ips.json.
+type banEntry struct {
+	Created banTime `json:"created"`
+	Source  string  `json:"source"`
+	Expires banTime `json:"expires"`
+	Reason  string  `json:"reason"`
+}
+
+func (b *banEntry) expired(now time.Time) bool {
+	return !b.Expires.IsZero() && now.After(b.Expires.Time)
+}
+
+// message returns the reason shown to the banned player.
+func (b *banEntry) message(key string) chat.Message {
+	msg := chat.TranslateMsg(key, chat.Text(b.Reason))
+	if !b.Expires.IsZero() {
+		msg = msg.Append(chat.TranslateMsg("multiplayer.disconnect.banned.expiration", chat.Text(b.Expires.Format(banTimeLayout))))
+	}
+	return msg
+}
+
+// defaultBanReason is the reason of a ban if the operator doesn't give one, same as vanilla.
+const defaultBanReason = "Banned by an operator."
+
+func newBanEntry(source, reason string) banEntry {
+	if reason == "" {
+		reason = defaultBanReason
+	}
+	return banEntry{
+		Created: banTime{time.Now().Truncate(time.Second)},
+		Source:  source,
+		Reason:  reason,
+	}
+}
+
+// playerBan is an element in the banned-players.json.
+type playerBan struct {
+	UUID uuid.UUID `json:"uuid"`
+	Name string    `json:"name"`
+	banEntry
+}
+
+// ipBan is an element in the banned-ips.json.
+type ipBan struct {
+	IP string `json:"ip"`
+	banEntry
+}
+
+// accessLists are the whitelist and the ban lists, which decide who can join the server.
+type accessLists struct {
+	whitelist     jsonList[whitelistEntry]
+	bannedPlayers jsonList[playerBan]
+	bannedIPs     jsonList[ipBan]
+	// whitelistOn is changed by the /whitelist command at runtime.
+	whitelistOn atomic.Bool
+}
+
+func loadAccessLists(whitelistOn bool) (*accessLists, error) {
+	a := &accessLists{
+		whitelist:     jsonList[whitelistEntry]{path: whitelistFile},
+		bannedPlayers: jsonList[playerBan]{path: bannedPlayersFile},
+		bannedIPs:     jsonList[ipBan]{path: bannedIPsFile},
+	}
+	a.whitelistOn.Store(whitelistOn)
+	return a, a.reload()
+}
+
+// reload reads all the lists from their files again.
+func (a *accessLists) reload() error {
+	if err := a.whitelist.load(); err != nil {
+		return err
+	}
+	if err := a.bannedPlayers.load(); err != nil {
+		return err
+	}
+	return a.bannedIPs.load()
+}
+
+func (a *accessLists) whitelisted(id uuid.UUID) bool {
+	_, ok := a.whitelist.find(func(v *whitelistEntry) bool { return v.UUID == id })
+	return ok
+}
+
+// playerBan returns the ban of the player if it isn't expired.
+func (a *accessLists) playerBan(id uuid.UUID) (playerBan, bool) {
+	now := time.Now()
+	return a.bannedPlayers.find(func(v *playerBan) bool { return v.UUID == id && !v.expired(now) })
+}
+
+// ipBan returns the ban of the IP address if it isn't expired.
+func (a *accessLists) ipBan(ip string) (ipBan, bool) {
+	now := time.Now()
+	ip = normalizeIP(ip)
+	return a.bannedIPs.find(func(v *ipBan) bool { return normalizeIP(v.IP) == ip && !v.expired(now) })
+}
+
+// CheckPlayer implements server.LoginChecker, checking the ban list, the whitelist and the number of players.
+// Operators can join even if the whitelist is on, and the server is full if they bypass the player limit.
+func (g *Game) CheckPlayer(name string, id uuid.UUID, protocol int32) (ok bool, reason chat.Message) {
+	if ban, ok := g.access.playerBan(id); ok {
+		return false, ban.message("multiplayer.disconnect.banned.reason")
+	}
+	if !g.canBypassWhitelist(id) {
+		return false, chat.TranslateMsg("multiplayer.disconnect.not_whitelisted")
+	}
+	if g.ops.bypassesPlayerLimit(id) {
+		return true, chat.Message{}
+	}
+	return g.pingList.CheckPlayer(name, id, protocol)
+}
+
+// canBypassWhitelist reports whether the player can join the server with the current whitelist.
+func (g *Game) canBypassWhitelist(id uuid.UUID) bool {
+	return !g.access.whitelistOn.Load() || g.access.whitelisted(id) || g.ops.level(id) > PermissionAll
+}
+
+// LoginHandler wraps the handler, so connections from banned IP addresses are refused before logging in.
+func (g *Game) LoginHandler(h server.LoginHandler) server.LoginHandler {
+	return ipBanChecker{g: g, LoginHandler: h}
+}
+
+type ipBanChecker struct {
+	g *Game
+	server.LoginHandler
+}
+
+func (l ipBanChecker) AcceptLogin(conn *mcnet.Conn, protocol int32) (name string, id uuid.UUID, profilePubKey *user.PublicKey, properties []user.Property, err error) {
+	ip := remoteIP(conn.Socket.RemoteAddr().String())
+	if ban, ok := l.g.access.ipBan(ip); ok {
+		_ = conn.WritePacket(pk.Marshal(packetid.LoginDisconnect, ban.message("multiplayer.disconnect.banned_ip.reason")))
+		err = fmt.Errorf("ip %s is banned", ip)
+		return
+	}
+	return l.LoginHandler.AcceptLogin(conn, protocol)
+}
+
+// normalizeIP returns the canonical form of the IP address, so "::ffff:127.0.0.1" and "127.0.0.1" are the same.
+// Invalid addresses are returned as they are.
+func normalizeIP(ip string) string {
+	if v := net.ParseIP(ip); v != nil {
+		return v.String()
+	}
+	return ip
+}
+
+// remoteIP returns the host part of the address.
+func remoteIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// ReloadAccessLists reads the whitelist and the ban lists from their files again,
+// and kicks the players who are no longer allowed to play if the whitelist is enforced.
+func (g *Game) ReloadAccessLists() error {
+	if err := g.access.reload(); err != nil {
+		return err
+	}
+	g.enforceWhitelist()
+	return nil
+}
+
+// enforceWhitelist kicks the online players who aren't in the whitelist, if enforce-whitelist is set.
+func (g *Game) enforceWhitelist() {
+	if !g.config.EnforceWhitelist || !g.access.whitelistOn.Load() {
+		return
+	}
+	reason := chat.TranslateMsg("multiplayer.disconnect.not_whitelisted")
+	for _, c := range g.clients() {
+		if p := c.GetPlayer(); !g.canBypassWhitelist(p.UUID) {
+			g.log.Info("Kick player not in the whitelist", zap.String("name", p.Name))
+			c.SendDisconnect(reason)
+		}
+	}
+}
+
+// profileLookupTimeout limits the time of asking Mojang for the UUID of a player.
+const profileLookupTimeout = 5 * time.Second
+
+// LookupProfile finds the UUID of a player who may be offline.
+// In online mode the UUID is asked from the Mojang API, otherwise it's the offline-mode UUID of the name.
+func (g *Game) LookupProfile(name string) (server.GameProfile, error) {
+	if !g.config.OnlineMode {
+		return server.GameProfile{ID: offline.NameToUUID(name), Name: name}, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), profileLookupTimeout)
+	defer cancel()
+	profile, err := fetchProfile(ctx, name)
+	if err != nil {
+		g.log.Warn("Lookup player profile error", zap.String("name", name), zap.Error(err))
+		return server.GameProfile{}, commandError("argument.player.unknown")
+	}
+	return profile, nil
+}
+
+func fetchProfile(ctx context.Context, name string) (profile server.GameProfile, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		"https://api.mojang.com/users/profiles/minecraft/"+url.PathEscape(name), nil)
+	if err != nil {
+		return
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("unexpected status: %s", resp.Status)
+		return
+	}
+	var body struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return
+	}
+	if profile.ID, err = uuid.Parse(body.ID); err != nil {
+		return
+	}
+	profile.Name = body.Name
+	return
+}
+
+// registerAccessCommands registers the commands managing the whitelist and the ban lists.
+func (g *Game) registerAccessCommands() {
+	g.commands.Register(
+		Literal("whitelist").Requires(PermissionAdmin).Then(
+			Literal("on").Executes(g.whitelistOnCommand),
+			Literal("off").Executes(g.whitelistOffCommand),
+			Literal("list").Executes(g.whitelistListCommand),
+			Literal("add").Then(
+				Argument("targets", GameProfileArgument{}).Executes(g.whitelistAddCommand),
+			),
+			Literal("remove").Then(
+				Argument("targets", GameProfileArgument{}).Suggests(g.suggestWhitelisted).Executes(g.whitelistRemoveCommand),
+			),
+			Literal("reload").Executes(g.whitelistReloadCommand),
+		),
+		Literal("ban").Requires(PermissionAdmin).Then(
+			Argument("targets", GameProfileArgument{}).Executes(g.banCommand).Then(
+				Argument("reason", MessageArgument{}).Executes(g.banCommand),
+			),
+		),
+		Literal("ban-ip").Requires(PermissionAdmin).Then(
+			Argument("target", SingleWord).Executes(g.banIPCommand).Then(
+				Argument("reason", MessageArgument{}).Executes(g.banIPCommand),
+			),
+		),
+		Literal("pardon").Requires(PermissionAdmin).Then(
+			Argument("targets", GameProfileArgument{}).Suggests(g.suggestBannedPlayers).Executes(g.pardonCommand),
+		),
+		Literal("pardon-ip").Requires(PermissionAdmin).Then(
+			Argument("target", SingleWord).Suggests(g.suggestBannedIPs).Executes(g.pardonIPCommand),
+		),
+		Literal("banlist").Requires(PermissionAdmin).Executes(g.banlistCommand(true, true)).Then(
+			Literal("ips").Executes(g.banlistCommand(false, true)),
+			Literal("players").Executes(g.banlistCommand(true, false)),
+		),
+	)
+}
+
+func (g *Game) whitelistOnCommand(ctx *CommandContext) error {
+	if !g.access.whitelistOn.CompareAndSwap(false, true) {
+		return commandError("commands.whitelist.alreadyOn")
+	}
+	g.log.Info("Whitelist is turned on", zap.String("by", ctx.Source.Name()))
+	ctx.Source.SendMessage(chat.TranslateMsg("commands.whitelist.enabled"))
+	g.enforceWhitelist()
+	return nil
+}
+
+func (g *Game) whitelistOffCommand(ctx *CommandContext) error {
+	if !g.access.whitelistOn.CompareAndSwap(true, false) {
+		return commandError("commands.whitelist.alreadyOff")
+	}
+	g.log.Info("Whitelist is turned off", zap.String("by", ctx.Source.Name()))
+	ctx.Source.SendMessage(chat.TranslateMsg("commands.whitelist.disabled"))
+	return nil
+}
+
+func (g *Game) whitelistListCommand(ctx *CommandContext) error {
+	names := g.suggestWhitelisted(ctx, "")
+	if len(names) == 0 {
+		ctx.Source.SendMessage(chat.TranslateMsg("commands.whitelist.none"))
+		return nil
+	}
+	ctx.Source.SendMessage(chat.TranslateMsg("commands.whitelist.list",
+		chat.Text(strconv.Itoa(len(names))), chat.Text(strings.Join(names, ", "))))
+	return nil
+}
+
+func (g *Game) whitelistAddCommand(ctx *CommandContext) error {
+	profiles, err := ctx.GameProfiles("targets")
+	if err != nil {
+		return err
+	}
+	var changed bool
+	for _, profile := range profiles {
+		if g.access.whitelisted(profile.ID) {
+			continue
+		}
+		entry := whitelistEntry{UUID: profile.ID, Name: profile.Name}
+		if err := g.access.whitelist.put(entry, func(v *whitelistEntry) bool { return v.UUID == profile.ID }); err != nil {
+			return err
+		}
+		ctx.Source.SendMessage(chat.TranslateMsg("commands.whitelist.add.success", chat.Text(profile.Name)))
+		changed = true
+	}
+	if !changed {
+		return commandError("commands.whitelist.add.failed")
+	}
+	return nil
+}
+
+func (g *Game) whitelistRemoveCommand(ctx *CommandContext) error {
+	profiles, err := ctx.GameProfiles("targets")
+	if err != nil {
+		return err
+	}
+	var changed bool
+	for _, profile := range profiles {
+		removed, err := g.access.whitelist.remove(func(v *whitelistEntry) bool { return v.UUID == profile.ID })
+		if err != nil {
+			return err
+		}
+		if removed {
+			ctx.Source.SendMessage(chat.TranslateMsg("commands.whitelist.remove.success", chat.Text(profile.Name)))
+			changed = true
+		}
+	}
+	if !changed {
+		return commandError("commands.whitelist.remove.failed")
+	}
+	g.enforceWhitelist()
+	return nil
+}
+
+func (g *Game) whitelistReloadCommand(ctx *CommandContext) error {
+	if err := g.ReloadAccessLists(); err != nil {
+		g.log.Error("Reload whitelist error", zap.Error(err))
+		return commandError("commands.reload.failure")
+	}
+	ctx.Source.SendMessage(chat.TranslateMsg("commands.whitelist.reloaded"))
+	return nil
+}
+
+func (g *Game) suggestWhitelisted(*CommandContext, string) []string {
+	entries := g.access.whitelist.all()
+	names := make([]string, len(entries))
+	for i, v := range entries {
+		names[i] = v.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (g *Game) banCommand(ctx *CommandContext) error {
+	profiles, err := ctx.GameProfiles("targets")
+	if err != nil {
+		return err
+	}
+	var reason string
+	if ctx.HasArg("reason") {
+		reason = ctx.String("reason")
+	}
+	var changed bool
+	for _, profile := range profiles {
+		if _, ok := g.access.playerBan(profile.ID); ok {
+			continue
+		}
+		ban := playerBan{UUID: profile.ID, Name: profile.Name, banEntry: newBanEntry(ctx.Source.Name(), reason)}
+		if err := g.access.bannedPlayers.put(ban, func(v *playerBan) bool { return v.UUID == profile.ID }); err != nil {
+			return err
+		}
+		g.log.Info("Player is banned", zap.String("name", profile.Name), zap.String("by", ctx.Source.Name()))
+		ctx.Source.SendMessage(chat.TranslateMsg("commands.ban.success", chat.Text(profile.Name), chat.Text(ban.Reason)))
+		for _, c := range g.clients() {
+			if c.GetPlayer().UUID == profile.ID {
+				c.SendDisconnect(chat.TranslateMsg("multiplayer.disconnect.banned"))
+			}
+		}
+		changed = true
+	}
+	if !changed {
+		return commandError("commands.ban.failed")
+	}
+	return nil
+}
+
+func (g *Game) banIPCommand(ctx *CommandContext) error {
+	target := ctx.String("target")
+	var ip string
+	if v := net.ParseIP(target); v != nil {
+		ip = v.String()
+	} else {
+		for _, c := range g.clients() {
+			if strings.EqualFold(c.GetPlayer().Name, target) {
+				ip = normalizeIP(remoteIP(c.RemoteAddr()))
+				break
+			}
+		}
+		if ip == "" {
+			return commandError("commands.banip.invalid")
+		}
+	}
+	if _, ok := g.access.ipBan(ip); ok {
+		return commandError("commands.banip.failed")
+	}
+	var reason string
+	if ctx.HasArg("reason") {
+		reason = ctx.String("reason")
+	}
+	ban := ipBan{IP: ip, banEntry: newBanEntry(ctx.Source.Name(), reason)}
+	if err := g.access.bannedIPs.put(ban, func(v *ipBan) bool { return normalizeIP(v.IP) == ip }); err != nil {
+		return err
+	}
+	g.log.Info("IP is banned", zap.String("ip", ip), zap.String("by", ctx.Source.Name()))
+	ctx.Source.SendMessage(chat.TranslateMsg("commands.banip.success", chat.Text(ip), chat.Text(ban.Reason)))
+
+	var kicked []string
+	for _, c := range g.clients() {
+		if normalizeIP(remoteIP(c.RemoteAddr())) == ip {
+			c.SendDisconnect(chat.TranslateMsg("multiplayer.disconnect.ip_banned"))
+			kicked = append(kicked, c.GetPlayer().Name)
+		}
+	}
+	if len(kicked) > 0 {
+		ctx.Source.SendMessage(chat.TranslateMsg("commands.banip.info",
+			chat.Text(strconv.Itoa(len(kicked))), chat.Text(strings.Join(kicked, ", "))))
+	}
+	return nil
+}
+
+func (g *Game) pardonCommand(ctx *CommandContext) error {
+	profiles, err := ctx.GameProfiles("targets")
+	if err != nil {
+		return err
+	}
+	var changed bool
+	for _, profile := range profiles {
+		removed, err := g.access.bannedPlayers.remove(func(v *playerBan) bool { return v.UUID == profile.ID })
+		if err != nil {
+			return err
+		}
+		if removed {
+			g.log.Info("Player is pardoned", zap.String("name", profile.Name), zap.String("by", ctx.Source.Name()))
+			ctx.Source.SendMessage(chat.TranslateMsg("commands.pardon.success", chat.Text(profile.Name)))
+			changed = true
+		}
+	}
+	if !changed {
+		return commandError("commands.pardon.failed")
+	}
+	return nil
+}
+
+func (g *Game) pardonIPCommand(ctx *CommandContext) error {
+	v := net.ParseIP(ctx.String("target"))
+	if v == nil {
+		return commandError("commands.pardonip.invalid")
+	}
+	ip := v.String()
+	removed, err := g.access.bannedIPs.remove(func(v *ipBan) bool { return normalizeIP(v.IP) == ip })
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return commandError("commands.pardonip.failed")
+	}
+	g.log.Info("IP is pardoned", zap.String("ip", ip), zap.String("by", ctx.Source.Name()))
+	ctx.Source.SendMessage(chat.TranslateMsg("commands.pardonip.success", chat.Text(ip)))
+	return nil
+}
+
+func (g *Game) suggestBannedPlayers(*CommandContext, string) []string {
+	var names []string
+	for _, v := range g.access.bannedPlayers.all() {
+		names = append(names, v.Name)
+	}
+	return names
+}
+
+func (g *Game) suggestBannedIPs(*CommandContext, string) []string {
+	var ips []string
+	for _, v := range g.access.bannedIPs.all() {
+		ips = append(ips, v.IP)
+	}
+	return ips
+}
+
+// banlistCommand returns the handler listing the bans which aren't expired.
+func (g *Game) banlistCommand(players, ips bool) CommandHandler {
+	return func(ctx *CommandContext) error {
+		return g.listBans(ctx, players, ips)
+	}
+}
+
+func (g *Game) listBans(ctx *CommandContext, players, ips bool) error {
+	now := time.Now()
+	type entry struct {
+		target string
+		banEntry
+	}
+	var entries []entry
+	if players {
+		for _, v := range g.access.bannedPlayers.all() {
+			if !v.expired(now) {
+				entries = append(entries, entry{v.Name, v.banEntry})
+			}
+		}
+	}
+	if ips {
+		for _, v := range g.access.bannedIPs.all() {
+			if !v.expired(now) {
+				entries = append(entries, entry{v.IP, v.banEntry})
+			}
+		}
+	}
+	if len(entries) == 0 {
+		ctx.Source.SendMessage(chat.TranslateMsg("commands.banlist.none"))
+		return nil
+	}
+	ctx.Source.SendMessage(chat.TranslateMsg("commands.banlist.list", chat.Text(strconv.Itoa(len(entries)))))
+	for _, v := range entries {
+		ctx.Source.SendMessage(chat.TranslateMsg("commands.banlist.entry",
+			chat.Text(v.target), chat.Text(v.Source), chat.Text(v.Reason)))
+	}
+	return nil
+}
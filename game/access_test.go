@@ -0,0 +1,261 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package game
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Tnze/go-mc/server"
+)
+
+// roundTrip loads the list from the content in vanilla format, and saves it again.
+func roundTrip[T any](t *testing.T, content string) []T {
+	t.Helper()
+	l := jsonList[T]{path: filepath.Join(t.TempDir(), "list.json")}
+	if err := os.WriteFile(l.path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.load(); err != nil {
+		t.Fatal(err)
+	}
+	l.lock.Lock()
+	err := l.save(l.entries)
+	l.lock.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != content {
+		t.Errorf("saved list is different from the loaded one:\n%s\nwant:\n%s", data, content)
+	}
+	return l.all()
+}
+
+func TestBannedPlayers_vanillaFormat(t *testing.T) {
+	bans := roundTrip[playerBan](t, `[
+  {
+    "uuid": "069a79f4-44e9-4726-a5be-fca90e38aaf5",
+    "name": "Notch",
+    "created": "2023-04-01 12:30:00 +0800",
+    "source": "Server",
+    "expires": "forever",
+    "reason": "Banned by an operator."
+  },
+  {
+    "uuid": "853c80ef-3c37-49fd-aa49-938b674adae6",
+    "name": "jeb_",
+    "created": "2023-04-01 12:30:00 +0000",
+    "source": "Tnze",
+    "expires": "2023-05-01 00:00:00 +0000",
+    "reason": "griefing"
+  }
+]`)
+	if len(bans) != 2 {
+		t.Fatalf("got %d bans, want 2", len(bans))
+	}
+	want := playerBan{
+		UUID: uuid.MustParse("069a79f4-44e9-4726-a5be-fca90e38aaf5"),
+		Name: "Notch",
+		banEntry: banEntry{
+			Created: banTime{time.Date(2023, 4, 1, 4, 30, 0, 0, time.UTC)},
+			Source:  "Server",
+			Reason:  defaultBanReason,
+		},
+	}
+	if got := bans[0]; got.UUID != want.UUID || got.Name != want.Name || !got.Created.Equal(want.Created.Time) ||
+		got.Source != want.Source || !got.Expires.IsZero() || got.Reason != want.Reason {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if expires := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC); !bans[1].Expires.Equal(expires) {
+		t.Errorf("expires at %v, want %v", bans[1].Expires, expires)
+	}
+}
+
+func TestBannedIPs_vanillaFormat(t *testing.T) {
+	bans := roundTrip[ipBan](t, `[
+  {
+    "ip": "192.168.0.10",
+    "created": "2023-04-01 12:30:00 +0000",
+    "source": "Server",
+    "expires": "forever",
+    "reason": "Banned by an operator."
+  }
+]`)
+	if len(bans) != 1 || bans[0].IP != "192.168.0.10" || !bans[0].Expires.IsZero() {
+		t.Errorf("got %+v", bans)
+	}
+}
+
+func TestBanTime(t *testing.T) {
+	for _, tt := range []struct {
+		json    string
+		time    time.Time
+		wantErr bool
+	}{
+		{`"forever"`, time.Time{}, false},
+		{`"2023-04-01 12:30:00 +0000"`, time.Date(2023, 4, 1, 12, 30, 0, 0, time.UTC), false},
+		{`"2023-04-01 12:30:00 -0700"`, time.Date(2023, 4, 1, 19, 30, 0, 0, time.UTC), false},
+		{`"2023-04-01T12:30:00Z"`, time.Time{}, true},
+		{`0`, time.Time{}, true},
+	} {
+		var got banTime
+		err := got.UnmarshalJSON([]byte(tt.json))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("unmarshal %s: got error %v, want error: %t", tt.json, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if !got.Equal(tt.time) {
+			t.Errorf("unmarshal %s: got %v, want %v", tt.json, got.Time, tt.time)
+		}
+		data, err := got.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != tt.json {
+			t.Errorf("marshal %v: got %s, want %s", got.Time, data, tt.json)
+		}
+	}
+}
+
+func TestBanEntry_expired(t *testing.T) {
+	now := time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		name    string
+		expires time.Time
+		want    bool
+	}{
+		{"forever", time.Time{}, false},
+		{"future", now.Add(time.Hour), false},
+		{"now", now, false},
+		{"past", now.Add(-time.Second), true},
+	} {
+		b := banEntry{Expires: banTime{tt.expires}}
+		if got := b.expired(now); got != tt.want {
+			t.Errorf("%s: expired = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+// newAccessTestGame creates a game with the access lists and operators in memory, and room for players.
+func newAccessTestGame(whitelistOn bool) *Game {
+	g := &Game{
+		access:     &accessLists{},
+		ops:        &opList{},
+		playerList: &playerList{pingList: server.NewPlayerList(20)},
+	}
+	g.access.whitelistOn.Store(whitelistOn)
+	return g
+}
+
+func TestGame_CheckPlayer(t *testing.T) {
+	var (
+		player      = uuid.New()
+		whitelisted = uuid.New()
+		banned      = uuid.New()
+		expired     = uuid.New()
+		op          = uuid.New()
+		bannedOp    = uuid.New()
+	)
+	permanent := newBanEntry("test", "")
+	past := newBanEntry("test", "")
+	past.Expires = banTime{time.Now().Add(-time.Hour)}
+	newGame := func(whitelistOn bool) *Game {
+		g := newAccessTestGame(whitelistOn)
+		g.access.whitelist.entries = []whitelistEntry{{UUID: whitelisted}, {UUID: banned}, {UUID: expired}}
+		g.access.bannedPlayers.entries = []playerBan{
+			{UUID: banned, banEntry: permanent},
+			{UUID: expired, banEntry: past},
+			{UUID: bannedOp, banEntry: permanent},
+		}
+		g.ops.entries = []opEntry{{UUID: op, Level: PermissionAdmin}, {UUID: bannedOp, Level: PermissionOwner}}
+		return g
+	}
+	for _, tt := range []struct {
+		name        string
+		id          uuid.UUID
+		whitelistOn bool
+		want        bool
+		wantReason  string
+	}{
+		{"player", player, false, true, ""},
+		{"player not whitelisted", player, true, false, "multiplayer.disconnect.not_whitelisted"},
+		{"whitelisted", whitelisted, true, true, ""},
+		{"banned", banned, false, false, "multiplayer.disconnect.banned.reason"},
+		{"banned even if whitelisted", banned, true, false, "multiplayer.disconnect.banned.reason"},
+		{"ban expired", expired, false, true, ""},
+		{"ban expired and whitelisted", expired, true, true, ""},
+		{"operator bypasses whitelist", op, true, true, ""},
+		{"operator still banned", bannedOp, true, false, "multiplayer.disconnect.banned.reason"},
+	} {
+		ok, reason := newGame(tt.whitelistOn).CheckPlayer("", tt.id, 0)
+		if ok != tt.want || reason.Translate != tt.wantReason {
+			t.Errorf("%s: got %t %q, want %t %q", tt.name, ok, reason.Translate, tt.want, tt.wantReason)
+		}
+	}
+}
+
+func TestAccessLists_ipBan(t *testing.T) {
+	past := newBanEntry("test", "")
+	past.Expires = banTime{time.Now().Add(-time.Hour)}
+	a := &accessLists{}
+	a.bannedIPs.entries = []ipBan{
+		{IP: "192.168.0.10", banEntry: newBanEntry("test", "")},
+		{IP: "::ffff:10.0.0.1", banEntry: newBanEntry("test", "")},
+		{IP: "2001:0db8:0000:0000:0000:0000:0000:0001", banEntry: newBanEntry("test", "")},
+		{IP: "192.168.0.20", banEntry: past},
+	}
+	for _, tt := range []struct {
+		ip   string
+		want bool
+	}{
+		{"192.168.0.10", true},
+		{"::ffff:192.168.0.10", true},
+		{"192.168.0.11", false},
+		{"10.0.0.1", true},
+		{"2001:db8::1", true},
+		{"2001:db8::2", false},
+		{"192.168.0.20", false},
+		{"not an ip", false},
+	} {
+		if _, got := a.ipBan(tt.ip); got != tt.want {
+			t.Errorf("ipBan(%s) = %t, want %t", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestRemoteIP(t *testing.T) {
+	for _, tt := range []struct{ addr, want string }{
+		{"192.168.0.10:25565", "192.168.0.10"},
+		{"[2001:db8::1]:25565", "2001:db8::1"},
+		{"192.168.0.10", "192.168.0.10"},
+	} {
+		if got := remoteIP(tt.addr); got != tt.want {
+			t.Errorf("remoteIP(%s) = %s, want %s", tt.addr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package game
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Tnze/go-mc/chat"
+	"github.com/go-mc/server/client"
+	"github.com/go-mc/server/world"
+)
+
+// registerAdminCommands registers the built-in commands for managing the server.
+func (g *Game) registerAdminCommands() {
+	g.commands.Register(
+		Literal("gamemode").Requires(PermissionGamemaster).Then(
+			Argument("gamemode", GamemodeArgument{}).Executes(g.gamemodeCommand).Then(
+				Argument("target", PlayerArgument{}).Executes(g.gamemodeCommand),
+			),
+		),
+		teleportCommand("teleport", g),
+		teleportCommand("tp", g),
+		Literal("kick").Requires(PermissionAdmin).Then(
+			Argument("targets", PlayerArgument{}).Executes(g.kickCommand).Then(
+				Argument("reason", MessageArgument{}).Executes(g.kickCommand),
+			),
+		),
+		Literal("list").Executes(g.listCommand),
+		Literal("say").Requires(PermissionGamemaster).Then(
+			Argument("message", MessageArgument{}).Executes(g.sayCommand),
+		),
+		Literal("save-all").Requires(PermissionOwner).Executes(g.saveAllCommand),
+		Literal("stop").Requires(PermissionOwner).Executes(g.stopCommand),
+		Literal("op").Requires(PermissionAdmin).Then(
+			Argument("targets", GameProfileArgument{}).Executes(g.opCommand),
+		),
+		Literal("deop").Requires(PermissionAdmin).Then(
+			Argument("targets", GameProfileArgument{}).Executes(g.deopCommand),
+		),
+	)
+}
+
+func (g *Game) gamemodeCommand(ctx *CommandContext) error {
+	mode := ctx.Int("gamemode")
+	var targets []*client.Client
+	if ctx.HasArg("target") {
+		var err error
+		if targets, err = ctx.Players("target"); err != nil {
+			return err
+		}
+	} else if self, ok := ctx.Player(); ok {
+		targets = []*client.Client{self}
+	} else {
+		return commandError("permissions.requires.player")
+	}
+
+	modeName := chat.TranslateMsg("gameMode." + gamemodeNames[mode])
+	self, _ := ctx.Player()
+	for _, c := range targets {
+		p := c.GetPlayer()
+		if p.Gamemode() == mode {
+			continue
+		}
+		g.setGamemode(c, mode)
+		if c == self {
+			ctx.Source.SendMessage(chat.TranslateMsg("commands.gamemode.success.self", modeName))
+		} else {
+			c.SendSystemChat(chat.TranslateMsg("gameMode.changed", modeName), false)
+			ctx.Source.SendMessage(chat.TranslateMsg("commands.gamemode.success.other", chat.Text(p.Name), modeName))
+		}
+	}
+	return nil
+}
+
+// setGamemode changes the gamemode of the player, and updates the tab list of all players.
+func (g *Game) setGamemode(c *client.Client, mode int32) {
+	p := c.GetPlayer()
+	p.SetGamemode(mode)
+	c.SendGameEvent(client.GameEventChangeGameMode, float32(mode))
+	action := client.NewPlayerInfoAction(client.PlayerInfoUpdateGameMode)
+	for _, other := range g.clients() {
+		other.SendPlayerInfoUpdate(action, []*world.Player{p})
+	}
+}
+
+// teleportCommand builds the command tree of /teleport, which is also registered as /tp.
+//
+//	/tp <location>
+//	/tp <destination>
+//	/tp <targets> <location>
+//	/tp <targets> <destination>
+func teleportCommand(name string, g *Game) *CommandNode {
+	return Literal(name).Requires(PermissionGamemaster).Then(
+		Argument("location", Vec3Argument{}).Executes(g.teleportCommand),
+		Argument("destination", PlayerArgument{Single: true}).Executes(g.teleportCommand),
+		Argument("targets", PlayerArgument{}).Then(
+			Argument("location", Vec3Argument{}).Executes(g.teleportCommand),
+			Argument("destination", PlayerArgument{Single: true}).Executes(g.teleportCommand),
+		),
+	)
+}
+
+func (g *Game) teleportCommand(ctx *CommandContext) error {
+	var targets []*client.Client
+	if ctx.HasArg("targets") {
+		var err error
+		if targets, err = ctx.Players("targets"); err != nil {
+			return err
+		}
+	} else if self, ok := ctx.Player(); ok {
+		targets = []*client.Client{self}
+	} else {
+		return commandError("permissions.requires.player")
+	}
+
+	var (
+		dimension string
+		pos       world.Position
+		to        chat.Message
+	)
+	if ctx.HasArg("destination") {
+		destinations, err := ctx.Players("destination")
+		if err != nil {
+			return err
+		}
+		dest := destinations[0].GetPlayer()
+		g.dimensionLock.Lock()
+		dimension = dest.Dimension
+		g.dimensionLock.Unlock()
+		pos, _ = g.playerPosition(dest)
+		to = chat.Text(dest.Name)
+	} else {
+		pos = ctx.Position("location")
+		if self, ok := ctx.Player(); ok {
+			g.dimensionLock.Lock()
+			dimension = self.GetPlayer().Dimension
+			g.dimensionLock.Unlock()
+		} else {
+			dimension = overworld
+		}
+	}
+
+	for _, c := range targets {
+		_, rot := g.playerPosition(c.GetPlayer())
+		if err := g.teleport(c, dimension, pos, rot); err != nil {
+			return err
+		}
+	}
+
+	var msg chat.Message
+	switch {
+	case len(targets) == 1 && ctx.HasArg("destination"):
+		msg = chat.TranslateMsg("commands.teleport.success.entity.single", chat.Text(targets[0].GetPlayer().Name), to)
+	case len(targets) == 1:
+		msg = chat.TranslateMsg("commands.teleport.success.location.single",
+			chat.Text(targets[0].GetPlayer().Name), formatCoordinate(pos[0]), formatCoordinate(pos[1]), formatCoordinate(pos[2]))
+	case ctx.HasArg("destination"):
+		msg = chat.TranslateMsg("commands.teleport.success.entity.multiple", chat.Text(strconv.Itoa(len(targets))), to)
+	default:
+		msg = chat.TranslateMsg("commands.teleport.success.location.multiple",
+			chat.Text(strconv.Itoa(len(targets))), formatCoordinate(pos[0]), formatCoordinate(pos[1]), formatCoordinate(pos[2]))
+	}
+	ctx.Source.SendMessage(msg)
+	return nil
+}
+
+func formatCoordinate(v float64) chat.Message {
+	return chat.Text(strconv.FormatFloat(v, 'f', 6, 64))
+}
+
+// teleport moves the player to the position, changing the dimension if needed.
+// The movements of the player are ignored until the client confirms the teleport.
+// Nothing happens if the player is still joining or has already left.
+func (g *Game) teleport(c *client.Client, dimension string, pos world.Position, rot world.Rotation) error {
+	g.dimensionLock.Lock()
+	defer g.dimensionLock.Unlock()
+	from, ok := g.playerWorlds[c]
+	if !ok {
+		return nil
+	}
+	if from.Name() != dimension {
+		to, ok := g.worlds[dimension]
+		if !ok {
+			return fmt.Errorf("unknown dimension: %s", dimension)
+		}
+		g.changeDimension(c, to, pos, rot)
+		return nil
+	}
+	from.TeleportPlayer(c, c.GetPlayer(), pos, rot)
+	return nil
+}
+
+func (g *Game) kickCommand(ctx *CommandContext) error {
+	targets, err := ctx.Players("targets")
+	if err != nil {
+		return err
+	}
+	reason := chat.TranslateMsg("multiplayer.disconnect.kicked")
+	if ctx.HasArg("reason") {
+		reason = chat.Text(ctx.String("reason"))
+	}
+	for _, c := range targets {
+		c.SendDisconnect(reason)
+		ctx.Source.SendMessage(chat.TranslateMsg("commands.kick.success", chat.Text(c.GetPlayer().Name), reason))
+	}
+	return nil
+}
+
+func (g *Game) listCommand(ctx *CommandContext) error {
+	clients := g.clients()
+	names := make([]string, len(clients))
+	for i, c := range clients {
+		names[i] = c.GetPlayer().Name
+	}
+	ctx.Source.SendMessage(chat.TranslateMsg("commands.list.players",
+		chat.Text(strconv.Itoa(len(clients))),
+		chat.Text(strconv.Itoa(g.pingList.MaxPlayer())),
+		chat.Text(strings.Join(names, ", ")),
+	))
+	return nil
+}
+
+func (g *Game) sayCommand(ctx *CommandContext) error {
+	msg := chat.TranslateMsg("chat.type.announcement", chat.Text(ctx.Source.Name()), chat.Text(ctx.String("message")))
+	g.globalChat.broadcastSystemChat(msg, false)
+	return nil
+}
+
+func (g *Game) saveAllCommand(ctx *CommandContext) error {
+	ctx.Source.SendMessage(chat.TranslateMsg("commands.save.saving"))
+	if err := g.saveAll(); err != nil {
+		return commandError("commands.save.failed")
+	}
+	ctx.Source.SendMessage(chat.TranslateMsg("commands.save.success"))
+	return nil
+}
+
+func (g *Game) stopCommand(ctx *CommandContext) error {
+	ctx.Source.SendMessage(chat.TranslateMsg("commands.stop.stopping"))
+	g.Stop()
+	return nil
+}
@@ -0,0 +1,428 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package game
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/Tnze/go-mc/chat"
+	"github.com/go-mc/server/client"
+)
+
+const (
+	mutedPlayersFile = "muted-players.json"
+	// globalChannel is the name of the chat everyone receives, which can't be used by the configured channels.
+	globalChannel = "global"
+)
+
+// chatChannel is a group of players talking to each other.
+type chatChannel struct {
+	name string
+	ChannelConfig
+}
+
+// chatMember is the chat state of an online player.
+type chatMember struct {
+	// focus is the channel the chat messages of the player are sent to, empty for the global chat.
+	focus   string
+	joined  map[string]bool
+	ignored map[uuid.UUID]bool
+}
+
+// playerMute is an element in the muted-players.json.
+type playerMute struct {
+	UUID uuid.UUID `json:"uuid"`
+	Name string    `json:"name"`
+	banEntry
+}
+
+// defaultMuteReason is the reason of a mute if the operator doesn't give one.
+const defaultMuteReason = "Muted by an operator."
+
+func newChatChannels(configs map[string]ChannelConfig) (map[string]*chatChannel, error) {
+	channels := make(map[string]*chatChannel, len(configs))
+	for name, config := range configs {
+		if name == globalChannel || strings.ContainsRune(name, ' ') {
+			return nil, fmt.Errorf("invalid channel name %q", name)
+		}
+		if config.DisplayName == "" {
+			config.DisplayName = name
+		}
+		channels[name] = &chatChannel{name: name, ChannelConfig: config}
+	}
+	return channels, nil
+}
+
+// joinChannels starts tracking the chat state of the player, who joins the auto-join channels.
+func (g *globalChat) joinChannels(c *client.Client) {
+	m := &chatMember{joined: make(map[string]bool), ignored: make(map[uuid.UUID]bool)}
+	level := c.GetPlayer().PermissionLevel()
+	for name, ch := range g.channels {
+		if ch.AutoJoin && level >= ch.Permission {
+			m.joined[name] = true
+		}
+	}
+	g.membersLock.Lock()
+	defer g.membersLock.Unlock()
+	g.members[c] = m
+}
+
+func (g *globalChat) leaveChannels(c *client.Client) {
+	g.membersLock.Lock()
+	defer g.membersLock.Unlock()
+	delete(g.members, c)
+}
+
+// recipients returns the players receiving the chat message of the sender, and the chat type decorating it.
+// The message is sent to the channel the sender is focusing on, and the players ignoring the sender are excluded.
+func (g *globalChat) recipients(sender *client.Client) ([]*client.Client, chat.Type) {
+	p := sender.GetPlayer()
+	g.membersLock.Lock()
+	var ch *chatChannel
+	if m := g.members[sender]; m != nil {
+		ch = g.channels[m.focus]
+	}
+	g.membersLock.Unlock()
+
+	if ch == nil {
+		return g.excludeIgnoring(g.players.clients(), p.UUID, nil), g.chatType("minecraft:chat", chat.Text(p.Name), nil)
+	}
+	var candidates []*client.Client
+	if ch.Radius > 0 {
+		if w := g.worldOf(p); w != nil {
+			for _, v := range w.NearbyPlayers(p, ch.Radius) {
+				candidates = append(candidates, v.(*client.Client))
+			}
+		}
+	} else {
+		candidates = g.players.clients()
+	}
+	channelName := chat.Text("[" + ch.DisplayName + "]")
+	chatType := g.chatType("minecraft:team_msg_command_incoming", chat.Text(p.Name), &channelName)
+	return g.excludeIgnoring(candidates, p.UUID, ch), chatType
+}
+
+// excludeIgnoring filters out the players ignoring the sender, and the ones not in the channel if it isn't nil.
+func (g *globalChat) excludeIgnoring(clients []*client.Client, sender uuid.UUID, ch *chatChannel) []*client.Client {
+	g.membersLock.Lock()
+	defer g.membersLock.Unlock()
+	filtered := clients[:0]
+	for _, c := range clients {
+		m := g.members[c]
+		if m == nil || m.ignored[sender] || ch != nil && !m.joined[ch.name] {
+			continue
+		}
+		filtered = append(filtered, c)
+	}
+	return filtered
+}
+
+// ignores reports whether the player doesn't want to receive messages from the sender.
+func (g *globalChat) ignores(c *client.Client, sender uuid.UUID) bool {
+	g.membersLock.Lock()
+	defer g.membersLock.Unlock()
+	m := g.members[c]
+	return m != nil && m.ignored[sender]
+}
+
+// mute returns the mute of the player if it isn't expired.
+func (g *globalChat) mute(id uuid.UUID) (playerMute, bool) {
+	now := time.Now()
+	return g.muted.find(func(v *playerMute) bool { return v.UUID == id && !v.expired(now) })
+}
+
+// checkMuted tells the player if it's muted, in which case the messages are dropped.
+func (g *globalChat) checkMuted(c *client.Client) bool {
+	mute, ok := g.mute(c.GetPlayer().UUID)
+	if !ok {
+		return false
+	}
+	msg := "You are muted: " + mute.Reason
+	if !mute.Expires.IsZero() {
+		msg += " (until " + mute.Expires.Format(banTimeLayout) + ")"
+	}
+	c.SendSystemChat(chat.Text(msg).SetColor(chat.Red), false)
+	return true
+}
+
+// registerChannelCommands registers the commands of the chat channels, ignoring and muting.
+func (g *Game) registerChannelCommands() {
+	g.commands.Register(
+		Literal("channel").Then(
+			Literal("list").Executes(g.channelListCommand),
+			Literal("join").Then(
+				Argument("channel", SingleWord).Suggests(g.suggestChannels).Executes(g.channelJoinCommand),
+			),
+			Literal("leave").Then(
+				Argument("channel", SingleWord).Suggests(g.suggestChannels).Executes(g.channelLeaveCommand),
+			),
+			Literal("speak").Then(
+				Argument("channel", SingleWord).Suggests(g.suggestChannels).Executes(g.channelSpeakCommand),
+			),
+		),
+		Literal("ignore").Then(
+			Argument("targets", PlayerArgument{}).Executes(g.ignoreCommand(true)),
+		),
+		Literal("unignore").Then(
+			Argument("targets", PlayerArgument{}).Executes(g.ignoreCommand(false)),
+		),
+		Literal("mute").Requires(PermissionAdmin).Then(
+			Argument("targets", GameProfileArgument{}).Executes(g.muteCommand).Then(
+				Argument("duration", SingleWord).Executes(g.muteCommand).Then(
+					Argument("reason", MessageArgument{}).Executes(g.muteCommand),
+				),
+			),
+		),
+		Literal("unmute").Requires(PermissionAdmin).Then(
+			Argument("targets", GameProfileArgument{}).Suggests(g.suggestMuted).Executes(g.unmuteCommand),
+		),
+	)
+}
+
+// chatMember returns the chat state of the player executing the command, which must be held with the membersLock.
+func (g *Game) chatMember(ctx *CommandContext) (*chatMember, error) {
+	self, ok := ctx.Player()
+	if !ok {
+		return nil, commandError("permissions.requires.player")
+	}
+	if m := g.globalChat.members[self]; m != nil {
+		return m, nil
+	}
+	return nil, commandError("permissions.requires.player")
+}
+
+// channel returns the channel in the argument, which the source has the permission to join.
+func (g *Game) channel(ctx *CommandContext) (*chatChannel, error) {
+	ch := g.globalChat.channels[ctx.String("channel")]
+	if ch == nil || ctx.Source.PermissionLevel() < ch.Permission {
+		return nil, &CommandError{Message: chat.Text("Unknown channel: " + ctx.String("channel"))}
+	}
+	return ch, nil
+}
+
+func (g *Game) channelListCommand(ctx *CommandContext) error {
+	g.globalChat.membersLock.Lock()
+	defer g.globalChat.membersLock.Unlock()
+	m, _ := g.chatMember(ctx)
+	names := []string{globalChannel}
+	names = append(names, g.suggestChannels(ctx, "")...)
+	for i, name := range names {
+		switch {
+		case m != nil && (m.focus == name || m.focus == "" && name == globalChannel):
+			names[i] += " (speaking)"
+		case m != nil && m.joined[name]:
+			names[i] += " (joined)"
+		}
+	}
+	ctx.Source.SendMessage(chat.Text("Channels: " + strings.Join(names, ", ")))
+	return nil
+}
+
+func (g *Game) channelJoinCommand(ctx *CommandContext) error {
+	ch, err := g.channel(ctx)
+	if err != nil {
+		return err
+	}
+	g.globalChat.membersLock.Lock()
+	defer g.globalChat.membersLock.Unlock()
+	m, err := g.chatMember(ctx)
+	if err != nil {
+		return err
+	}
+	m.joined[ch.name] = true
+	m.focus = ch.name
+	ctx.Source.SendMessage(chat.Text("You are now speaking in " + ch.DisplayName))
+	return nil
+}
+
+func (g *Game) channelLeaveCommand(ctx *CommandContext) error {
+	ch, err := g.channel(ctx)
+	if err != nil {
+		return err
+	}
+	g.globalChat.membersLock.Lock()
+	defer g.globalChat.membersLock.Unlock()
+	m, err := g.chatMember(ctx)
+	if err != nil {
+		return err
+	}
+	if !m.joined[ch.name] {
+		return &CommandError{Message: chat.Text("You are not in " + ch.DisplayName)}
+	}
+	delete(m.joined, ch.name)
+	if m.focus == ch.name {
+		m.focus = ""
+	}
+	ctx.Source.SendMessage(chat.Text("You left " + ch.DisplayName))
+	return nil
+}
+
+func (g *Game) channelSpeakCommand(ctx *CommandContext) error {
+	var ch *chatChannel
+	if ctx.String("channel") != globalChannel {
+		var err error
+		if ch, err = g.channel(ctx); err != nil {
+			return err
+		}
+	}
+	g.globalChat.membersLock.Lock()
+	defer g.globalChat.membersLock.Unlock()
+	m, err := g.chatMember(ctx)
+	if err != nil {
+		return err
+	}
+	if ch == nil {
+		m.focus = ""
+		ctx.Source.SendMessage(chat.Text("You are now speaking in the global chat"))
+		return nil
+	}
+	if !m.joined[ch.name] {
+		return &CommandError{Message: chat.Text("You are not in " + ch.DisplayName)}
+	}
+	m.focus = ch.name
+	ctx.Source.SendMessage(chat.Text("You are now speaking in " + ch.DisplayName))
+	return nil
+}
+
+// suggestChannels returns the names of the channels the source can join.
+func (g *Game) suggestChannels(ctx *CommandContext, _ string) []string {
+	names := make([]string, 0, len(g.globalChat.channels))
+	for name, ch := range g.globalChat.channels {
+		if ctx.Source.PermissionLevel() >= ch.Permission {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ignoreCommand returns the handler of /ignore if ignore is set, otherwise /unignore.
+func (g *Game) ignoreCommand(ignore bool) CommandHandler {
+	return func(ctx *CommandContext) error {
+		targets, err := ctx.Players("targets")
+		if err != nil {
+			return err
+		}
+		g.globalChat.membersLock.Lock()
+		defer g.globalChat.membersLock.Unlock()
+		m, err := g.chatMember(ctx)
+		if err != nil {
+			return err
+		}
+		for _, c := range targets {
+			p := c.GetPlayer()
+			if ignore {
+				m.ignored[p.UUID] = true
+				ctx.Source.SendMessage(chat.Text("You are ignoring " + p.Name))
+			} else {
+				delete(m.ignored, p.UUID)
+				ctx.Source.SendMessage(chat.Text("You are no longer ignoring " + p.Name))
+			}
+		}
+		return nil
+	}
+}
+
+// parseMuteDuration parses the duration like "30m" or "7d", 0 means forever.
+func parseMuteDuration(s string) (time.Duration, error) {
+	if s == "forever" {
+		return 0, nil
+	}
+	if days := strings.TrimSuffix(s, "d"); days != s {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid duration: %s", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration: %s", s)
+	}
+	return d, nil
+}
+
+func (g *Game) muteCommand(ctx *CommandContext) error {
+	profiles, err := ctx.GameProfiles("targets")
+	if err != nil {
+		return err
+	}
+	var duration time.Duration
+	if ctx.HasArg("duration") {
+		if duration, err = parseMuteDuration(ctx.String("duration")); err != nil {
+			return &CommandError{Message: chat.Text(err.Error())}
+		}
+	}
+	reason := defaultMuteReason
+	if ctx.HasArg("reason") {
+		reason = ctx.String("reason")
+	}
+	for _, profile := range profiles {
+		mute := playerMute{UUID: profile.ID, Name: profile.Name, banEntry: newBanEntry(ctx.Source.Name(), reason)}
+		if duration > 0 {
+			mute.Expires = banTime{mute.Created.Add(duration)}
+		}
+		if err := g.globalChat.muted.put(mute, func(v *playerMute) bool { return v.UUID == profile.ID }); err != nil {
+			return err
+		}
+		g.log.Info("Player is muted", zap.String("name", profile.Name), zap.String("by", ctx.Source.Name()))
+		ctx.Source.SendMessage(chat.Text("Muted " + profile.Name + ": " + reason))
+	}
+	return nil
+}
+
+func (g *Game) unmuteCommand(ctx *CommandContext) error {
+	profiles, err := ctx.GameProfiles("targets")
+	if err != nil {
+		return err
+	}
+	var changed bool
+	for _, profile := range profiles {
+		removed, err := g.globalChat.muted.remove(func(v *playerMute) bool { return v.UUID == profile.ID })
+		if err != nil {
+			return err
+		}
+		if removed {
+			ctx.Source.SendMessage(chat.Text("Unmuted " + profile.Name))
+			changed = true
+		}
+	}
+	if !changed {
+		return &CommandError{Message: chat.Text("Nothing changed. The player isn't muted")}
+	}
+	return nil
+}
+
+func (g *Game) suggestMuted(*CommandContext, string) []string {
+	entries := g.globalChat.muted.all()
+	names := make([]string, 0, len(entries))
+	now := time.Now()
+	for _, v := range entries {
+		if !v.expired(now) {
+			names = append(names, v.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
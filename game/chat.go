@@ -17,6 +17,10 @@
 package game
 
 import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
@@ -26,7 +30,9 @@ import (
 	pk "github.com/Tnze/go-mc/net/packet"
 	"github.com/Tnze/go-mc/registry"
 	"github.com/Tnze/go-mc/server"
+	"github.com/Tnze/go-mc/yggdrasil/user"
 	"github.com/go-mc/server/client"
+	"github.com/go-mc/server/world"
 )
 
 const MsgExpiresTime = time.Minute * 5
@@ -35,6 +41,17 @@ type globalChat struct {
 	log           *zap.Logger
 	players       *playerList
 	chatTypeCodec *registry.Registry[registry.ChatType]
+	// onlineMode is set if the profile keys can be verified, since they're bound to the online UUIDs.
+	onlineMode bool
+	// enforceSecureProfile rejects the messages which aren't signed.
+	enforceSecureProfile bool
+	// worldOf returns the world the player is in, used to find the nearby players.
+	worldOf func(p *world.Player) *world.World
+
+	channels    map[string]*chatChannel
+	membersLock sync.Mutex
+	members     map[*client.Client]*chatMember
+	muted       jsonList[playerMute]
 }
 
 func (g *globalChat) broadcastSystemChat(msg chat.Message, overlay bool) {
@@ -50,7 +67,7 @@ func (g *globalChat) Handle(p pk.Packet, c *client.Client) error {
 		timestampLong pk.Long
 		salt          pk.Long
 		signature     pk.Option[sign.Signature, *sign.Signature]
-		lastSeen      sign.HistoryUpdate
+		lastSeen      = sign.HistoryUpdate{Acknowledged: pk.NewFixedBitSet(client.LastSeenCount)}
 	)
 	err := p.Scan(
 		&message,
@@ -75,54 +92,249 @@ func (g *globalChat) Handle(p pk.Packet, c *client.Client) error {
 		return nil
 	}
 
-	if !player.SetLastChatTimestamp(timestamp) {
-		c.SendDisconnect(chat.TranslateMsg("multiplayer.disconnect.out_of_order_chat"))
+	acknowledged, ok := g.receive(c, timestamp, lastSeen, false)
+	if !ok {
 		return nil
 	}
 
-	// TODO: check if the client disable chatting
-	if false {
-		c.SendSystemChat(chat.TranslateMsg("chat.disabled.options").SetColor(chat.Red), false)
+	msg := sign.Message{
+		MessageBody: &sign.MessageBody{
+			PlainMsg:  string(message),
+			Timestamp: timestamp,
+			Salt:      int64(salt),
+			LastSeen:  acknowledged,
+		},
+	}
+	if signature.Has {
+		msg.Signature = &signature.Val
+	}
+	if !g.accept(c, &msg) {
 		return nil
 	}
 
-	// verify message
-	//var playerMsg sign.PlayerMessage
-	////if player.PubKey != nil {
-	////}
-
 	if time.Since(timestamp) > MsgExpiresTime {
 		logger.Warn("Player send expired message", zap.String("msg", string(message)))
 		return nil
 	}
-	chatTypeID, decorator := g.chatTypeCodec.Find("minecraft:chat")
-	chatType := chat.Type{
-		ID:         chatTypeID,
-		SenderName: chat.Text(player.Name),
-		TargetName: nil,
+	recipients, chatType := g.recipients(c)
+	logger.Info(g.decorate(&chatType, string(message)).String())
+	for _, c := range recipients {
+		c.SendPlayerChat(&msg, &chatType)
+	}
+	return nil
+}
+
+// chatType binds the names of the sender and the target to the chat type, which decorates the messages.
+func (g *globalChat) chatType(name string, sender chat.Message, target *chat.Message) chat.Type {
+	id, _ := g.chatTypeCodec.Find(name)
+	return chat.Type{ID: id, SenderName: sender, TargetName: target}
+}
+
+// decorate formats the message like the clients do, which is used for logging and the non-player sources.
+func (g *globalChat) decorate(chatType *chat.Type, content string) chat.Message {
+	decoration := g.chatTypeCodec.FindByID(chatType.ID)
+	if decoration == nil {
+		return chat.Text(content)
+	}
+	if chatType.TargetName == nil {
+		// the decoration may be configured to show the target
+		bound := *chatType
+		bound.TargetName = new(chat.Message)
+		chatType = &bound
+	}
+	msg := chatType.Decorate(chat.Text(content), &decoration.Chat)
+	if strings.Contains(msg.Translate, "%") {
+		// the configured templates aren't in the translation table, so they are formatted here.
+		args := make([]any, len(msg.With))
+		for i := range msg.With {
+			args[i] = msg.With[i].ClearString()
+		}
+		msg.Text, msg.Translate, msg.With = fmt.Sprintf(msg.Translate, args...), "", nil
+	}
+	return msg
+}
+
+// commandMessage returns the message argument of the executing command as a chat message.
+// The message is nil if the source isn't a player, which should be sent as disguised chat.
+// If the message is rejected, ok is false and the player is told why.
+func (g *globalChat) commandMessage(ctx *CommandContext, name string) (msg *sign.Message, ok bool) {
+	src, isPlayer := ctx.Source.(playerSource)
+	if !isPlayer || src.command == nil {
+		return nil, true
+	}
+	msg = &sign.Message{
+		Signature: src.command.signatures[name],
+		MessageBody: &sign.MessageBody{
+			PlainMsg:  ctx.String(name),
+			Timestamp: src.command.timestamp,
+			Salt:      src.command.salt,
+			LastSeen:  src.command.lastSeen,
+		},
+	}
+	delete(src.command.signatures, name)
+	if !g.accept(src.Client, msg) {
+		return nil, false
+	}
+	return msg, true
+}
+
+// sendChat sends the message got by commandMessage to the client.
+func sendChat(c *client.Client, msg *sign.Message, content string, chatType *chat.Type) {
+	if msg != nil {
+		c.SendPlayerChat(msg, chatType)
+	} else {
+		c.SendDisguisedChat(chat.Text(content), chatType)
+	}
+}
+
+// applyChatFormats overrides the decorations of the chat types, which are sent to the clients when they join.
+func applyChatFormats(codec *registry.Registry[registry.ChatType], formats map[string]ChatFormatConfig) error {
+	for name, format := range formats {
+		_, chatType := codec.Find(name)
+		if chatType == nil {
+			return fmt.Errorf("unknown chat type %q", name)
+		}
+		for _, param := range format.Parameters {
+			if param != "sender" && param != "target" && param != "content" {
+				return fmt.Errorf("unknown parameter %q of chat type %q", param, name)
+			}
+		}
+		if format.Format != "" {
+			chatType.Chat.TranslationKey = format.Format
+		}
+		if format.Parameters != nil {
+			chatType.Chat.Parameters = format.Parameters
+		}
+		if format.Color != "" {
+			chatType.Chat.Style.Color = format.Color
+		}
+	}
+	return nil
+}
+
+// receive checks the chat message or command sent by the player, and applies the last seen messages acknowledged with it.
+// The acknowledged signatures are returned, ok is false if the message is rejected.
+func (g *globalChat) receive(c *client.Client, timestamp time.Time, lastSeen sign.HistoryUpdate, command bool) (acknowledged []*sign.Signature, ok bool) {
+	if !c.GetPlayer().SetLastChatTimestamp(timestamp) {
+		c.SendDisconnect(chat.TranslateMsg("multiplayer.disconnect.out_of_order_chat"))
+		return nil, false
+	}
+
+	if !c.CanChat(command) || kickSpammer(c) {
+		return nil, false
+	}
+
+	acknowledged, ok = c.AcknowledgeChats(lastSeen)
+	if !ok {
+		g.log.Warn("Player sent invalid last seen messages", zap.String("sender", c.GetPlayer().Name))
+		c.SendDisconnect(chat.TranslateMsg("multiplayer.disconnect.chat_validation_failed"))
+		return nil, false
+	}
+	return acknowledged, true
+}
+
+// accept verifies the message and tells the player why if it's rejected, muted players are also rejected.
+func (g *globalChat) accept(c *client.Client, msg *sign.Message) bool {
+	reason, disconnect := g.verify(c.GetPlayer(), msg)
+	if reason == nil {
+		return !g.checkMuted(c)
+	}
+	if disconnect {
+		c.SendDisconnect(*reason)
+	} else {
+		c.SendSystemChat(reason.SetColor(chat.Red), false)
+	}
+	return false
+}
+
+// verify checks the signature of the message and links it to the chain of the sender.
+// If the message is rejected, the reason is returned, and disconnect is set if the chain is broken by the message.
+func (g *globalChat) verify(player *world.Player, msg *sign.Message) (reason *chat.Message, disconnect bool) {
+	session := player.ChatSession()
+	if session == nil {
+		if g.enforceSecureProfile {
+			return chatReason("chat.disabled.missingProfileKey"), false
+		}
+		// unsigned messages are shown as "not secure" by the clients
+		msg.Prev, msg.Signature = sign.Prev{Sender: player.UUID}, nil
+		return nil, false
+	}
+	if msg.Signature == nil {
+		return chatReason("chat.disabled.missingProfileKey"), false
+	}
+	if session.PublicKey.ExpiresAt.Before(time.Now()) {
+		return chatReason("chat.disabled.expiredProfileKey"), false
+	}
+	link, ok := player.NextChatLink()
+	if !ok {
+		return chatReason("chat.disabled.chain_broken"), false
+	}
+	msg.Prev = link
+	if !verifyChatMessage(&session.PublicKey, msg) {
+		g.log.Warn("Player sent message with invalid signature", zap.String("sender", player.Name))
+		player.BreakChatChain()
+		return chatReason("chat.disabled.invalid_signature"), true
+	}
+	player.AdvanceChatChain()
+	return nil, false
+}
+
+// defaultChatSpamLimiter is the same as vanilla, which counts 20 ticks for each message and kicks the player over 200 ticks.
+var defaultChatSpamLimiter = Limiter{Every: duration{time.Second}, N: 10}
+
+// kickSpammer counts a chat message or command, and kicks the player if sending too fast. Operators are never kicked.
+func kickSpammer(c *client.Client) bool {
+	if c.ChatSpam() && c.GetPlayer().PermissionLevel() == PermissionAll {
+		c.SendDisconnect(chat.TranslateMsg("disconnect.spam"))
+		return true
+	}
+	return false
+}
+
+func chatReason(key string) *chat.Message {
+	msg := chat.TranslateMsg(key)
+	return &msg
+}
+
+// HandleSessionUpdate accepts the key which signs the messages of the player, and tells other players about it.
+func (g *globalChat) HandleSessionUpdate(p pk.Packet, c *client.Client) error {
+	var session sign.Session
+	if err := p.Scan(&session); err != nil {
+		return err
+	}
+	player := c.GetPlayer()
+	if !g.onlineMode {
+		// the key is bound to the online UUID, which is different from the offline one.
+		g.log.Debug("Ignore chat session in offline mode", zap.String("name", player.Name))
+		return nil
+	}
+	old := player.ChatSession()
+	if old != nil && sameProfileKey(&old.PublicKey, &session.PublicKey) {
+		return nil
+	}
+	if old != nil && session.PublicKey.ExpiresAt.Before(old.PublicKey.ExpiresAt) ||
+		session.PublicKey.ExpiresAt.Before(time.Now()) {
+		c.SendDisconnect(chat.TranslateMsg("multiplayer.disconnect.expired_public_key"))
+		return nil
 	}
-	decorated := chatType.Decorate(chat.Text(string(message)), &decorator.Chat)
-	logger.Info(decorated.String())
+	if !verifyProfileKey(player.UUID, &session.PublicKey) {
+		g.log.Warn("Player sent invalid profile key", zap.String("name", player.Name))
+		c.SendDisconnect(chat.TranslateMsg("multiplayer.disconnect.invalid_public_key_signature"))
+		return nil
+	}
+	player.SetChatSession(&session)
 
+	action := client.NewPlayerInfoAction(client.PlayerInfoInitializeChat)
 	g.players.pingList.Range(func(c server.PlayerListClient, _ server.PlayerSample) {
-		c.(*client.Client).SendPlayerChat(
-			player.UUID,
-			0,
-			signature,
-			&sign.PackedMessageBody{
-				PlainMsg:  string(message),
-				Timestamp: timestamp,
-				Salt:      int64(salt),
-				LastSeen:  []sign.PackedSignature{},
-			},
-			nil,
-			&sign.FilterMask{Type: 0},
-			&chatType,
-		)
+		c.(*client.Client).SendPlayerInfoUpdate(action, []*world.Player{player})
 	})
 	return nil
 }
 
+func sameProfileKey(a, b *user.PublicKey) bool {
+	return a.ExpiresAt.Equal(b.ExpiresAt) && a.PubKey.Equal(b.PubKey) && bytes.Equal(a.Signature, b.Signature)
+}
+
 func existInvalidCharacter(msg string) bool {
 	for _, c := range msg {
 		if c == '§' || c < ' ' || c == '\x7F' {
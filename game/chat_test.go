@@ -0,0 +1,128 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package game
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/Tnze/go-mc/chat/sign"
+	"github.com/Tnze/go-mc/yggdrasil/user"
+	"github.com/go-mc/server/world"
+)
+
+// testChatSigner signs the messages of a player like the client does.
+type testChatSigner struct {
+	key     *rsa.PrivateKey
+	player  *world.Player
+	session *sign.Session
+}
+
+func newTestChatSigner(key *rsa.PrivateKey) *testChatSigner {
+	s := &testChatSigner{
+		key:    key,
+		player: &world.Player{UUID: uuid.New()},
+		session: &sign.Session{
+			SessionID: uuid.New(),
+			PublicKey: user.PublicKey{ExpiresAt: time.Now().Add(time.Hour), PubKey: &key.PublicKey},
+		},
+	}
+	s.player.SetChatSession(s.session)
+	return s
+}
+
+// message returns a message signed with the index in the chain of the player.
+func (s *testChatSigner) message(t *testing.T, index int, text string) *sign.Message {
+	msg := &sign.Message{
+		Prev:        sign.Prev{Index: index, Sender: s.player.UUID, Session: s.session.SessionID},
+		MessageBody: &sign.MessageBody{PlainMsg: text, Timestamp: time.Now(), Salt: int64(index)},
+	}
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, chatMessageHash(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.Signature = new(sign.Signature)
+	copy(msg.Signature[:], signature)
+	// the link is filled by the server
+	msg.Prev = sign.Prev{}
+	return msg
+}
+
+func TestGlobalChat_verifyChain(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type step struct {
+		index          int
+		wantReason     string
+		wantDisconnect bool
+	}
+	for _, tt := range []struct {
+		name  string
+		steps []step
+	}{
+		{"in order", []step{{0, "", false}, {1, "", false}, {2, "", false}}},
+		{"skipped", []step{{0, "", false}, {2, "chat.disabled.invalid_signature", true}}},
+		{"replayed", []step{{0, "", false}, {1, "", false}, {1, "chat.disabled.invalid_signature", true}}},
+		{"broken", []step{{1, "chat.disabled.invalid_signature", true}, {0, "chat.disabled.chain_broken", false}}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &globalChat{log: zap.NewNop()}
+			s := newTestChatSigner(key)
+			for i, step := range tt.steps {
+				msg := s.message(t, step.index, "hello")
+				reason, disconnect := g.verify(s.player, msg)
+				var gotReason string
+				if reason != nil {
+					gotReason = reason.Translate
+				}
+				if gotReason != step.wantReason || disconnect != step.wantDisconnect {
+					t.Fatalf("message %d with index %d: got %q %v, want %q %v",
+						i, step.index, gotReason, disconnect, step.wantReason, step.wantDisconnect)
+				}
+				if reason == nil && (msg.Prev.Index != step.index || msg.Prev.Sender != s.player.UUID) {
+					t.Errorf("message %d is linked to %v", i, msg.Prev)
+				}
+			}
+		})
+	}
+}
+
+func TestGlobalChat_verifyNewSession(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &globalChat{log: zap.NewNop()}
+	s := newTestChatSigner(key)
+	if reason, _ := g.verify(s.player, s.message(t, 1, "hello")); reason == nil {
+		t.Fatal("message out of order is accepted")
+	}
+	// a new session starts a new chain from index 0
+	s.session = &sign.Session{SessionID: uuid.New(), PublicKey: s.session.PublicKey}
+	s.player.SetChatSession(s.session)
+	if reason, _ := g.verify(s.player, s.message(t, 0, "hello")); reason != nil {
+		t.Errorf("message of the new session is rejected: %v", reason)
+	}
+}
@@ -0,0 +1,612 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package game
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	"go.uber.org/zap"
+
+	"github.com/Tnze/go-mc/chat"
+	"github.com/Tnze/go-mc/chat/sign"
+	"github.com/Tnze/go-mc/data/packetid"
+	pk "github.com/Tnze/go-mc/net/packet"
+	"github.com/Tnze/go-mc/server"
+	"github.com/go-mc/server/client"
+)
+
+// CommandSource is the one who executes a command, the results and errors are sent back to it.
+type CommandSource interface {
+	Name() string
+	SendMessage(msg chat.Message)
+	// PermissionLevel limits the commands can be used by the source.
+	PermissionLevel() int32
+}
+
+// playerSource is the CommandSource of the commands sent by players.
+type playerSource struct {
+	*client.Client
+	// command is the signing information of the executing command, nil if the source isn't executing a command.
+	command *signedCommand
+}
+
+// signedCommand is a command sent by a player, the message arguments of which are signed like chat messages.
+type signedCommand struct {
+	timestamp time.Time
+	salt      int64
+	// signatures are removed when the arguments are verified by globalChat.commandMessage.
+	signatures map[string]*sign.Signature
+	lastSeen   []*sign.Signature
+}
+
+// argumentSignature is the signature of a message argument in the ServerboundChatCommand packet.
+type argumentSignature struct {
+	name      string
+	signature sign.Signature
+}
+
+func (a *argumentSignature) ReadFrom(r io.Reader) (int64, error) {
+	return pk.Tuple{(*pk.String)(&a.name), &a.signature}.ReadFrom(r)
+}
+
+// maxArgumentSignatures is the max number of the signed arguments of a command, same as vanilla.
+const maxArgumentSignatures = 8
+
+// argumentSignatures is the array of argumentSignature, the length is checked before allocating.
+type argumentSignatures []argumentSignature
+
+func (s *argumentSignatures) ReadFrom(r io.Reader) (int64, error) {
+	var count pk.VarInt
+	n, err := count.ReadFrom(r)
+	if err != nil {
+		return n, err
+	}
+	if count < 0 || count > maxArgumentSignatures {
+		return n, fmt.Errorf("invalid number of argument signatures: %d", count)
+	}
+	*s = make(argumentSignatures, count)
+	for i := range *s {
+		n1, err := (*s)[i].ReadFrom(r)
+		n += n1
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (s playerSource) Name() string                 { return s.GetPlayer().Name }
+func (s playerSource) SendMessage(msg chat.Message) { s.SendSystemChat(msg, false) }
+func (s playerSource) PermissionLevel() int32       { return s.GetPlayer().PermissionLevel() }
+
+// CommandHandler runs the command. A CommandError is sent to the source as it is,
+// and any other error is logged and reported as a failed command.
+type CommandHandler func(ctx *CommandContext) error
+
+// SuggestionProvider returns the candidates of an argument, which the player is typing with the prefix.
+type SuggestionProvider func(ctx *CommandContext, prefix string) []string
+
+// CommandError is an error shown to the source of a command.
+type CommandError struct {
+	Message chat.Message
+}
+
+func (e *CommandError) Error() string { return e.Message.ClearString() }
+
+func commandError(key string, with ...chat.Message) *CommandError {
+	return &CommandError{Message: chat.TranslateMsg(key, with...)}
+}
+
+// kinds of CommandNode, the values are used in the flags of the Commands packet.
+const (
+	nodeRoot = iota
+	nodeLiteral
+	nodeArgument
+)
+
+// CommandNode is a node of the Brigadier command tree.
+// A command is parsed from the root to the leaves, each literal or argument node matches a word of the input.
+type CommandNode struct {
+	kind     byte
+	name     string
+	argument ArgumentType
+	children []*CommandNode
+	run      CommandHandler
+	suggest  SuggestionProvider
+	// level is the permission level required to use the node.
+	level int32
+}
+
+// Literal creates a node matches the name.
+func Literal(name string) *CommandNode {
+	return &CommandNode{kind: nodeLiteral, name: name}
+}
+
+// Argument creates a node parses the input with the ArgumentType, and the value can be got by the name in the CommandContext.
+func Argument(name string, typ ArgumentType) *CommandNode {
+	return &CommandNode{kind: nodeArgument, name: name, argument: typ}
+}
+
+// Then adds the children of the node. Children with the same name are merged.
+func (n *CommandNode) Then(children ...*CommandNode) *CommandNode {
+	for _, child := range children {
+		n.addChild(child)
+	}
+	return n
+}
+
+// Executes makes the command ends at the node executable.
+func (n *CommandNode) Executes(handler CommandHandler) *CommandNode {
+	n.run = handler
+	return n
+}
+
+// Suggests sets the suggestions of an argument node, which are asked by clients when the player is typing.
+func (n *CommandNode) Suggests(provider SuggestionProvider) *CommandNode {
+	n.suggest = provider
+	return n
+}
+
+// Requires makes the node and its children only available to the sources with the permission level.
+func (n *CommandNode) Requires(level int32) *CommandNode {
+	n.level = level
+	return n
+}
+
+func (n *CommandNode) canUse(src CommandSource) bool {
+	return src.PermissionLevel() >= n.level
+}
+
+func (n *CommandNode) addChild(child *CommandNode) {
+	for _, c := range n.children {
+		if c.kind == child.kind && c.name == child.name {
+			if child.run != nil {
+				c.run = child.run
+			}
+			if child.suggest != nil {
+				c.suggest = child.suggest
+			}
+			for _, grandchild := range child.children {
+				c.addChild(grandchild)
+			}
+			return
+		}
+	}
+	n.children = append(n.children, child)
+	// literals are matched before arguments
+	sort.SliceStable(n.children, func(i, j int) bool {
+		return n.children[i].kind == nodeLiteral && n.children[j].kind != nodeLiteral
+	})
+}
+
+// match reads the word of the node from r, the value is nil for literals.
+func (n *CommandNode) match(r *CommandReader) (any, error) {
+	if n.kind == nodeLiteral {
+		start := r.Cursor()
+		if word := r.ReadWord(); word != n.name {
+			r.SetCursor(start)
+			return nil, commandError("command.unknown.argument")
+		}
+		return nil, nil
+	}
+	return n.argument.Parse(r)
+}
+
+// CommandContext is passed to the CommandHandler, contains the source and the arguments of the command.
+type CommandContext struct {
+	Game   *Game
+	Source CommandSource
+	// Input is the command without the leading slash.
+	Input string
+	args  map[string]any
+}
+
+// Arg returns the parsed value of the argument, nil if the argument doesn't exist.
+func (ctx *CommandContext) Arg(name string) any { return ctx.args[name] }
+
+// HasArg reports whether the argument exists in the command, which is useful for optional arguments.
+func (ctx *CommandContext) HasArg(name string) bool {
+	_, ok := ctx.args[name]
+	return ok
+}
+
+func (ctx *CommandContext) String(name string) string {
+	v, _ := ctx.args[name].(string)
+	return v
+}
+
+func (ctx *CommandContext) Int(name string) int32 {
+	v, _ := ctx.args[name].(int32)
+	return v
+}
+
+func (ctx *CommandContext) Double(name string) float64 {
+	v, _ := ctx.args[name].(float64)
+	return v
+}
+
+func (ctx *CommandContext) Bool(name string) bool {
+	v, _ := ctx.args[name].(bool)
+	return v
+}
+
+// Player returns the client of the source, or false if the command is not sent by a player.
+func (ctx *CommandContext) Player() (*client.Client, bool) {
+	s, ok := ctx.Source.(playerSource)
+	return s.Client, ok
+}
+
+func (ctx *CommandContext) withArg(name string, value any) *CommandContext {
+	args := make(map[string]any, len(ctx.args)+1)
+	for k, v := range ctx.args {
+		args[k] = v
+	}
+	args[name] = value
+	ctx2 := *ctx
+	ctx2.args = args
+	return &ctx2
+}
+
+// CommandDispatcher parses and executes the commands, and describes all commands to the clients.
+type CommandDispatcher struct {
+	log  *zap.Logger
+	game *Game
+
+	lock sync.RWMutex
+	root CommandNode
+}
+
+func newCommandDispatcher(log *zap.Logger, g *Game) *CommandDispatcher {
+	return &CommandDispatcher{log: log, game: g, root: CommandNode{kind: nodeRoot}}
+}
+
+// Register adds commands to the root of the tree. Commands with the same name are merged.
+func (d *CommandDispatcher) Register(commands ...*CommandNode) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.root.Then(commands...)
+}
+
+// Execute parses the command and runs it. The results and errors are all sent to the source.
+func (d *CommandDispatcher) Execute(src CommandSource, input string) {
+	r := CommandReader{input: input}
+	ctx := &CommandContext{Game: d.game, Source: src, Input: input}
+	// the lock is not held while running the command, so the handler is able to register commands.
+	d.lock.RLock()
+	node, ctx, err := d.parse(&d.root, r, ctx)
+	d.lock.RUnlock()
+	if err == nil && node.run == nil {
+		err = &parseError{CommandError: commandError("command.unknown.command"), cursor: len(input)}
+	}
+	var pe *parseError
+	if errors.As(err, &pe) {
+		src.SendMessage(pe.Message.SetColor(chat.Red))
+		src.SendMessage(commandErrorContext(input, pe.cursor))
+		return
+	}
+
+	err = node.run(ctx)
+	var ce *CommandError
+	switch {
+	case err == nil:
+	case errors.As(err, &ce):
+		src.SendMessage(ce.Message.SetColor(chat.Red))
+	default:
+		d.log.Error("Command execution error",
+			zap.String("source", src.Name()),
+			zap.String("command", input),
+			zap.Error(err),
+		)
+		src.SendMessage(chat.TranslateMsg("command.failed").SetColor(chat.Red))
+	}
+}
+
+// parseError is a CommandError with the position where the parsing fails.
+type parseError struct {
+	*CommandError
+	cursor int
+}
+
+// parse matches the input after the cursor of r with the children of node, and returns the node at the end of the input.
+// If more than one child matches, the first one which can parse the whole input is used.
+func (d *CommandDispatcher) parse(node *CommandNode, r CommandReader, ctx *CommandContext) (*CommandNode, *CommandContext, error) {
+	if !r.CanRead() {
+		return node, ctx, nil
+	}
+	var errRet *parseError
+	for _, child := range node.children {
+		if !child.canUse(ctx.Source) {
+			continue
+		}
+		cr := r
+		value, err := child.match(&cr)
+		if err == nil && cr.CanRead() && cr.Peek() != ' ' {
+			err = commandError("command.expected.separator")
+		}
+		if err != nil {
+			var ce *CommandError
+			if node.kind == nodeRoot {
+				ce = commandError("command.unknown.command")
+			} else if !errors.As(err, &ce) {
+				ce = &CommandError{Message: chat.Text(err.Error())}
+			}
+			// report the error of the deepest node
+			if errRet == nil || r.Cursor() > errRet.cursor {
+				errRet = &parseError{CommandError: ce, cursor: r.Cursor()}
+			}
+			continue
+		}
+		childCtx := ctx
+		if child.kind == nodeArgument {
+			childCtx = ctx.withArg(child.name, value)
+		}
+		if cr.CanRead() {
+			cr.Skip() // the separator
+		}
+		last, lastCtx, err := d.parse(child, cr, childCtx)
+		if err != nil {
+			var pe *parseError
+			if errors.As(err, &pe) && (errRet == nil || pe.cursor > errRet.cursor) {
+				errRet = pe
+			}
+			continue
+		}
+		return last, lastCtx, nil
+	}
+	if errRet == nil {
+		// the node has no children, but there are more words
+		errRet = &parseError{CommandError: commandError("command.unknown.argument"), cursor: r.Cursor()}
+	}
+	return nil, nil, errRet
+}
+
+// commandErrorContext shows the position of the error in the command like vanilla does.
+func commandErrorContext(input string, cursor int) chat.Message {
+	msg := chat.Text("")
+	msg.Color = chat.Gray
+	msg.ClickEvent = chat.SuggestCommand("/" + input)
+	if cursor > 10 {
+		msg = msg.Append(chat.Text("..."))
+	}
+	start := cursor - 10
+	if start < 0 {
+		start = 0
+	}
+	msg = msg.Append(chat.Text(input[start:cursor]))
+	if cursor < len(input) {
+		wrong := chat.Text(input[cursor:])
+		wrong.Color, wrong.UnderLined = chat.Red, true
+		msg = msg.Append(wrong)
+	}
+	here := chat.TranslateMsg("command.context.here")
+	here.Color, here.Italic = chat.Red, true
+	return msg.Append(here)
+}
+
+// Suggest returns the candidates of the last word in the input, and where the word starts.
+func (d *CommandDispatcher) Suggest(src CommandSource, input string) (start int, matches []string) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	start = len(input)
+	ctx := &CommandContext{Game: d.game, Source: src, Input: input}
+	d.suggest(&d.root, CommandReader{input: input}, ctx, &start, &matches)
+	sort.Strings(matches)
+	return
+}
+
+func (d *CommandDispatcher) suggest(node *CommandNode, r CommandReader, ctx *CommandContext, start *int, matches *[]string) {
+	remaining := r.Remaining()
+	for _, child := range node.children {
+		if !child.canUse(ctx.Source) {
+			continue
+		}
+		// the child is the word being typed
+		if !strings.ContainsRune(remaining, ' ') || isGreedy(child) {
+			var candidates []string
+			switch {
+			case child.kind == nodeLiteral:
+				candidates = []string{child.name}
+			case child.suggest != nil:
+				candidates = child.suggest(ctx, remaining)
+			default:
+				if s, ok := child.argument.(argumentSuggester); ok {
+					candidates = s.suggest(ctx, remaining)
+				}
+			}
+			for _, v := range candidates {
+				if strings.HasPrefix(strings.ToLower(v), strings.ToLower(remaining)) {
+					if r.Cursor() > *start {
+						continue
+					}
+					if r.Cursor() < *start {
+						*start, *matches = r.Cursor(), nil
+					}
+					*matches = append(*matches, v)
+				}
+			}
+		}
+		// the child has been typed, suggest its children
+		cr := r
+		value, err := child.match(&cr)
+		if err != nil || !cr.CanRead() || cr.Peek() != ' ' {
+			continue
+		}
+		cr.Skip()
+		childCtx := ctx
+		if child.kind == nodeArgument {
+			childCtx = ctx.withArg(child.name, value)
+		}
+		d.suggest(child, cr, childCtx, start, matches)
+	}
+}
+
+// commandTree is the commands available to the source, in the format of the Commands packet.
+type commandTree struct {
+	d   *CommandDispatcher
+	src CommandSource
+}
+
+func (t commandTree) WriteTo(w io.Writer) (int64, error) {
+	t.d.lock.RLock()
+	defer t.d.lock.RUnlock()
+
+	// the nodes are indexed in breadth-first order, the root is the first one.
+	nodes := []*CommandNode{&t.d.root}
+	indices := map[*CommandNode]int32{&t.d.root: 0}
+	for i := 0; i < len(nodes); i++ {
+		for _, child := range nodes[i].children {
+			if !child.canUse(t.src) {
+				continue
+			}
+			if _, ok := indices[child]; !ok {
+				indices[child] = int32(len(nodes))
+				nodes = append(nodes, child)
+			}
+		}
+	}
+	var n int64
+	n1, err := pk.VarInt(len(nodes)).WriteTo(w)
+	n += n1
+	if err != nil {
+		return n, err
+	}
+	for _, node := range nodes {
+		n1, err = node.writeTo(w, indices)
+		n += n1
+		if err != nil {
+			return n, err
+		}
+	}
+	n1, err = pk.VarInt(0).WriteTo(w) // root index
+	return n + n1, err
+}
+
+// flags of the nodes in the Commands packet
+const (
+	nodeExecutable     = 0x04
+	nodeHasSuggestions = 0x10
+)
+
+func (n *CommandNode) writeTo(w io.Writer, indices map[*CommandNode]int32) (int64, error) {
+	flags := n.kind
+	if n.run != nil {
+		flags |= nodeExecutable
+	}
+	if n.suggest != nil {
+		flags |= nodeHasSuggestions
+	}
+	children := make([]pk.VarInt, 0, len(n.children))
+	for _, child := range n.children {
+		// children not in indices are not available to the player
+		if i, ok := indices[child]; ok {
+			children = append(children, pk.VarInt(i))
+		}
+	}
+	return pk.Tuple{
+		pk.Byte(flags),
+		pk.Array(children),
+		pk.Opt{Has: n.kind != nodeRoot, Field: pk.String(n.name)},
+		pk.Opt{Has: n.kind == nodeArgument, Field: n.argument},
+		// the client asks the server for suggestions while typing.
+		pk.Opt{Has: n.suggest != nil, Field: pk.Identifier("minecraft:ask_server")},
+	}.WriteTo(w)
+}
+
+// Commands returns the dispatcher of the commands, which is shared by players and the server console.
+func (g *Game) Commands() *CommandDispatcher { return g.commands }
+
+// RegisterCommands adds commands and sends the updated command tree to online players.
+func (g *Game) RegisterCommands(commands ...*CommandNode) {
+	g.commands.Register(commands...)
+	g.pingList.Range(func(c server.PlayerListClient, _ server.PlayerSample) {
+		g.sendCommands(c.(*client.Client))
+	})
+}
+
+func (g *Game) sendCommands(c *client.Client) {
+	c.SendPacket(packetid.ClientboundCommands, commandTree{d: g.commands, src: playerSource{Client: c}})
+}
+
+func (g *Game) handleChatCommand(p pk.Packet, c *client.Client) error {
+	var (
+		command    pk.String
+		timestamp  pk.Long
+		salt       pk.Long
+		signatures argumentSignatures
+		lastSeen   = sign.HistoryUpdate{Acknowledged: pk.NewFixedBitSet(client.LastSeenCount)}
+	)
+	if err := p.Scan(&command, &timestamp, &salt, &signatures, &lastSeen); err != nil {
+		return err
+	}
+	if existInvalidCharacter(string(command)) {
+		c.SendDisconnect(chat.TranslateMsg("multiplayer.disconnect.illegal_characters"))
+		return nil
+	}
+	signed := &signedCommand{
+		timestamp:  time.UnixMilli(int64(timestamp)),
+		salt:       int64(salt),
+		signatures: make(map[string]*sign.Signature, len(signatures)),
+	}
+	var ok bool
+	if signed.lastSeen, ok = g.globalChat.receive(c, signed.timestamp, lastSeen, true); !ok {
+		return nil
+	}
+	for i := range signatures {
+		signed.signatures[signatures[i].name] = &signatures[i].signature
+	}
+	g.log.Info("Player issued command",
+		zap.String("name", c.GetPlayer().Name),
+		zap.String("command", string(command)),
+	)
+	g.commands.Execute(playerSource{Client: c, command: signed}, string(command))
+	// the signed arguments not shown as chat messages are still counted by the chain of the player
+	if c.GetPlayer().ChatSession() != nil {
+		for range signed.signatures {
+			c.GetPlayer().AdvanceChatChain()
+		}
+	}
+	return nil
+}
+
+func (g *Game) handleCommandSuggestion(p pk.Packet, c *client.Client) error {
+	var (
+		id   pk.VarInt
+		text pk.String
+	)
+	if err := p.Scan(&id, &text); err != nil {
+		return err
+	}
+	input := strings.TrimPrefix(string(text), "/")
+	offset := len(text) - len(input)
+	start, matches := g.commands.Suggest(playerSource{Client: c}, input)
+	// the client counts the range in UTF-16 code units
+	c.SendCommandSuggestions(int32(id), utf16Len(string(text[:start+offset])), utf16Len(input[start:]), matches)
+	return nil
+}
+
+// utf16Len returns the length of the string in UTF-16 code units.
+func utf16Len(s string) int32 {
+	return int32(len(utf16.Encode([]rune(s))))
+}
@@ -0,0 +1,459 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package game
+
+import (
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/Tnze/go-mc/chat"
+	pk "github.com/Tnze/go-mc/net/packet"
+	"github.com/Tnze/go-mc/server"
+	"github.com/go-mc/server/client"
+	"github.com/go-mc/server/world"
+)
+
+// CommandReader reads the words of a command.
+type CommandReader struct {
+	input  string
+	cursor int
+}
+
+func (r *CommandReader) Cursor() int          { return r.cursor }
+func (r *CommandReader) SetCursor(cursor int) { r.cursor = cursor }
+func (r *CommandReader) Remaining() string    { return r.input[r.cursor:] }
+func (r *CommandReader) CanRead() bool        { return r.cursor < len(r.input) }
+func (r *CommandReader) Peek() byte           { return r.input[r.cursor] }
+func (r *CommandReader) Skip()                { r.cursor++ }
+
+// ReadWord reads until the next space or the end of the input.
+func (r *CommandReader) ReadWord() string {
+	start := r.cursor
+	if i := strings.IndexByte(r.Remaining(), ' '); i >= 0 {
+		r.cursor += i
+	} else {
+		r.cursor = len(r.input)
+	}
+	return r.input[start:r.cursor]
+}
+
+// ReadString reads a word, or a phrase in double or single quotes, where the quote and backslash are escaped by a backslash.
+func (r *CommandReader) ReadString() (string, error) {
+	if !r.CanRead() {
+		return "", nil
+	}
+	quote := r.Peek()
+	if quote != '"' && quote != '\'' {
+		return r.ReadWord(), nil
+	}
+	r.Skip()
+	var sb strings.Builder
+	for escaped := false; r.CanRead(); r.Skip() {
+		c := r.Peek()
+		switch {
+		case escaped:
+			if c != quote && c != '\\' {
+				return "", commandError("parsing.quote.escape", chat.Text(string(c)), chat.Text(string(quote)))
+			}
+			sb.WriteByte(c)
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == quote:
+			r.Skip()
+			return sb.String(), nil
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", commandError("parsing.quote.expected.end")
+}
+
+// ArgumentType parses the arguments of commands,
+// and writes the parser ID and its properties in the Commands packet, so the client can parse the command too.
+type ArgumentType interface {
+	Parse(r *CommandReader) (any, error)
+	pk.FieldEncoder
+}
+
+// argumentSuggester is implemented by the ArgumentType which provides the default suggestions.
+type argumentSuggester interface {
+	suggest(ctx *CommandContext, prefix string) []string
+}
+
+// IDs of the argument parsers in the Commands packet
+const (
+	parserBool        = 0
+	parserDouble      = 2
+	parserInteger     = 3
+	parserString      = 5
+	parserEntity      = 6
+	parserGameProfile = 7
+	parserVec3        = 10
+	parserMessage     = 18
+	parserGamemode    = 39
+)
+
+// BoolArgument parses "true" or "false".
+type BoolArgument struct{}
+
+func (BoolArgument) Parse(r *CommandReader) (any, error) {
+	switch word := r.ReadWord(); word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "":
+		return nil, commandError("parsing.bool.expected")
+	default:
+		return nil, commandError("parsing.bool.invalid", chat.Text(word))
+	}
+}
+
+func (BoolArgument) WriteTo(w io.Writer) (int64, error) { return pk.VarInt(parserBool).WriteTo(w) }
+
+func (BoolArgument) suggest(*CommandContext, string) []string { return []string{"true", "false"} }
+
+// IntegerArgument parses an int32 in the range [Min, Max].
+type IntegerArgument struct{ Min, Max int32 }
+
+// Integer returns an IntegerArgument without limits.
+func Integer() IntegerArgument { return IntegerArgument{Min: math.MinInt32, Max: math.MaxInt32} }
+
+func (a IntegerArgument) Parse(r *CommandReader) (any, error) {
+	word := r.ReadWord()
+	if word == "" {
+		return nil, commandError("parsing.int.expected")
+	}
+	v, err := strconv.ParseInt(word, 10, 32)
+	if err != nil {
+		return nil, commandError("parsing.int.invalid", chat.Text(word))
+	}
+	if int32(v) < a.Min {
+		return nil, commandError("argument.integer.low", chat.Text(strconv.Itoa(int(a.Min))), chat.Text(word))
+	}
+	if int32(v) > a.Max {
+		return nil, commandError("argument.integer.big", chat.Text(strconv.Itoa(int(a.Max))), chat.Text(word))
+	}
+	return int32(v), nil
+}
+
+func (a IntegerArgument) WriteTo(w io.Writer) (int64, error) {
+	var flags pk.Byte
+	if a.Min != math.MinInt32 {
+		flags |= 0x01
+	}
+	if a.Max != math.MaxInt32 {
+		flags |= 0x02
+	}
+	return pk.Tuple{
+		pk.VarInt(parserInteger),
+		flags,
+		pk.Opt{Has: flags&0x01 != 0, Field: pk.Int(a.Min)},
+		pk.Opt{Has: flags&0x02 != 0, Field: pk.Int(a.Max)},
+	}.WriteTo(w)
+}
+
+// DoubleArgument parses a float64 in the range [Min, Max].
+type DoubleArgument struct{ Min, Max float64 }
+
+// Double returns a DoubleArgument without limits.
+func Double() DoubleArgument { return DoubleArgument{Min: -math.MaxFloat64, Max: math.MaxFloat64} }
+
+func (a DoubleArgument) Parse(r *CommandReader) (any, error) {
+	word := r.ReadWord()
+	if word == "" {
+		return nil, commandError("parsing.double.expected")
+	}
+	v, err := strconv.ParseFloat(word, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil, commandError("parsing.double.invalid", chat.Text(word))
+	}
+	if v < a.Min {
+		return nil, commandError("argument.double.low", chat.Text(strconv.FormatFloat(a.Min, 'g', -1, 64)), chat.Text(word))
+	}
+	if v > a.Max {
+		return nil, commandError("argument.double.big", chat.Text(strconv.FormatFloat(a.Max, 'g', -1, 64)), chat.Text(word))
+	}
+	return v, nil
+}
+
+func (a DoubleArgument) WriteTo(w io.Writer) (int64, error) {
+	var flags pk.Byte
+	if a.Min != -math.MaxFloat64 {
+		flags |= 0x01
+	}
+	if a.Max != math.MaxFloat64 {
+		flags |= 0x02
+	}
+	return pk.Tuple{
+		pk.VarInt(parserDouble),
+		flags,
+		pk.Opt{Has: flags&0x01 != 0, Field: pk.Double(a.Min)},
+		pk.Opt{Has: flags&0x02 != 0, Field: pk.Double(a.Max)},
+	}.WriteTo(w)
+}
+
+// StringArgument parses a string, the value is one of SingleWord, QuotablePhrase and GreedyPhrase.
+type StringArgument int32
+
+const (
+	// SingleWord reads until the next space.
+	SingleWord StringArgument = iota
+	// QuotablePhrase reads a word, or a quoted phrase which may contain spaces.
+	QuotablePhrase
+	// GreedyPhrase reads all the remaining input.
+	GreedyPhrase
+)
+
+func (a StringArgument) Parse(r *CommandReader) (any, error) {
+	switch a {
+	case SingleWord:
+		return r.ReadWord(), nil
+	case QuotablePhrase:
+		return r.ReadString()
+	default:
+		s := r.Remaining()
+		r.SetCursor(len(r.input))
+		return s, nil
+	}
+}
+
+func (a StringArgument) WriteTo(w io.Writer) (int64, error) {
+	return pk.Tuple{pk.VarInt(parserString), pk.VarInt(a)}.WriteTo(w)
+}
+
+// MessageArgument reads all the remaining input as a chat message.
+type MessageArgument struct{}
+
+func (MessageArgument) Parse(r *CommandReader) (any, error) { return GreedyPhrase.Parse(r) }
+
+func (MessageArgument) WriteTo(w io.Writer) (int64, error) {
+	return pk.VarInt(parserMessage).WriteTo(w)
+}
+
+func isGreedy(n *CommandNode) bool {
+	switch n.argument.(type) {
+	case MessageArgument:
+		return true
+	case StringArgument:
+		return n.argument == GreedyPhrase
+	}
+	return false
+}
+
+// PlayerArgument parses a player name or one of the selectors @a, @p, @r and @s.
+// Selector arguments like @a[distance=..5] are not supported.
+type PlayerArgument struct {
+	// Single is set if the argument selects only one player.
+	Single bool
+}
+
+// playerSelector is the value parsed by PlayerArgument, it's resolved when the command is executed.
+type playerSelector string
+
+func (a PlayerArgument) Parse(r *CommandReader) (any, error) {
+	word := r.ReadWord()
+	switch {
+	case word == "":
+		return nil, commandError("argument.player.unknown")
+	case word == "@e":
+		return nil, commandError("argument.player.entities")
+	case word == "@a" && a.Single:
+		return nil, commandError("argument.player.toomany")
+	case strings.HasPrefix(word, "@"):
+		if len(word) != 2 || !strings.Contains("aprs", word[1:]) {
+			return nil, commandError("argument.entity.selector.unknown", chat.Text(word))
+		}
+	}
+	return playerSelector(word), nil
+}
+
+func (a PlayerArgument) WriteTo(w io.Writer) (int64, error) {
+	flags := pk.Byte(0x02) // players only
+	if a.Single {
+		flags |= 0x01
+	}
+	return pk.Tuple{pk.VarInt(parserEntity), flags}.WriteTo(w)
+}
+
+// Players returns the clients selected by the PlayerArgument.
+func (ctx *CommandContext) Players(name string) ([]*client.Client, error) {
+	selector, _ := ctx.args[name].(playerSelector)
+	self, isPlayer := ctx.Player()
+	online := ctx.Game.clients()
+	var selected []*client.Client
+	switch selector {
+	case "@a":
+		selected = online
+	case "@s":
+		if isPlayer {
+			selected = []*client.Client{self}
+		}
+	case "@p":
+		if isPlayer {
+			selected = []*client.Client{self}
+		} else if len(online) > 0 {
+			selected = online[:1]
+		}
+	case "@r":
+		if len(online) > 0 {
+			selected = []*client.Client{online[rand.Intn(len(online))]}
+		}
+	default:
+		for _, c := range online {
+			if strings.EqualFold(c.GetPlayer().Name, string(selector)) {
+				selected = []*client.Client{c}
+				break
+			}
+		}
+	}
+	if len(selected) == 0 {
+		return nil, commandError("argument.entity.notfound.player")
+	}
+	return selected, nil
+}
+
+// GameProfileArgument parses a player name or a selector like PlayerArgument, but the player doesn't need to be online.
+type GameProfileArgument struct{}
+
+func (GameProfileArgument) Parse(r *CommandReader) (any, error) { return PlayerArgument{}.Parse(r) }
+
+func (GameProfileArgument) WriteTo(w io.Writer) (int64, error) {
+	return pk.VarInt(parserGameProfile).WriteTo(w)
+}
+
+// GameProfiles returns the profiles selected by the GameProfileArgument.
+// A name of an offline player is resolved by Game.LookupProfile.
+func (ctx *CommandContext) GameProfiles(name string) ([]server.GameProfile, error) {
+	selector, _ := ctx.args[name].(playerSelector)
+	if !strings.HasPrefix(string(selector), "@") {
+		for _, c := range ctx.Game.clients() {
+			if p := c.GetPlayer(); strings.EqualFold(p.Name, string(selector)) {
+				return []server.GameProfile{{ID: p.UUID, Name: p.Name}}, nil
+			}
+		}
+		profile, err := ctx.Game.LookupProfile(string(selector))
+		if err != nil {
+			return nil, err
+		}
+		return []server.GameProfile{profile}, nil
+	}
+	clients, err := ctx.Players(name)
+	if err != nil {
+		return nil, err
+	}
+	profiles := make([]server.GameProfile, len(clients))
+	for i, c := range clients {
+		p := c.GetPlayer()
+		profiles[i] = server.GameProfile{ID: p.UUID, Name: p.Name}
+	}
+	return profiles, nil
+}
+
+// GamemodeArgument parses the name of a gamemode, the value is the ID of the gamemode.
+type GamemodeArgument struct{}
+
+var gamemodeNames = [...]string{"survival", "creative", "adventure", "spectator"}
+
+func (GamemodeArgument) Parse(r *CommandReader) (any, error) {
+	word := r.ReadWord()
+	for i, name := range gamemodeNames {
+		if word == name {
+			return int32(i), nil
+		}
+	}
+	return nil, commandError("argument.gamemode.invalid", chat.Text(word))
+}
+
+func (GamemodeArgument) WriteTo(w io.Writer) (int64, error) {
+	return pk.VarInt(parserGamemode).WriteTo(w)
+}
+
+func (GamemodeArgument) suggest(*CommandContext, string) []string { return gamemodeNames[:] }
+
+// Vec3Argument parses a position of three coordinates. A coordinate prefixed with '~' is relative to the source.
+type Vec3Argument struct{}
+
+type coordinate struct {
+	value    float64
+	relative bool
+}
+
+// vec3Coordinates is the value parsed by Vec3Argument, it's resolved when the command is executed.
+type vec3Coordinates [3]coordinate
+
+func (Vec3Argument) Parse(r *CommandReader) (any, error) {
+	var v vec3Coordinates
+	for i := range v {
+		if i > 0 {
+			if !r.CanRead() || r.Peek() != ' ' {
+				return nil, commandError("argument.pos3d.incomplete")
+			}
+			r.Skip()
+		}
+		word := r.ReadWord()
+		if word == "" {
+			return nil, commandError("argument.pos3d.incomplete")
+		}
+		if strings.HasPrefix(word, "^") {
+			return nil, commandError("argument.pos.mixed")
+		}
+		if v[i].relative = strings.HasPrefix(word, "~"); v[i].relative {
+			word = word[1:]
+			if word == "" {
+				continue
+			}
+		}
+		f, err := strconv.ParseFloat(word, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, commandError("parsing.double.invalid", chat.Text(word))
+		}
+		// same as vanilla, integer x and z of absolute positions are moved to the center of the block.
+		if !v[i].relative && i != 1 && !strings.Contains(word, ".") {
+			f += 0.5
+		}
+		v[i].value = f
+	}
+	return v, nil
+}
+
+func (Vec3Argument) WriteTo(w io.Writer) (int64, error) { return pk.VarInt(parserVec3).WriteTo(w) }
+
+// Position returns the position parsed by the Vec3Argument.
+// Relative coordinates are based on the position of the player, or the spawn point if the source isn't a player.
+func (ctx *CommandContext) Position(name string) world.Position {
+	v, _ := ctx.args[name].(vec3Coordinates)
+	var base world.Position
+	if c, ok := ctx.Player(); ok {
+		base, _ = ctx.Game.playerPosition(c.GetPlayer())
+	} else {
+		spawn, _ := ctx.Game.overworld.SpawnPositionAndAngle()
+		base = world.Position{float64(spawn[0]), float64(spawn[1]), float64(spawn[2])}
+	}
+	var pos world.Position
+	for i, c := range v {
+		pos[i] = c.value
+		if c.relative {
+			pos[i] += base[i]
+		}
+	}
+	return pos
+}
@@ -0,0 +1,330 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package game
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Tnze/go-mc/chat"
+	"github.com/Tnze/go-mc/chat/sign"
+	pk "github.com/Tnze/go-mc/net/packet"
+)
+
+// testSource records the messages sent to it.
+type testSource struct {
+	level    int32
+	messages []chat.Message
+}
+
+func (s *testSource) Name() string                 { return "test" }
+func (s *testSource) SendMessage(msg chat.Message) { s.messages = append(s.messages, msg) }
+func (s *testSource) PermissionLevel() int32       { return s.level }
+
+// errorKey returns the translation key of the CommandError, or "" if err is nil.
+func errorKey(t *testing.T, err error) string {
+	t.Helper()
+	if err == nil {
+		return ""
+	}
+	ce, ok := err.(*CommandError)
+	if !ok {
+		t.Fatalf("%v is not a CommandError", err)
+	}
+	return ce.Message.Translate
+}
+
+func TestCommandReader_ReadString(t *testing.T) {
+	for _, tt := range []struct {
+		input, want string
+		wantErr     string
+		wantCursor  int
+	}{
+		{`word rest`, "word", "", 4},
+		{`"hello world" rest`, "hello world", "", 13},
+		{`'say "hi"'`, `say "hi"`, "", 10},
+		{`"a \"quoted\" \\ word"`, `a "quoted" \ word`, "", 22},
+		{`'it\'s'`, "it's", "", 7},
+		{`""`, "", "", 2},
+		{`"unterminated`, "", "parsing.quote.expected.end", 13},
+		{`"bad \n"`, "", "parsing.quote.escape", 6},
+	} {
+		r := CommandReader{input: tt.input}
+		got, err := r.ReadString()
+		if key := errorKey(t, err); key != tt.wantErr {
+			t.Errorf("ReadString(%s): got error %q, want %q", tt.input, key, tt.wantErr)
+			continue
+		}
+		if got != tt.want || r.Cursor() != tt.wantCursor {
+			t.Errorf("ReadString(%s) = %q at %d, want %q at %d", tt.input, got, r.Cursor(), tt.want, tt.wantCursor)
+		}
+	}
+}
+
+func TestArgumentTypes(t *testing.T) {
+	for _, tt := range []struct {
+		typ     ArgumentType
+		input   string
+		want    any
+		wantErr string
+	}{
+		{BoolArgument{}, "true", true, ""},
+		{BoolArgument{}, "yes", nil, "parsing.bool.invalid"},
+		{BoolArgument{}, "", nil, "parsing.bool.expected"},
+
+		{IntegerArgument{Min: 1, Max: 64}, "1", int32(1), ""},
+		{IntegerArgument{Min: 1, Max: 64}, "64", int32(64), ""},
+		{IntegerArgument{Min: 1, Max: 64}, "0", nil, "argument.integer.low"},
+		{IntegerArgument{Min: 1, Max: 64}, "65", nil, "argument.integer.big"},
+		{Integer(), "2147483648", nil, "parsing.int.invalid"},
+		{Integer(), "1.5", nil, "parsing.int.invalid"},
+		{Integer(), "", nil, "parsing.int.expected"},
+
+		{Double(), "-1.5", -1.5, ""},
+		{DoubleArgument{Min: 0, Max: 1}, "1.5", nil, "argument.double.big"},
+		{DoubleArgument{Min: 0, Max: 1}, "-0.5", nil, "argument.double.low"},
+		{Double(), "NaN", nil, "parsing.double.invalid"},
+		{Double(), "Inf", nil, "parsing.double.invalid"},
+
+		{SingleWord, "one two", "one", ""},
+		{QuotablePhrase, `"one two" three`, "one two", ""},
+		{GreedyPhrase, "one two", "one two", ""},
+		{MessageArgument{}, "hello world", "hello world", ""},
+
+		{PlayerArgument{}, "Steve", playerSelector("Steve"), ""},
+		{PlayerArgument{}, "@a", playerSelector("@a"), ""},
+		{PlayerArgument{Single: true}, "@p", playerSelector("@p"), ""},
+		{PlayerArgument{Single: true}, "@a", nil, "argument.player.toomany"},
+		{PlayerArgument{}, "@e", nil, "argument.player.entities"},
+		{PlayerArgument{}, "@x", nil, "argument.entity.selector.unknown"},
+		{PlayerArgument{}, "@as", nil, "argument.entity.selector.unknown"},
+		{PlayerArgument{}, "", nil, "argument.player.unknown"},
+		{GameProfileArgument{}, "Notch", playerSelector("Notch"), ""},
+
+		{GamemodeArgument{}, "creative", int32(1), ""},
+		{GamemodeArgument{}, "hardcore", nil, "argument.gamemode.invalid"},
+
+		{Vec3Argument{}, "1 2 3", vec3Coordinates{{value: 1.5}, {value: 2}, {value: 3.5}}, ""},
+		{Vec3Argument{}, "1.0 2.5 -3.25", vec3Coordinates{{value: 1}, {value: 2.5}, {value: -3.25}}, ""},
+		{Vec3Argument{}, "~ ~1 ~-1.5", vec3Coordinates{{relative: true}, {value: 1, relative: true}, {value: -1.5, relative: true}}, ""},
+		{Vec3Argument{}, "1 2", nil, "argument.pos3d.incomplete"},
+		{Vec3Argument{}, "^ ^ ^1", nil, "argument.pos.mixed"},
+		{Vec3Argument{}, "1 x 3", nil, "parsing.double.invalid"},
+	} {
+		r := CommandReader{input: tt.input}
+		got, err := tt.typ.Parse(&r)
+		if key := errorKey(t, err); key != tt.wantErr {
+			t.Errorf("%T.Parse(%q): got error %q, want %q", tt.typ, tt.input, key, tt.wantErr)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%T.Parse(%q) = %#v, want %#v", tt.typ, tt.input, got, tt.want)
+		}
+	}
+}
+
+// testCommands registers the commands used by the dispatcher tests,
+// the executed command and its arguments are written to *ran.
+func testCommands(ran *map[string]any) *CommandDispatcher {
+	record := func(ctx *CommandContext) error {
+		*ran = ctx.args
+		if *ran == nil {
+			*ran = map[string]any{}
+		}
+		return nil
+	}
+	d := newCommandDispatcher(zap.NewNop(), nil)
+	d.Register(
+		Literal("give").Then(
+			Argument("target", PlayerArgument{}).Then(
+				Argument("count", IntegerArgument{Min: 1, Max: 64}).Executes(record),
+			),
+		),
+		Literal("say").Then(Argument("message", MessageArgument{}).Executes(record)),
+		Literal("tell").Then(
+			Argument("text", QuotablePhrase).Then(
+				Argument("times", Integer()).Executes(record),
+			),
+		),
+		Literal("gamemode").Then(Argument("gamemode", GamemodeArgument{}).Executes(record)),
+		Literal("flag").Then(Argument("value", BoolArgument{}).Executes(record)),
+		Literal("stop").Requires(4).Executes(record),
+		Literal("op").Requires(3).Then(Argument("targets", GameProfileArgument{}).Executes(record)),
+	)
+	return d
+}
+
+func TestCommandDispatcher_Execute(t *testing.T) {
+	for _, tt := range []struct {
+		input    string
+		level    int32
+		wantArgs map[string]any
+		wantErr  string
+	}{
+		{"give Steve 5", 0, map[string]any{"target": playerSelector("Steve"), "count": int32(5)}, ""},
+		{"give @s 64", 0, map[string]any{"target": playerSelector("@s"), "count": int32(64)}, ""},
+		{"give Steve", 0, nil, "command.unknown.command"},
+		{"give Steve 5 extra", 0, nil, "command.unknown.argument"},
+		{"give Steve 65", 0, nil, "argument.integer.big"},
+		{"give @e 1", 0, nil, "argument.player.entities"},
+		{"give Steve 5x", 0, nil, "parsing.int.invalid"},
+		{"say hello  world", 0, map[string]any{"message": "hello  world"}, ""},
+		{`tell "hello world" 3`, 0, map[string]any{"text": "hello world", "times": int32(3)}, ""},
+		{`tell "hello world"3`, 0, nil, "command.expected.separator"},
+		{`tell "hello world 3`, 0, nil, "parsing.quote.expected.end"},
+		{"gamemode creative", 0, map[string]any{"gamemode": int32(1)}, ""},
+		{"flag maybe", 0, nil, "parsing.bool.invalid"},
+		{"unknown", 0, nil, "command.unknown.command"},
+		{"stop", 0, nil, "command.unknown.command"},
+		{"stop", 4, map[string]any{}, ""},
+		{"op Steve", 2, nil, "command.unknown.command"},
+		{"op Steve", 3, map[string]any{"targets": playerSelector("Steve")}, ""},
+	} {
+		var ran map[string]any
+		src := &testSource{level: tt.level}
+		testCommands(&ran).Execute(src, tt.input)
+		if tt.wantErr != "" {
+			if ran != nil {
+				t.Errorf("%q: executed with %v, want error %q", tt.input, ran, tt.wantErr)
+			} else if len(src.messages) == 0 || src.messages[0].Translate != tt.wantErr {
+				t.Errorf("%q: got messages %v, want error %q", tt.input, src.messages, tt.wantErr)
+			}
+			continue
+		}
+		if len(src.messages) != 0 {
+			t.Errorf("%q: got messages %v", tt.input, src.messages)
+		}
+		if !reflect.DeepEqual(ran, tt.wantArgs) {
+			t.Errorf("%q: executed with %v, want %v", tt.input, ran, tt.wantArgs)
+		}
+	}
+}
+
+func TestCommandDispatcher_Suggest(t *testing.T) {
+	for _, tt := range []struct {
+		input     string
+		level     int32
+		wantStart int
+		want      []string
+	}{
+		{"", 0, 0, []string{"flag", "gamemode", "give", "say", "tell"}},
+		{"", 4, 0, []string{"flag", "gamemode", "give", "op", "say", "stop", "tell"}},
+		{"g", 0, 0, []string{"gamemode", "give"}},
+		{"GA", 0, 0, []string{"gamemode"}},
+		{"st", 0, 2, nil},
+		{"gamemode ", 0, 9, []string{"adventure", "creative", "spectator", "survival"}},
+		{"gamemode s", 0, 9, []string{"spectator", "survival"}},
+		{"flag t", 0, 5, []string{"true"}},
+		{"flag true ", 0, 10, nil},
+		{"gamemode hardcore x", 0, 19, nil},
+	} {
+		d := testCommands(new(map[string]any))
+		start, got := d.Suggest(&testSource{level: tt.level}, tt.input)
+		if start != tt.wantStart || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Suggest(%q) = %d %q, want %d %q", tt.input, start, got, tt.wantStart, tt.want)
+		}
+	}
+}
+
+func TestCommandDispatcher_SuggestProvider(t *testing.T) {
+	d := newCommandDispatcher(zap.NewNop(), nil)
+	d.Register(Literal("warp").Then(
+		Argument("name", SingleWord).Suggests(func(ctx *CommandContext, prefix string) []string {
+			return []string{"spawn", "shop", "home"}
+		}),
+	))
+	start, got := d.Suggest(&testSource{}, "warp s")
+	if want := []string{"shop", "spawn"}; start != 5 || !reflect.DeepEqual(got, want) {
+		t.Errorf("got %d %q, want 5 %q", start, got, want)
+	}
+}
+
+func TestParseMuteDuration(t *testing.T) {
+	for _, tt := range []struct {
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"forever", 0, false},
+		{"30m", 30 * time.Minute, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"0d", 0, true},
+		{"-1d", 0, true},
+		{"-5m", 0, true},
+		{"0s", 0, true},
+		{"d", 0, true},
+		{"1.5d", 0, true},
+		{"soon", 0, true},
+		{"", 0, true},
+	} {
+		got, err := parseMuteDuration(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseMuteDuration(%q) = %v, %v, want %v, error %v", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestArgumentSignatures_ReadFrom(t *testing.T) {
+	signature := pk.Tuple{pk.String("message"), sign.Signature{}}
+	for _, tt := range []struct {
+		name    string
+		count   int32
+		fields  []any
+		wantLen int
+		wantErr bool
+	}{
+		{"empty", 0, nil, 0, false},
+		{"one", 1, []any{signature}, 1, false},
+		{"max", maxArgumentSignatures, []any{signature, signature, signature, signature, signature, signature, signature, signature}, 8, false},
+		{"negative", -1, nil, 0, true},
+		{"oversized", maxArgumentSignatures + 1, nil, 0, true},
+		{"huge", 1 << 30, nil, 0, true},
+		{"missing", 2, []any{signature}, 0, true},
+	} {
+		var buf bytes.Buffer
+		if _, err := append(pk.Tuple{pk.VarInt(tt.count)}, tt.fields...).WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		var got argumentSignatures
+		_, err := got.ReadFrom(&buf)
+		if (err != nil) != tt.wantErr || !tt.wantErr && len(got) != tt.wantLen {
+			t.Errorf("%s: got %d signatures, error %v", tt.name, len(got), err)
+		}
+	}
+}
+
+func TestUTF16Len(t *testing.T) {
+	for _, tt := range []struct {
+		input string
+		want  int32
+	}{
+		{"", 0},
+		{"tp ", 3},
+		{"msg 你好 ", 7},
+		{"say é", 5},
+		{"say 😀 ", 7},
+	} {
+		if got := utf16Len(tt.input); got != tt.want {
+			t.Errorf("utf16Len(%q) = %d, want %d", tt.input, got, tt.want)
+		}
+	}
+}
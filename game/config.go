@@ -31,9 +31,77 @@ type Config struct {
 	OnlineMode                  bool   `toml:"online-mode"`
 	LevelName                   string `toml:"level-name"`
 	EnforceSecureProfile        bool   `toml:"enforce-secure-profile"`
+	// WhiteList enables the whitelist when the server starts, it can be changed by the /whitelist command.
+	WhiteList bool `toml:"white-list"`
+	// EnforceWhitelist kicks the online players who aren't in the whitelist when it's turned on or reloaded.
+	EnforceWhitelist bool `toml:"enforce-whitelist"`
+	// OpPermissionLevel is the permission level given by the /op command, 4 if not set.
+	OpPermissionLevel int32 `toml:"op-permission-level"`
+	// ShutdownMessage is the reason shown to the players when the server stops.
+	ShutdownMessage string `toml:"shutdown-message"`
+	// AutoSaveInterval is how often the player data is saved, 5 minutes if not set.
+	AutoSaveInterval duration `toml:"autosave-interval"`
+
+	// ChatFormat overrides the decorations of the chat types, keyed by the names such as "minecraft:chat".
+	// The messages are decorated by the clients, so the signatures of them are kept.
+	ChatFormat map[string]ChatFormatConfig `toml:"chat-format"`
+
+	// Channels are the chat channels besides the global chat, keyed by the names used in the /channel command.
+	Channels map[string]ChannelConfig `toml:"channels"`
+
+	// RCON is the remote console, which is enabled if the password is set.
+	RCON RCONConfig `toml:"rcon"`
+	// EnableQuery enables the GameSpy4 query protocol on UDP.
+	EnableQuery bool        `toml:"enable-query"`
+	Query       QueryConfig `toml:"query"`
+
+	Generator         string         `toml:"generator"`
+	GeneratorSettings map[string]any `toml:"generator-settings"`
+	// Dimensions overrides the generator of the nether and the end, keyed by the dimension name.
+	Dimensions map[string]DimensionConfig `toml:"dimensions"`
 
 	ChunkLoadingLimiter       Limiter `toml:"chunk-loading-limiter"`
 	PlayerChunkLoadingLimiter Limiter `toml:"player-chunk-loading-limiter"`
+	// ChatSpamLimiter limits the chat messages and commands sent by a player, who is kicked when exceeding it.
+	// Operators aren't limited. It's 1 message per second with a burst of 10 if not set, same as vanilla.
+	ChatSpamLimiter Limiter `toml:"chat-spam-limiter"`
+}
+
+type RCONConfig struct {
+	// Port is the TCP port of RCON on the same host as the game, 25575 if not set.
+	Port     int    `toml:"port"`
+	Password string `toml:"password"`
+}
+
+type QueryConfig struct {
+	// Port is the UDP port of the query, the same as the game if not set.
+	Port int `toml:"port"`
+}
+
+type ChatFormatConfig struct {
+	// Format is a translation key, or a template in which each "%s" is replaced by a parameter, like "[Member] <%s> %s".
+	Format string `toml:"format"`
+	// Parameters are the values of the placeholders, each of "sender", "target" and "content".
+	Parameters []string `toml:"parameters"`
+	// Color is the name of the color, like "gray".
+	Color string `toml:"color"`
+}
+
+type ChannelConfig struct {
+	// DisplayName is shown before the messages in square brackets, the name of the channel if not set.
+	DisplayName string `toml:"display-name"`
+	// Permission is the level required to join the channel.
+	Permission int32 `toml:"permission"`
+	// AutoJoin makes the players join the channel when they join the server, if they have the permission.
+	AutoJoin bool `toml:"auto-join"`
+	// Radius limits the messages to the members within the distance in the same world, unlimited if it's 0.
+	Radius float64 `toml:"radius"`
+}
+
+// DimensionConfig is the generator of a dimension, the default one is kept if Generator is empty.
+type DimensionConfig struct {
+	Generator         string         `toml:"generator"`
+	GeneratorSettings map[string]any `toml:"generator-settings"`
 }
 
 type Limiter struct {
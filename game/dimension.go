@@ -0,0 +1,132 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package game
+
+import (
+	"fmt"
+
+	"github.com/go-mc/server/client"
+	"github.com/go-mc/server/world"
+)
+
+const (
+	overworld = "minecraft:overworld"
+	theNether = "minecraft:the_nether"
+	theEnd    = "minecraft:the_end"
+)
+
+// dimensions are the worlds hosted by the server, in the order they are advertised to the clients.
+var dimensions = []struct {
+	name, dimensionType string
+	// dir is the folder contains the "region" folder, relative to the level folder.
+	dir        string
+	loggerName string
+	// default generator, could be overridden by the config
+	generator         string
+	generatorSettings map[string]any
+}{
+	{
+		name: overworld, dimensionType: overworld,
+		dir: ".", loggerName: "overworld",
+		generator: "noise",
+	},
+	{
+		name: theNether, dimensionType: theNether,
+		dir: "DIM-1", loggerName: "the_nether",
+		generator: "flat",
+		generatorSettings: map[string]any{
+			"layers": "bedrock,62*netherrack,bedrock",
+			"biome":  "minecraft:nether_wastes",
+		},
+	},
+	{
+		name: theEnd, dimensionType: theEnd,
+		dir: "DIM1", loggerName: "the_end",
+		generator: "flat",
+		generatorSettings: map[string]any{
+			"layers": "48*air,16*end_stone",
+			"biome":  "minecraft:the_end",
+		},
+	},
+}
+
+func (g *Game) dimensionNames() []string {
+	names := make([]string, len(dimensions))
+	for i, dim := range dimensions {
+		names[i] = dim.name
+	}
+	return names
+}
+
+// ChangeDimension moves the player from the current world to another dimension, at the position.
+// Nothing happens if the player is still joining or has already left.
+func (g *Game) ChangeDimension(c *client.Client, dimension string, pos world.Position, rot world.Rotation) error {
+	to, ok := g.worlds[dimension]
+	if !ok {
+		return fmt.Errorf("unknown dimension: %s", dimension)
+	}
+	g.dimensionLock.Lock()
+	defer g.dimensionLock.Unlock()
+	g.changeDimension(c, to, pos, rot)
+	return nil
+}
+
+// changeDimension is ChangeDimension with the dimensionLock held.
+func (g *Game) changeDimension(c *client.Client, to *world.World, pos world.Position, rot world.Rotation) {
+	from, ok := g.playerWorlds[c]
+	if !ok {
+		return
+	}
+	p := c.GetPlayer()
+	from.RemovePlayer(c, p)
+	delete(g.playerWorlds, c)
+	// the player isn't in any world now, so it's safe to modify it.
+	p.Dimension = to.Name()
+	p.Position, p.Rotation = pos, rot
+	p.ChunkPos = [3]int32{int32(pos[0]) >> 4, int32(pos[1]) >> 4, int32(pos[2]) >> 4}
+
+	// the client drops all chunks and entities of the previous world when respawning.
+	c.SendRespawn(to, p, client.RespawnKeepAttributes|client.RespawnKeepMetadata)
+	c.SendSetChunkCacheCenter([2]int32{p.ChunkPos[0], p.ChunkPos[2]})
+	// the new player entity of the client has an empty inventory.
+	c.SendInventory()
+	p.Inputs.Lock()
+	c.SendSetCarriedItem(p.Inputs.HeldSlot)
+	p.Inputs.Unlock()
+	to.AddPlayer(c, p, g.config.PlayerChunkLoadingLimiter.Limiter())
+	g.playerWorlds[c] = to
+	to.TeleportPlayer(c, p, pos, rot)
+	c.SendSetDefaultSpawnPosition(g.overworld.SpawnPositionAndAngle())
+}
+
+// addToWorld adds the joining player to the world, after which the player can be moved between worlds.
+func (g *Game) addToWorld(c *client.Client, p *world.Player, w *world.World) {
+	g.dimensionLock.Lock()
+	defer g.dimensionLock.Unlock()
+	w.AddPlayer(c, p, g.config.PlayerChunkLoadingLimiter.Limiter())
+	g.playerWorlds[c] = w
+}
+
+// removeFromWorld removes the player from the world it is currently in.
+func (g *Game) removeFromWorld(c *client.Client, p *world.Player) {
+	g.dimensionLock.Lock()
+	defer g.dimensionLock.Unlock()
+	if w, ok := g.playerWorlds[c]; ok {
+		w.RemovePlayer(c, p)
+		delete(g.playerWorlds, c)
+	}
+}
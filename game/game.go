@@ -20,8 +20,10 @@ import (
 	"compress/gzip"
 	"context"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -45,19 +47,62 @@ type Game struct {
 	serverInfo *server.PingInfo
 
 	playerProvider world.PlayerProvider
-	overworld      *world.World
+	// worlds are all dimensions of the level, keyed by the dimension name.
+	worlds    map[string]*world.World
+	overworld *world.World
+	// dimensionLock protects Player.Dimension and playerWorlds, which are changed when the player moves between worlds.
+	dimensionLock sync.Mutex
+	// playerWorlds are the worlds the players are in, the players still joining or already left are not in it.
+	playerWorlds map[*client.Client]*world.World
 
 	globalChat globalChat
+	commands   *CommandDispatcher
+	ops        *opList
+	access     *accessLists
 	*playerList
+
+	// cancel stops the background goroutines of the game.
+	cancel context.CancelFunc
+	// closeLock protects closed, and makes sure no player is added to the WaitGroup after Shutdown starts waiting.
+	closeLock sync.Mutex
+	closed    bool
+	players   sync.WaitGroup
+	// joined is the clients of the players in the WaitGroup, which are disconnected by Shutdown
+	// even if they are not yet in the player list.
+	joined map[*client.Client]struct{}
+	// stopping is closed when a stop is requested by Stop.
+	stopping chan struct{}
+	stopOnce sync.Once
 }
 
 func NewGame(log *zap.Logger, config Config, pingList *server.PlayerList, serverInfo *server.PingInfo) *Game {
 	// providers
-	overworld, err := createWorld(log, filepath.Join(".", config.LevelName), &config)
+	worlds, err := createWorlds(log, filepath.Join(".", config.LevelName), &config)
 	if err != nil {
-		log.Fatal("cannot load overworld", zap.Error(err))
+		log.Fatal("cannot load worlds", zap.Error(err))
 	}
 	playerProvider := world.NewPlayerProvider(filepath.Join(".", config.LevelName, "playerdata"))
+	ops, err := loadOpList(opsFile)
+	if err != nil {
+		log.Fatal("cannot load operators", zap.Error(err))
+	}
+	access, err := loadAccessLists(config.WhiteList)
+	if err != nil {
+		log.Fatal("cannot load whitelist and ban lists", zap.Error(err))
+	}
+	if config.OpPermissionLevel == 0 {
+		config.OpPermissionLevel = PermissionOwner
+	}
+	if err := applyChatFormats(&world.NetworkCodec.ChatType, config.ChatFormat); err != nil {
+		log.Fatal("cannot apply chat format", zap.Error(err))
+	}
+	channels, err := newChatChannels(config.Channels)
+	if err != nil {
+		log.Fatal("cannot load chat channels", zap.Error(err))
+	}
+	if config.ChatSpamLimiter.N == 0 {
+		config.ChatSpamLimiter = defaultChatSpamLimiter
+	}
 
 	// keepalive
 	keepAlive := server.NewKeepAlive()
@@ -65,31 +110,57 @@ func NewGame(log *zap.Logger, config Config, pingList *server.PlayerList, server
 	keepAlive.AddPlayerDelayUpdateHandler(func(c server.KeepAliveClient, latency time.Duration) {
 		pl.updateLatency(c.(*client.Client), latency)
 	})
-	go keepAlive.Run(context.TODO())
+	ctx, cancel := context.WithCancel(context.Background())
+	go keepAlive.Run(ctx)
 
-	return &Game{
+	g := &Game{
 		log: log.Named("game"),
 
 		config:     config,
 		serverInfo: serverInfo,
 
 		playerProvider: playerProvider,
-		overworld:      overworld,
+		worlds:         worlds,
+		overworld:      worlds[overworld],
+		playerWorlds:   make(map[*client.Client]*world.World),
 
 		globalChat: globalChat{
 			log:           log.Named("chat"),
 			players:       &pl,
 			chatTypeCodec: &world.NetworkCodec.ChatType,
+			onlineMode:    config.OnlineMode,
+			// like vanilla, signed chat can be enforced only in online mode.
+			enforceSecureProfile: config.EnforceSecureProfile && config.OnlineMode,
+			channels:             channels,
+			members:              make(map[*client.Client]*chatMember),
+			muted:                jsonList[playerMute]{path: mutedPlayersFile},
 		},
+		ops:        ops,
+		access:     access,
 		playerList: &pl,
+		cancel:     cancel,
+		stopping:   make(chan struct{}),
+		joined:     make(map[*client.Client]struct{}),
 	}
+	if err := g.globalChat.muted.load(); err != nil {
+		log.Fatal("cannot load muted players", zap.Error(err))
+	}
+	g.globalChat.worldOf = g.playerWorld
+	g.commands = newCommandDispatcher(log.Named("command"), g)
+	g.registerAdminCommands()
+	g.registerAccessCommands()
+	g.registerMessageCommands()
+	g.registerChannelCommands()
+	go g.autoSave(ctx)
+	return g
 }
 
-func createWorld(logger *zap.Logger, path string, config *Config) (*world.World, error) {
+func createWorlds(logger *zap.Logger, path string, config *Config) (map[string]*world.World, error) {
 	f, err := os.Open(filepath.Join(path, "level.dat"))
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
 	r, err := gzip.NewReader(f)
 	if err != nil {
 		return nil, err
@@ -98,16 +169,48 @@ func createWorld(logger *zap.Logger, path string, config *Config) (*world.World,
 	if err != nil {
 		return nil, err
 	}
-	overworld := world.New(
-		logger.Named("overworld"),
-		world.NewProvider(filepath.Join(path, "region"), config.ChunkLoadingLimiter.Limiter()),
-		world.Config{
-			ViewDistance:  config.ViewDistance,
-			SpawnAngle:    lv.Data.SpawnAngle,
-			SpawnPosition: [3]int32{lv.Data.SpawnX, lv.Data.SpawnY, lv.Data.SpawnZ},
-		},
-	)
-	return overworld, nil
+	seed := lv.Data.WorldGenSettings.Seed
+	worlds := make(map[string]*world.World, len(dimensions))
+	for _, dim := range dimensions {
+		_, dimType := world.NetworkCodec.DimensionType.Find(dim.dimensionType)
+		if dimType == nil {
+			return nil, fmt.Errorf("unknown dimension type: %s", dim.dimensionType)
+		}
+		generatorName, generatorSettings := dim.generator, dim.generatorSettings
+		if dim.name == overworld {
+			if config.Generator != "" {
+				generatorName, generatorSettings = config.Generator, config.GeneratorSettings
+			}
+		} else if c, ok := config.Dimensions[dim.name]; ok && c.Generator != "" {
+			generatorName, generatorSettings = c.Generator, c.GeneratorSettings
+		}
+		generator, err := world.NewGenerator(
+			generatorName,
+			world.GeneratorContext{Seed: seed, MinY: dimType.MinY, Height: dimType.Height},
+			generatorSettings,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("create generator of %s fail: %w", dim.name, err)
+		}
+		worlds[dim.name] = world.New(
+			logger.Named(dim.loggerName),
+			world.NewProvider(
+				filepath.Join(path, dim.dir, "region"),
+				dimType.MinY>>4,
+				config.ChunkLoadingLimiter.Limiter(),
+			),
+			world.Config{
+				Name:          dim.name,
+				DimensionType: dim.dimensionType,
+				ViewDistance:  config.ViewDistance,
+				SpawnAngle:    lv.Data.SpawnAngle,
+				SpawnPosition: [3]int32{lv.Data.SpawnX, lv.Data.SpawnY, lv.Data.SpawnZ},
+				Seed:          seed,
+				Generator:     generator,
+			},
+		)
+	}
+	return worlds, nil
 }
 
 // AcceptPlayer will be called in an independent goroutine when new player login
@@ -117,6 +220,15 @@ func (g *Game) AcceptPlayer(name string, id uuid.UUID, profilePubKey *user.Publi
 		zap.String("uuid", id.String()),
 		zap.Int32("protocol", protocol),
 	)
+	g.closeLock.Lock()
+	if g.closed {
+		g.closeLock.Unlock()
+		_ = conn.WritePacket(pk.Marshal(packetid.ClientboundDisconnect, g.shutdownMessage()))
+		return
+	}
+	g.players.Add(1)
+	g.closeLock.Unlock()
+	defer g.players.Done()
 
 	p, err := g.playerProvider.GetPlayer(name, id, profilePubKey, properties)
 	if errors.Is(err, os.ErrNotExist) {
@@ -130,37 +242,191 @@ func (g *Game) AcceptPlayer(name string, id uuid.UUID, profilePubKey *user.Publi
 			UUID:           id,
 			PubKey:         profilePubKey,
 			Properties:     properties,
-			Gamemode:       1,
+			Dimension:      overworld,
 			ChunkPos:       [3]int32{48 >> 4, 64 >> 4, 35 >> 4},
 			EntitiesInView: make(map[int32]*world.Entity),
 			ViewDistance:   10,
 		}
+		p.SetGamemode(gamemodeCreative)
 	} else if err != nil {
 		logger.Error("Read player data error", zap.Error(err))
 		return
 	}
+	p.SetPermissionLevel(g.ops.level(id))
+	w, ok := g.worlds[p.Dimension]
+	if !ok {
+		logger.Warn("Player is in an unknown dimension, move to the overworld", zap.String("dimension", p.Dimension))
+		p.Dimension, w = overworld, g.overworld
+	}
 	c := client.New(logger, conn, p)
+	c.SetChatLimiter(g.config.ChatSpamLimiter.Limiter())
+	if !g.trackClient(c) {
+		_ = conn.WritePacket(pk.Marshal(packetid.ClientboundDisconnect, g.shutdownMessage()))
+		return
+	}
+	defer g.untrackClient(c)
 
 	logger.Info("Player join", zap.Int32("eid", p.EntityID))
 	defer logger.Info("Player left")
 
-	c.SendLogin(g.overworld, p)
-	c.SendServerData(g.serverInfo.Description(), g.serverInfo.FavIcon(), g.config.EnforceSecureProfile)
+	c.SendLogin(g.dimensionNames(), w, p)
+	c.SendServerData(g.serverInfo.Description(), g.serverInfo.FavIcon(), g.globalChat.enforceSecureProfile)
+	c.SendEntityEvent(p.EntityID, client.EntityEventOpLevel0+byte(p.PermissionLevel()))
+	c.SendSetCarriedItem(p.Inputs.HeldSlot)
 
 	joinMsg := chat.TranslateMsg("multiplayer.player.joined", chat.Text(p.Name)).SetColor(chat.Yellow)
 	leftMsg := chat.TranslateMsg("multiplayer.player.left", chat.Text(p.Name)).SetColor(chat.Yellow)
+	g.globalChat.joinChannels(c)
+	defer g.globalChat.leaveChannels(c)
 	g.globalChat.broadcastSystemChat(joinMsg, false)
 	defer g.globalChat.broadcastSystemChat(leftMsg, false)
 	c.AddHandler(packetid.ServerboundChat, g.globalChat.Handle)
+	c.AddHandler(packetid.ServerboundChatSessionUpdate, g.globalChat.HandleSessionUpdate)
+	c.AddHandler(packetid.ServerboundPlayerAction, g.handlePlayerAction)
+	c.AddHandler(packetid.ServerboundUseItemOn, g.handleUseItemOn)
+	c.AddHandler(packetid.ServerboundSwing, g.handleSwing)
+	c.AddHandler(packetid.ServerboundChatCommand, g.handleChatCommand)
+	c.AddHandler(packetid.ServerboundCommandSuggestion, g.handleCommandSuggestion)
 
 	g.playerList.addPlayer(c, p)
 	defer g.playerList.removePlayer(c)
 
 	c.SendPlayerPosition(p.Position, p.Rotation)
-	g.overworld.AddPlayer(c, p, g.config.PlayerChunkLoadingLimiter.Limiter())
-	defer g.overworld.RemovePlayer(c, p)
+	g.addToWorld(c, p, w)
+	// the player is saved after leaving the world, when nothing else changes it.
+	defer g.savePlayer(logger, p)
+	defer g.removeFromWorld(c, p)
 	c.SendPacket(packetid.ClientboundUpdateTags, pk.Array(defaultTags))
+	g.sendCommands(c)
+	c.SendInventory()
 	c.SendSetDefaultSpawnPosition(g.overworld.SpawnPositionAndAngle())
 
 	c.Start()
 }
+
+// TickStats returns the TPS and MSPT statistics of each world, keyed by the dimension name.
+func (g *Game) TickStats() map[string]*world.TickStats {
+	stats := make(map[string]*world.TickStats, len(g.worlds))
+	for name, w := range g.worlds {
+		stats[name] = w.TickStats()
+	}
+	return stats
+}
+
+func (g *Game) savePlayer(logger *zap.Logger, p *world.Player) {
+	// the crafting grid and the cursor are not saved, so their items are moved to the inventory like closing it.
+	// Items which don't fit are still lost, vanilla drops them on the ground.
+	p.Inventory.Lock()
+	p.Inventory.ReturnCrafting()
+	p.Inventory.Unlock()
+	g.dimensionLock.Lock()
+	defer g.dimensionLock.Unlock()
+	if err := g.playerProvider.PutPlayer(p); err != nil {
+		logger.Error("Save player data error", zap.Error(err))
+	}
+}
+
+// defaultAutoSaveInterval is the same as vanilla, which saves every 6000 ticks.
+const defaultAutoSaveInterval = 5 * time.Minute
+
+// autoSave saves the data of online players periodically until the ctx is done.
+func (g *Game) autoSave(ctx context.Context) {
+	interval := g.config.AutoSaveInterval.Duration
+	if interval <= 0 {
+		interval = defaultAutoSaveInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = g.savePlayers()
+		}
+	}
+}
+
+// savePlayers saves the data of all online players.
+func (g *Game) savePlayers() (errRet error) {
+	g.log.Debug("Saving players")
+	for _, w := range g.worlds {
+		// errors are logged by the world.
+		if err := w.SavePlayers(&g.playerProvider); err != nil && errRet == nil {
+			errRet = err
+		}
+	}
+	return
+}
+
+// saveAll saves the data of online players and all loaded chunks.
+func (g *Game) saveAll() error {
+	errRet := g.savePlayers()
+	for _, w := range g.worlds {
+		if err := w.SaveChunks(); err != nil && errRet == nil {
+			errRet = err
+		}
+	}
+	return errRet
+}
+
+// Stop requests the server to stop. The server calls Shutdown after receiving from Stopping.
+func (g *Game) Stop() {
+	g.stopOnce.Do(func() { close(g.stopping) })
+}
+
+// Stopping returns a channel which is closed when a stop is requested.
+func (g *Game) Stopping() <-chan struct{} { return g.stopping }
+
+func (g *Game) shutdownMessage() chat.Message {
+	if g.config.ShutdownMessage != "" {
+		return chat.Text(g.config.ShutdownMessage)
+	}
+	return chat.TranslateMsg("multiplayer.disconnect.server_shutdown")
+}
+
+// trackClient records the client to be disconnected by Shutdown, and reports false if the game is already closed.
+func (g *Game) trackClient(c *client.Client) bool {
+	g.closeLock.Lock()
+	defer g.closeLock.Unlock()
+	if g.closed {
+		return false
+	}
+	g.joined[c] = struct{}{}
+	return true
+}
+
+func (g *Game) untrackClient(c *client.Client) {
+	g.closeLock.Lock()
+	defer g.closeLock.Unlock()
+	delete(g.joined, c)
+}
+
+// Shutdown disconnects all players, and stops all worlds after saving them.
+// New players are refused once Shutdown is called.
+func (g *Game) Shutdown() {
+	g.closeLock.Lock()
+	g.closed = true
+	joined := make([]*client.Client, 0, len(g.joined))
+	for c := range g.joined {
+		joined = append(joined, c)
+	}
+	g.closeLock.Unlock()
+
+	g.log.Info("Disconnecting players")
+	reason := g.shutdownMessage()
+	// the players still joining are disconnected as soon as their clients start.
+	for _, c := range joined {
+		c.SendDisconnect(reason)
+	}
+	// players are saved when they leave.
+	g.players.Wait()
+
+	for name, w := range g.worlds {
+		g.log.Info("Saving world", zap.String("dimension", name))
+		if err := w.Close(); err != nil {
+			g.log.Error("Save world error", zap.String("dimension", name), zap.Error(err))
+		}
+	}
+	g.cancel()
+}
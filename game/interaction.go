@@ -0,0 +1,376 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package game
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Tnze/go-mc/data/item"
+	"github.com/Tnze/go-mc/level/block"
+	pk "github.com/Tnze/go-mc/net/packet"
+	"github.com/go-mc/server/client"
+	"github.com/go-mc/server/world"
+)
+
+// Status of ServerboundPlayerAction
+const (
+	actionStartDigging = iota
+	actionCancelDigging
+	actionFinishDigging
+)
+
+// Game modes
+const (
+	gamemodeSurvival = iota
+	gamemodeCreative
+	gamemodeAdventure
+	gamemodeSpectator
+)
+
+const (
+	// maxReach is the maximum distance from the eyes of a player to the center of the block it interacts with.
+	maxReach = 6
+	// eyeHeight is the height of the eyes of a standing player.
+	eyeHeight = 1.62
+	// digTolerance is the ratio of the break time that a player must spend, which allows some network latency.
+	digTolerance = 0.7
+)
+
+func (g *Game) handlePlayerAction(p pk.Packet, c *client.Client) error {
+	var (
+		status   pk.VarInt
+		location pk.Position
+		face     pk.Byte
+		sequence pk.VarInt
+	)
+	if err := p.Scan(&status, &location, &face, &sequence); err != nil {
+		return err
+	}
+	if status > actionFinishDigging {
+		return nil // dropping items, using items and swapping hands are not yet supported
+	}
+	player := c.GetPlayer()
+	w := g.playerWorld(player)
+	pos := [3]int32{int32(location.X), int32(location.Y), int32(location.Z)}
+	defer c.SendBlockChangedAck(int32(sequence))
+
+	state, ok := w.GetBlock(pos)
+	if !ok {
+		return nil
+	}
+	playerPos, _ := w.PlayerPosition(player)
+	if player.Gamemode() == gamemodeAdventure || player.Gamemode() == gamemodeSpectator || !canReach(playerPos, pos) {
+		c.SendBlockUpdate(pos, state)
+		return nil
+	}
+
+	switch status {
+	case actionStartDigging:
+		if player.Gamemode() == gamemodeCreative || breakTime(state, player.HeldItem()) == 0 {
+			g.breakBlock(w, c, pos, state)
+			return nil
+		}
+		player.StartDigging(pos)
+	case actionCancelDigging:
+		player.StopDigging()
+	case actionFinishDigging:
+		digging := player.StopDigging()
+		required := breakTime(state, player.HeldItem())
+		if digging == nil || digging.Pos != pos || required < 0 ||
+			time.Since(digging.Start) < time.Duration(float64(required)*digTolerance) {
+			g.log.Debug("Player break block too fast", zap.String("name", player.Name))
+			c.SendBlockUpdate(pos, state)
+			return nil
+		}
+		g.breakBlock(w, c, pos, state)
+	}
+	return nil
+}
+
+func (g *Game) breakBlock(w *world.World, c *client.Client, pos [3]int32, state block.StateID) {
+	if !w.SetBlock(pos, block.ToStateID[block.Air{}]) {
+		c.SendBlockUpdate(pos, state)
+	}
+}
+
+func (g *Game) handleUseItemOn(p pk.Packet, c *client.Client) error {
+	var (
+		hand           pk.VarInt
+		location       pk.Position
+		face           pk.VarInt
+		cursorX        pk.Float
+		cursorY        pk.Float
+		cursorZ        pk.Float
+		insideBlock    pk.Boolean
+		sequence       pk.VarInt
+		clickedPos     [3]int32
+		placePos       [3]int32
+		clicked, along block.StateID
+	)
+	if err := p.Scan(&hand, &location, &face, &cursorX, &cursorY, &cursorZ, &insideBlock, &sequence); err != nil {
+		return err
+	}
+	player := c.GetPlayer()
+	w := g.playerWorld(player)
+	defer c.SendBlockChangedAck(int32(sequence))
+
+	clickedPos = [3]int32{int32(location.X), int32(location.Y), int32(location.Z)}
+	placePos = clickedPos
+	var ok bool
+	if clicked, ok = w.GetBlock(clickedPos); !ok {
+		return nil
+	}
+	// replaceable blocks are replaced by the placed block, otherwise the block is placed against the clicked face.
+	if !isReplaceable(clicked) {
+		placePos = offsetFace(clickedPos, int32(face))
+	}
+	if along, ok = w.GetBlock(placePos); !ok {
+		c.SendBlockUpdate(clickedPos, clicked)
+		return nil
+	}
+
+	playerPos, _ := w.PlayerPosition(player)
+	stack := player.HeldItem()
+	placed, isBlock := itemToBlock(stack)
+	if hand != 0 || !isBlock || // only placing blocks from the main hand is supported
+		player.Gamemode() == gamemodeAdventure || player.Gamemode() == gamemodeSpectator ||
+		!canReach(playerPos, placePos) || !isReplaceable(along) || intersectsPlayer(playerPos, placePos) {
+		c.SendBlockUpdate(clickedPos, clicked)
+		c.SendBlockUpdate(placePos, along)
+		return nil
+	}
+	if !w.SetBlock(placePos, placed) {
+		c.SendBlockUpdate(placePos, along)
+		return nil
+	}
+	if player.Gamemode() != gamemodeCreative {
+		player.ConsumeHeldItem(stack)
+	}
+	return nil
+}
+
+// handleSwing shows the arm swing of the player to the other players.
+func (g *Game) handleSwing(p pk.Packet, c *client.Client) error {
+	var hand pk.VarInt
+	if err := p.Scan(&hand); err != nil {
+		return err
+	}
+	animation := byte(world.AnimationSwingMainArm)
+	if hand == 1 { // the off hand
+		animation = world.AnimationSwingOffhand
+	}
+	player := c.GetPlayer()
+	g.playerWorld(player).Animate(&player.Entity, animation)
+	return nil
+}
+
+// playerWorld returns the world the player is in.
+func (g *Game) playerWorld(p *world.Player) *world.World {
+	g.dimensionLock.Lock()
+	defer g.dimensionLock.Unlock()
+	return g.worlds[p.Dimension]
+}
+
+// playerPosition returns the position and the rotation of the player without racing with the tick of its world.
+func (g *Game) playerPosition(p *world.Player) (world.Position, world.Rotation) {
+	g.dimensionLock.Lock()
+	defer g.dimensionLock.Unlock()
+	if w := g.worlds[p.Dimension]; w != nil {
+		return w.PlayerPosition(p)
+	}
+	return p.Position, p.Rotation
+}
+
+// canReach reports whether the block is close enough to the eyes of the player at playerPos.
+func canReach(playerPos world.Position, pos [3]int32) bool {
+	dx := float64(pos[0]) + 0.5 - playerPos[0]
+	dy := float64(pos[1]) + 0.5 - (playerPos[1] + eyeHeight)
+	dz := float64(pos[2]) + 0.5 - playerPos[2]
+	return dx*dx+dy*dy+dz*dz <= maxReach*maxReach
+}
+
+// intersectsPlayer reports whether the block at pos overlaps the bounding box of the player at playerPos.
+func intersectsPlayer(playerPos world.Position, pos [3]int32) bool {
+	const halfWidth, height = 0.3, 1.8
+	x, y, z := float64(pos[0]), float64(pos[1]), float64(pos[2])
+	return playerPos[0]+halfWidth > x && playerPos[0]-halfWidth < x+1 &&
+		playerPos[1]+height > y && playerPos[1] < y+1 &&
+		playerPos[2]+halfWidth > z && playerPos[2]-halfWidth < z+1
+}
+
+// offsetFace returns the position next to pos on the face, in the order of -Y, +Y, -Z, +Z, -X, +X.
+func offsetFace(pos [3]int32, face int32) [3]int32 {
+	switch face {
+	case 0:
+		pos[1]--
+	case 1:
+		pos[1]++
+	case 2:
+		pos[2]--
+	case 3:
+		pos[2]++
+	case 4:
+		pos[0]--
+	case 5:
+		pos[0]++
+	}
+	return pos
+}
+
+func isReplaceable(state block.StateID) bool {
+	switch block.StateList[state].(type) {
+	case block.Air, block.CaveAir, block.VoidAir, block.Water, block.Lava,
+		block.Grass, block.Fern, block.DeadBush, block.Snow:
+		return true
+	}
+	return false
+}
+
+// itemToBlock returns the default state of the block placed by the item.
+func itemToBlock(stack world.ItemStack) (block.StateID, bool) {
+	if stack.IsEmpty() {
+		return 0, false
+	}
+	it, ok := item.ByID[stack.ID]
+	if !ok {
+		return 0, false
+	}
+	b, ok := block.FromID["minecraft:"+it.Name]
+	if !ok || block.IsAirBlock(b) {
+		return 0, false
+	}
+	state, ok := block.ToStateID[b]
+	return state, ok
+}
+
+// breakTime returns the time a survival player spends on breaking the block with the tool,
+// or -1 if the block is unbreakable. Every tool is assumed to be the right one for the block.
+func breakTime(state block.StateID, tool world.ItemStack) time.Duration {
+	hardness := blockHardness(block.StateList[state].ID())
+	if hardness < 0 {
+		return -1
+	}
+	// every tick the player makes speed/hardness/30 of the progress, and the block breaks instantly if it's more than 1.
+	progress := toolSpeed(tool) / hardness / 30
+	if progress >= 1 {
+		return 0
+	}
+	ticks := math.Ceil(1 / progress)
+	return time.Duration(ticks) * time.Second / world.TicksPerSecond
+}
+
+// toolSpeed returns the mining speed of the tool, which is 1 for hands and items other than tools.
+func toolSpeed(tool world.ItemStack) float64 {
+	it, ok := item.ByID[tool.ID]
+	if tool.IsEmpty() || !ok {
+		return 1
+	}
+	for _, suffix := range [...]string{"_pickaxe", "_axe", "_shovel", "_hoe"} {
+		if strings.HasSuffix(it.Name, suffix) {
+			switch strings.TrimSuffix(it.Name, suffix) {
+			case "wooden":
+				return 2
+			case "stone":
+				return 4
+			case "iron":
+				return 6
+			case "diamond":
+				return 8
+			case "netherite":
+				return 9
+			case "golden":
+				return 12
+			}
+		}
+	}
+	if it.Name == "shears" {
+		return 2
+	}
+	return 1
+}
+
+// blockHardness returns the hardness of the common blocks, -1 for unbreakable blocks.
+func blockHardness(id string) float64 {
+	switch id {
+	case "minecraft:bedrock", "minecraft:barrier", "minecraft:end_portal", "minecraft:end_portal_frame",
+		"minecraft:end_gateway", "minecraft:nether_portal", "minecraft:command_block",
+		"minecraft:chain_command_block", "minecraft:repeating_command_block", "minecraft:structure_block",
+		"minecraft:jigsaw", "minecraft:light", "minecraft:water", "minecraft:lava":
+		return -1
+	case "minecraft:obsidian", "minecraft:crying_obsidian", "minecraft:respawn_anchor":
+		return 50
+	case "minecraft:ancient_debris":
+		return 30
+	case "minecraft:ender_chest":
+		return 22.5
+	case "minecraft:reinforced_deepslate":
+		return 55
+	case "minecraft:deepslate", "minecraft:cobbled_deepslate", "minecraft:polished_deepslate":
+		return 3.5
+	case "minecraft:coal_ore", "minecraft:iron_ore", "minecraft:gold_ore", "minecraft:diamond_ore",
+		"minecraft:emerald_ore", "minecraft:lapis_ore", "minecraft:redstone_ore", "minecraft:copper_ore",
+		"minecraft:end_stone", "minecraft:gold_block", "minecraft:nether_gold_ore", "minecraft:nether_quartz_ore":
+		return 3
+	case "minecraft:deepslate_coal_ore", "minecraft:deepslate_iron_ore", "minecraft:deepslate_gold_ore",
+		"minecraft:deepslate_diamond_ore", "minecraft:deepslate_emerald_ore", "minecraft:deepslate_lapis_ore",
+		"minecraft:deepslate_redstone_ore", "minecraft:deepslate_copper_ore":
+		return 4.5
+	case "minecraft:iron_block", "minecraft:diamond_block", "minecraft:emerald_block", "minecraft:netherite_block":
+		return 5
+	case "minecraft:cobblestone", "minecraft:mossy_cobblestone", "minecraft:bricks", "minecraft:oak_planks",
+		"minecraft:spruce_planks", "minecraft:birch_planks", "minecraft:jungle_planks", "minecraft:acacia_planks",
+		"minecraft:dark_oak_planks", "minecraft:mangrove_planks", "minecraft:cherry_planks", "minecraft:oak_log",
+		"minecraft:spruce_log", "minecraft:birch_log", "minecraft:jungle_log", "minecraft:acacia_log",
+		"minecraft:dark_oak_log", "minecraft:mangrove_log", "minecraft:cherry_log", "minecraft:nether_bricks",
+		"minecraft:smooth_stone":
+		return 2
+	case "minecraft:stone", "minecraft:granite", "minecraft:diorite", "minecraft:andesite",
+		"minecraft:polished_granite", "minecraft:polished_diorite", "minecraft:polished_andesite",
+		"minecraft:stone_bricks", "minecraft:blackstone", "minecraft:basalt":
+		return 1.5
+	case "minecraft:sandstone", "minecraft:red_sandstone", "minecraft:quartz_block", "minecraft:note_block",
+		"minecraft:white_wool", "minecraft:calcite":
+		return 0.8
+	case "minecraft:dirt", "minecraft:coarse_dirt", "minecraft:sand", "minecraft:red_sand",
+		"minecraft:soul_sand", "minecraft:soul_soil", "minecraft:farmland", "minecraft:dirt_path",
+		"minecraft:clay", "minecraft:ice", "minecraft:packed_ice", "minecraft:sponge", "minecraft:mud",
+		"minecraft:rooted_dirt":
+		return 0.5
+	case "minecraft:grass_block", "minecraft:gravel", "minecraft:mycelium", "minecraft:podzol":
+		return 0.6
+	case "minecraft:netherrack", "minecraft:nylium", "minecraft:crimson_nylium", "minecraft:warped_nylium":
+		return 0.4
+	case "minecraft:snow_block", "minecraft:glass", "minecraft:glowstone", "minecraft:oak_leaves",
+		"minecraft:spruce_leaves", "minecraft:birch_leaves", "minecraft:jungle_leaves",
+		"minecraft:acacia_leaves", "minecraft:dark_oak_leaves", "minecraft:mangrove_leaves",
+		"minecraft:cherry_leaves", "minecraft:azalea_leaves":
+		return 0.2
+	case "minecraft:snow":
+		return 0.1
+	case "minecraft:grass", "minecraft:tall_grass", "minecraft:fern", "minecraft:large_fern",
+		"minecraft:dead_bush", "minecraft:dandelion", "minecraft:poppy", "minecraft:torch",
+		"minecraft:redstone_wire", "minecraft:sugar_cane", "minecraft:wheat", "minecraft:tnt",
+		"minecraft:slime_block", "minecraft:honey_block", "minecraft:kelp", "minecraft:seagrass":
+		return 0
+	}
+	// most of the remaining blocks are as hard as stone.
+	return 1.5
+}
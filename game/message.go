@@ -0,0 +1,94 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package game
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/Tnze/go-mc/chat"
+)
+
+// registerMessageCommands registers the commands sending chat messages.
+func (g *Game) registerMessageCommands() {
+	g.commands.Register(
+		msgCommand("msg", g),
+		msgCommand("tell", g),
+		msgCommand("w", g),
+		Literal("me").Then(
+			Argument("action", MessageArgument{}).Executes(g.meCommand),
+		),
+	)
+}
+
+// msgCommand builds the command tree of /msg, which is also registered as /tell and /w.
+//
+//	/msg <targets> <message>
+func msgCommand(name string, g *Game) *CommandNode {
+	return Literal(name).Then(
+		Argument("targets", PlayerArgument{}).Then(
+			Argument("message", MessageArgument{}).Executes(g.msgCommand),
+		),
+	)
+}
+
+func (g *Game) msgCommand(ctx *CommandContext) error {
+	// the signature is checked before anything else, since the player has moved the chain forward.
+	msg, ok := g.globalChat.commandMessage(ctx, "message")
+	if !ok {
+		return nil
+	}
+	targets, err := ctx.Players("targets")
+	if err != nil {
+		return err
+	}
+	content := ctx.String("message")
+	sender := chat.Text(ctx.Source.Name())
+	self, isPlayer := ctx.Player()
+	incoming := g.globalChat.chatType("minecraft:msg_command_incoming", sender, nil)
+	for _, c := range targets {
+		target := chat.Text(c.GetPlayer().Name)
+		outgoing := g.globalChat.chatType("minecraft:msg_command_outgoing", sender, &target)
+		if isPlayer {
+			sendChat(self, msg, content, &outgoing)
+		} else {
+			ctx.Source.SendMessage(g.globalChat.decorate(&outgoing, content))
+		}
+		if !isPlayer || !g.globalChat.ignores(c, self.GetPlayer().UUID) {
+			sendChat(c, msg, content, &incoming)
+		}
+		g.globalChat.log.Info(g.globalChat.decorate(&outgoing, content).String(), zap.String("sender", ctx.Source.Name()))
+	}
+	return nil
+}
+
+func (g *Game) meCommand(ctx *CommandContext) error {
+	msg, ok := g.globalChat.commandMessage(ctx, "action")
+	if !ok {
+		return nil
+	}
+	content := ctx.String("action")
+	chatType := g.globalChat.chatType("minecraft:emote_command", chat.Text(ctx.Source.Name()), nil)
+	g.globalChat.log.Info(g.globalChat.decorate(&chatType, content).String())
+	recipients := g.clients()
+	if self, ok := ctx.Player(); ok {
+		recipients = g.globalChat.excludeIgnoring(recipients, self.GetPlayer().UUID, nil)
+	}
+	for _, c := range recipients {
+		sendChat(c, msg, content, &chatType)
+	}
+	return nil
+}
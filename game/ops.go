@@ -0,0 +1,285 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/Tnze/go-mc/chat"
+	"github.com/Tnze/go-mc/server"
+	"github.com/go-mc/server/client"
+)
+
+// Permission levels of players, same as vanilla.
+const (
+	PermissionAll        = iota // normal players
+	PermissionModerator         // bypass the spawn protection
+	PermissionGamemaster        // use the cheat commands
+	PermissionAdmin             // use the multiplayer management commands
+	PermissionOwner             // use all commands
+)
+
+const opsFile = "ops.json"
+
+// opEntry is an element in the ops.json.
+type opEntry struct {
+	UUID                uuid.UUID `json:"uuid"`
+	Name                string    `json:"name"`
+	Level               int32     `json:"level"`
+	BypassesPlayerLimit bool      `json:"bypassesPlayerLimit"`
+}
+
+// opList is the operators of the server, stored in ops.json.
+type opList struct {
+	jsonList[opEntry]
+}
+
+func loadOpList(path string) (*opList, error) {
+	l := &opList{jsonList[opEntry]{path: path}}
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// level returns the permission level of the player, 0 if it isn't an operator.
+func (l *opList) level(id uuid.UUID) int32 {
+	if v, ok := l.find(func(v *opEntry) bool { return v.UUID == id }); ok {
+		return clampPermissionLevel(v.Level)
+	}
+	return PermissionAll
+}
+
+// set adds the player to the list, or removes it if the level is 0. The list is saved immediately.
+func (l *opList) set(id uuid.UUID, name string, level int32) error {
+	match := func(v *opEntry) bool { return v.UUID == id }
+	if level == PermissionAll {
+		_, err := l.remove(match)
+		return err
+	}
+	entry := opEntry{UUID: id, Name: name, Level: level}
+	if old, ok := l.find(match); ok {
+		entry.BypassesPlayerLimit = old.BypassesPlayerLimit
+	}
+	return l.put(entry, match)
+}
+
+// bypassesPlayerLimit reports whether the player can join the server even if it is full.
+func (l *opList) bypassesPlayerLimit(id uuid.UUID) bool {
+	v, ok := l.find(func(v *opEntry) bool { return v.UUID == id })
+	return ok && v.BypassesPlayerLimit
+}
+
+func clampPermissionLevel(level int32) int32 {
+	if level < PermissionAll {
+		return PermissionAll
+	}
+	if level > PermissionOwner {
+		return PermissionOwner
+	}
+	return level
+}
+
+// jsonList is a list of entries stored in a JSON file, like ops.json and whitelist.json.
+// Every modification is saved to the file immediately.
+type jsonList[T any] struct {
+	path    string
+	lock    sync.RWMutex
+	entries []T
+}
+
+// load reads the entries from the file, the list is empty if the file doesn't exist.
+func (l *jsonList[T]) load() error {
+	var entries []T
+	if err := readJSONFile(l.path, &entries); err != nil {
+		return err
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.entries = entries
+	return nil
+}
+
+func (l *jsonList[T]) find(match func(v *T) bool) (v T, ok bool) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	for i := range l.entries {
+		if match(&l.entries[i]) {
+			return l.entries[i], true
+		}
+	}
+	return
+}
+
+// all returns a copy of all entries.
+func (l *jsonList[T]) all() []T {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return append([]T(nil), l.entries...)
+}
+
+// put replaces the entries matched with v, or appends v if none is matched.
+func (l *jsonList[T]) put(v T, match func(v *T) bool) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	entries := make([]T, 0, len(l.entries)+1)
+	for i := range l.entries {
+		if !match(&l.entries[i]) {
+			entries = append(entries, l.entries[i])
+		}
+	}
+	entries = append(entries, v)
+	return l.save(entries)
+}
+
+// remove deletes the entries matched, and reports whether any is deleted.
+func (l *jsonList[T]) remove(match func(v *T) bool) (bool, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	entries := make([]T, 0, len(l.entries))
+	for i := range l.entries {
+		if !match(&l.entries[i]) {
+			entries = append(entries, l.entries[i])
+		}
+	}
+	if len(entries) == len(l.entries) {
+		return false, nil
+	}
+	return true, l.save(entries)
+}
+
+// save writes the entries to the file, and uses them if succeeded. The caller must hold the lock.
+func (l *jsonList[T]) save(entries []T) error {
+	if err := writeJSONFile(l.path, entries); err != nil {
+		return fmt.Errorf("save %s fail: %w", l.path, err)
+	}
+	l.entries = entries
+	return nil
+}
+
+// readJSONFile decodes the file to v, leaving v unchanged if the file doesn't exist.
+func readJSONFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parse %s fail: %w", path, err)
+	}
+	return nil
+}
+
+// writeJSONFile writes v to a temporary file, and then replace the file with it.
+func writeJSONFile(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// HasPermission reports whether the player's permission level is at least the level.
+func (g *Game) HasPermission(c *client.Client, level int32) bool {
+	return c.GetPlayer().PermissionLevel() >= level
+}
+
+// SetPermissionLevel changes the permission level of the player and saves it to ops.json.
+// The client is notified, so it knows which commands are available.
+func (g *Game) SetPermissionLevel(c *client.Client, level int32) error {
+	p := c.GetPlayer()
+	return g.setOpLevel(server.GameProfile{ID: p.UUID, Name: p.Name}, level)
+}
+
+// setOpLevel saves the permission level of the player to ops.json, and applies it if the player is online.
+func (g *Game) setOpLevel(profile server.GameProfile, level int32) error {
+	level = clampPermissionLevel(level)
+	if err := g.ops.set(profile.ID, profile.Name, level); err != nil {
+		return err
+	}
+	for _, c := range g.clients() {
+		if p := c.GetPlayer(); p.UUID == profile.ID {
+			p.SetPermissionLevel(level)
+			c.SendEntityEvent(p.EntityID, client.EntityEventOpLevel0+byte(level))
+			g.sendCommands(c)
+		}
+	}
+	return nil
+}
+
+func (g *Game) opCommand(ctx *CommandContext) error {
+	profiles, err := ctx.GameProfiles("targets")
+	if err != nil {
+		return err
+	}
+	var changed bool
+	for _, profile := range profiles {
+		if g.ops.level(profile.ID) == g.config.OpPermissionLevel {
+			continue
+		}
+		if err := g.setOpLevel(profile, g.config.OpPermissionLevel); err != nil {
+			return err
+		}
+		g.log.Info("Player is opped", zap.String("name", profile.Name), zap.String("by", ctx.Source.Name()))
+		ctx.Source.SendMessage(chat.TranslateMsg("commands.op.success", chat.Text(profile.Name)))
+		changed = true
+	}
+	if !changed {
+		return commandError("commands.op.failed")
+	}
+	return nil
+}
+
+func (g *Game) deopCommand(ctx *CommandContext) error {
+	profiles, err := ctx.GameProfiles("targets")
+	if err != nil {
+		return err
+	}
+	var changed bool
+	for _, profile := range profiles {
+		if g.ops.level(profile.ID) == PermissionAll {
+			continue
+		}
+		if err := g.setOpLevel(profile, PermissionAll); err != nil {
+			return err
+		}
+		g.log.Info("Player is deopped", zap.String("name", profile.Name), zap.String("by", ctx.Source.Name()))
+		ctx.Source.SendMessage(chat.TranslateMsg("commands.deop.success", chat.Text(profile.Name)))
+		changed = true
+	}
+	if !changed {
+		return commandError("commands.deop.failed")
+	}
+	return nil
+}
@@ -42,6 +42,7 @@ func (pl *playerList) addPlayer(c *client.Client, p *world.Player) {
 	players = append(players, p)
 	addPlayerAction := client.NewPlayerInfoAction(
 		client.PlayerInfoAddPlayer,
+		client.PlayerInfoInitializeChat,
 		client.PlayerInfoUpdateListed,
 	)
 	pl.pingList.Range(func(c server.PlayerListClient, _ server.PlayerSample) {
@@ -82,3 +83,12 @@ func keepAliveHandler(k *server.KeepAlive) client.PacketHandler {
 		return nil
 	}
 }
+
+// clients returns all online players.
+func (pl *playerList) clients() []*client.Client {
+	clients := make([]*client.Client, 0, pl.pingList.Len())
+	pl.pingList.Range(func(c server.PlayerListClient, _ server.PlayerSample) {
+		clients = append(clients, c.(*client.Client))
+	})
+	return clients
+}
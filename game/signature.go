@@ -0,0 +1,86 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package game
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	_ "embed"
+	"encoding/binary"
+
+	"github.com/google/uuid"
+
+	"github.com/Tnze/go-mc/chat/sign"
+	"github.com/Tnze/go-mc/yggdrasil/user"
+)
+
+// mojangPublicKeyData is the key of Mojang which signs the profile keys of players.
+//
+//go:embed yggdrasil_session_pubkey.der
+var mojangPublicKeyData []byte
+
+var mojangPublicKey = func() *rsa.PublicKey {
+	key, err := x509.ParsePKIXPublicKey(mojangPublicKeyData)
+	if err != nil {
+		panic(err)
+	}
+	return key.(*rsa.PublicKey)
+}()
+
+// verifyProfileKey reports whether the profile key of the player is signed by Mojang.
+// The signed payload is the UUID of the player, the expiry time and the key.
+func verifyProfileKey(id uuid.UUID, key *user.PublicKey) bool {
+	encoded, err := x509.MarshalPKIXPublicKey(key.PubKey)
+	if err != nil {
+		return false
+	}
+	var payload bytes.Buffer
+	payload.Write(id[:])
+	_ = binary.Write(&payload, binary.BigEndian, key.ExpiresAt.UnixMilli())
+	payload.Write(encoded)
+	hash := sha1.Sum(payload.Bytes())
+	return rsa.VerifyPKCS1v15(mojangPublicKey, crypto.SHA1, hash[:], key.Signature) == nil
+}
+
+// verifyChatMessage reports whether the message is signed by the key of the chat session.
+func verifyChatMessage(key *user.PublicKey, msg *sign.Message) bool {
+	return key.VerifyMessage(chatMessageHash(msg), msg.Signature[:]) == nil
+}
+
+// chatMessageHash returns the SHA-256 hash of the signed content of the message, including its link in the chain.
+func chatMessageHash(msg *sign.Message) []byte {
+	h := sha256.New()
+	_ = binary.Write(h, binary.BigEndian, int32(1)) // version
+	// link
+	_, _ = h.Write(msg.Prev.Sender[:])
+	_, _ = h.Write(msg.Prev.Session[:])
+	_ = binary.Write(h, binary.BigEndian, int32(msg.Prev.Index))
+	// body
+	_ = binary.Write(h, binary.BigEndian, msg.Salt)
+	_ = binary.Write(h, binary.BigEndian, msg.Timestamp.Unix())
+	_ = binary.Write(h, binary.BigEndian, int32(len(msg.PlainMsg)))
+	_, _ = h.Write([]byte(msg.PlainMsg))
+	_ = binary.Write(h, binary.BigEndian, int32(len(msg.LastSeen)))
+	for _, v := range msg.LastSeen {
+		_, _ = h.Write(v[:])
+	}
+	return h.Sum(nil)
+}
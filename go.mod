@@ -8,6 +8,7 @@ require (
 	github.com/google/uuid v1.3.0
 	go.uber.org/zap v1.24.0
 	golang.org/x/exp v0.0.0-20230321023759-10a507213a29
+	golang.org/x/term v0.10.0
 	golang.org/x/time v0.3.0
 )
 
@@ -15,4 +16,5 @@ require (
 	github.com/pkg/errors v0.9.1 // indirect
 	go.uber.org/atomic v1.10.0 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
+	golang.org/x/sys v0.10.0 // indirect
 )
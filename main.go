@@ -17,14 +17,22 @@
 package main
 
 import (
+	"context"
 	"flag"
+	stdnet "net"
+	"net/url"
+	"os"
+	"os/signal"
 	"runtime/debug"
+	"strconv"
 	"strings"
+	"syscall"
 
 	"github.com/BurntSushi/toml"
 	"go.uber.org/zap"
 
 	"github.com/Tnze/go-mc/chat"
+	"github.com/Tnze/go-mc/net"
 	"github.com/Tnze/go-mc/server"
 	"github.com/go-mc/server/game"
 )
@@ -33,13 +41,11 @@ var isDebug = flag.Bool("debug", false, "Enable debug log output")
 
 func main() {
 	flag.Parse()
+	// the console is created first, so the log can be written through it
+	con := unwrap(newConsole())
+	defer con.Close()
 	// initialize log library
-	var logger *zap.Logger
-	if *isDebug {
-		logger = unwrap(zap.NewDevelopment())
-	} else {
-		logger = unwrap(zap.NewProduction())
-	}
+	logger := newLogger(con)
 	defer func(logger *zap.Logger) {
 		if err := logger.Sync(); err != nil {
 			panic(err)
@@ -70,25 +76,115 @@ func main() {
 		return
 	}
 
+	g := game.NewGame(logger, config, playerList, serverInfo)
 	s := server.Server{
 		Logger: zap.NewStdLog(logger),
 		ListPingHandler: struct {
 			*server.PlayerList
 			*server.PingInfo
 		}{playerList, serverInfo},
-		LoginHandler: &server.MojangLoginHandler{
+		// banned IP addresses are refused by the game before logging in
+		LoginHandler: g.LoginHandler(&server.MojangLoginHandler{
 			OnlineMode:           config.OnlineMode,
 			EnforceSecureProfile: config.EnforceSecureProfile,
 			Threshold:            config.NetworkCompressionThreshold,
-			LoginChecker:         playerList, // playerList implement LoginChecker interface to limit the maximum number of online players
-		},
-		GamePlay: game.NewGame(logger, config, playerList, serverInfo),
+			LoginChecker:         g, // the game checks the ban list, the whitelist and the maximum number of online players
+		}),
+		GamePlay: g,
 	}
+	// the game is always shut down before exit, so the worlds and players are saved.
+	defer g.Shutdown()
+	go con.Run(logger.Named("console"), g)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// the server is also stopped by the /stop command
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-g.Stopping():
+			cancel()
+		}
+	}()
+
+	host, port := splitListenAddress(logger, config.ListenAddress)
+	if config.RCON.Password != "" {
+		rconPort := config.RCON.Port
+		if rconPort == 0 {
+			rconPort = 25575
+		}
+		go runRCON(ctx, logger.Named("rcon"), stdnet.JoinHostPort(host, strconv.Itoa(rconPort)), config.RCON.Password, g)
+	}
+	if config.EnableQuery {
+		queryPort := config.Query.Port
+		if queryPort == 0 {
+			queryPort = port
+		}
+		q := queryServer{
+			log:      logger.Named("query"),
+			info:     serverInfo,
+			players:  playerList,
+			mapName:  config.LevelName,
+			hostIP:   host,
+			hostPort: port,
+		}
+		if q.hostIP == "" {
+			q.hostIP = "0.0.0.0"
+		}
+		go q.Run(ctx, stdnet.JoinHostPort(host, strconv.Itoa(queryPort)))
+	}
+
 	logger.Info("Start listening", zap.String("address", config.ListenAddress))
-	err = s.Listen(config.ListenAddress)
+	listener, err := net.ListenMC(config.ListenAddress)
 	if err != nil {
 		logger.Error("Server listening error", zap.Error(err))
+		return
+	}
+	go func() {
+		<-ctx.Done()
+		logger.Info("Stopping server")
+		_ = listener.Close()
+	}()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error("Server listening error", zap.Error(err))
+			}
+			return
+		}
+		go s.AcceptConn(&conn)
+	}
+}
+
+// newLogger creates the logger, which writes to the console if it's a terminal, otherwise to stderr.
+func newLogger(con *console) *zap.Logger {
+	config := zap.NewProductionConfig()
+	if *isDebug {
+		config = zap.NewDevelopmentConfig()
+	}
+	if con.term != nil {
+		if err := zap.RegisterSink("console", func(*url.URL) (zap.Sink, error) { return con, nil }); err != nil {
+			panic(err)
+		}
+		config.OutputPaths = []string{"console:"}
+	}
+	return unwrap(config.Build())
+}
+
+// splitListenAddress returns the host and the port of the game, RCON and the query listen on the same host.
+func splitListenAddress(logger *zap.Logger, addr string) (host string, port int) {
+	host, portStr, err := stdnet.SplitHostPort(addr)
+	if err == nil {
+		port, err = strconv.Atoi(portStr)
+	}
+	if err != nil {
+		logger.Warn("Parse listen address error", zap.String("address", addr), zap.Error(err))
+		return "", 25565
 	}
+	return host, port
 }
 
 // printBuildInfo reading compile information of the binary program with runtime/debug package，and print it to log
@@ -0,0 +1,199 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Tnze/go-mc/server"
+)
+
+// Types of the query packets
+const (
+	queryStat      = 0
+	queryHandshake = 9
+)
+
+// queryChallengeLifetime is how often the challenge tokens are cleared, same as vanilla.
+const queryChallengeLifetime = 30 * time.Second
+
+// queryServer answers the GameSpy4 query protocol, which reports the status of the server on UDP.
+type queryServer struct {
+	log      *zap.Logger
+	info     *server.PingInfo
+	players  *server.PlayerList
+	mapName  string
+	hostIP   string
+	hostPort int
+
+	// challenges are the tokens given to the clients in the handshakes, keyed by the address of the client.
+	challengesLock sync.Mutex
+	challenges     map[string]int32
+}
+
+// Run receives the queries until the ctx is done.
+func (q *queryServer) Run(ctx context.Context, addr string) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		q.log.Error("Query listening error", zap.Error(err))
+		return
+	}
+	q.log.Info("Query running", zap.String("address", addr))
+	q.challenges = make(map[string]int32)
+	go q.rotateChallenges(ctx)
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+
+	buf := make([]byte, 1460)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				q.log.Error("Query receiving error", zap.Error(err))
+			}
+			return
+		}
+		resp := q.handle(buf[:n], from.String())
+		if resp == nil {
+			continue
+		}
+		if _, err := conn.WriteTo(resp, from); err != nil {
+			q.log.Debug("Query sending error", zap.Error(err))
+		}
+	}
+}
+
+func (q *queryServer) rotateChallenges(ctx context.Context) {
+	ticker := time.NewTicker(queryChallengeLifetime)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			q.challengesLock.Lock()
+			q.challenges = make(map[string]int32)
+			q.challengesLock.Unlock()
+		}
+	}
+}
+
+// handle returns the response of the request, or nil if the request is invalid.
+func (q *queryServer) handle(req []byte, from string) []byte {
+	// magic, type, session ID
+	if len(req) < 7 || req[0] != 0xFE || req[1] != 0xFD {
+		return nil
+	}
+	typ, sessionID, payload := req[2], req[3:7], req[7:]
+
+	var resp bytes.Buffer
+	resp.WriteByte(typ)
+	resp.Write(sessionID)
+	switch typ {
+	case queryHandshake:
+		token, err := newChallengeToken()
+		if err != nil {
+			q.log.Error("Generate challenge token error", zap.Error(err))
+			return nil
+		}
+		q.challengesLock.Lock()
+		q.challenges[from] = token
+		q.challengesLock.Unlock()
+		writeCString(&resp, strconv.FormatInt(int64(token), 10))
+	case queryStat:
+		if len(payload) < 4 || !q.checkChallenge(from, int32(binary.BigEndian.Uint32(payload))) {
+			return nil
+		}
+		// the full stat is requested with 4 bytes padding after the token
+		if len(payload) >= 8 {
+			q.writeFullStat(&resp)
+		} else {
+			q.writeBasicStat(&resp)
+		}
+	default:
+		return nil
+	}
+	return resp.Bytes()
+}
+
+func (q *queryServer) checkChallenge(from string, token int32) bool {
+	q.challengesLock.Lock()
+	defer q.challengesLock.Unlock()
+	v, ok := q.challenges[from]
+	return ok && v == token
+}
+
+func newChallengeToken() (int32, error) {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, err
+	}
+	return int32(binary.BigEndian.Uint32(b[:]) & 0x7FFFFFFF), nil
+}
+
+func (q *queryServer) writeBasicStat(w *bytes.Buffer) {
+	writeCString(w, q.info.Description().ClearString())
+	writeCString(w, "SMP")
+	writeCString(w, q.mapName)
+	writeCString(w, strconv.Itoa(q.players.Len()))
+	writeCString(w, strconv.Itoa(q.players.MaxPlayer()))
+	_ = binary.Write(w, binary.LittleEndian, uint16(q.hostPort))
+	writeCString(w, q.hostIP)
+}
+
+func (q *queryServer) writeFullStat(w *bytes.Buffer) {
+	w.WriteString("splitnum\x00\x80\x00")
+	for _, kv := range [...][2]string{
+		{"hostname", q.info.Description().ClearString()},
+		{"gametype", "SMP"},
+		{"game_id", "MINECRAFT"},
+		{"version", server.ProtocolName},
+		{"plugins", q.info.Name()},
+		{"map", q.mapName},
+		{"numplayers", strconv.Itoa(q.players.Len())},
+		{"maxplayers", strconv.Itoa(q.players.MaxPlayer())},
+		{"hostport", strconv.Itoa(q.hostPort)},
+		{"hostip", q.hostIP},
+	} {
+		writeCString(w, kv[0])
+		writeCString(w, kv[1])
+	}
+	w.WriteByte(0)
+
+	w.WriteString("\x01player_\x00\x00")
+	q.players.Range(func(_ server.PlayerListClient, sample server.PlayerSample) {
+		writeCString(w, sample.Name)
+	})
+	w.WriteByte(0)
+}
+
+// writeCString writes the string terminated by a zero byte.
+func writeCString(w *bytes.Buffer, s string) {
+	w.WriteString(s)
+	w.WriteByte(0)
+}
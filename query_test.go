@@ -0,0 +1,120 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"testing"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/Tnze/go-mc/chat"
+	"github.com/Tnze/go-mc/server"
+)
+
+type testListClient struct{}
+
+func (testListClient) SendDisconnect(chat.Message) {}
+
+func newTestQueryServer() *queryServer {
+	players := server.NewPlayerList(20)
+	players.ClientJoin(testListClient{}, server.PlayerSample{Name: "Steve", ID: uuid.New()})
+	return &queryServer{
+		log:        zap.NewNop(),
+		info:       server.NewPingInfo("go-mc", 762, chat.Text("A Minecraft Server"), nil),
+		players:    players,
+		mapName:    "world",
+		hostIP:     "127.0.0.1",
+		hostPort:   25565,
+		challenges: make(map[string]int32),
+	}
+}
+
+var testSessionID = []byte{0x00, 0x00, 0x00, 0x01}
+
+func queryRequest(typ byte, payload ...byte) []byte {
+	req := append([]byte{0xFE, 0xFD, typ}, testSessionID...)
+	return append(req, payload...)
+}
+
+// handshake returns the challenge token given to the address.
+func handshake(t *testing.T, q *queryServer, from string) []byte {
+	resp := q.handle(queryRequest(queryHandshake), from)
+	prefix := append([]byte{queryHandshake}, testSessionID...)
+	if !bytes.HasPrefix(resp, prefix) || resp[len(resp)-1] != 0 {
+		t.Fatalf("got handshake response %q", resp)
+	}
+	token, err := strconv.ParseInt(string(resp[len(prefix):len(resp)-1]), 10, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return binary.BigEndian.AppendUint32(nil, uint32(token))
+}
+
+func TestQueryServer_invalid(t *testing.T) {
+	q := newTestQueryServer()
+	token := handshake(t, q, "127.0.0.1:1000")
+	for _, tt := range []struct {
+		name string
+		req  []byte
+		from string
+	}{
+		{"empty", nil, "127.0.0.1:1000"},
+		{"short", []byte{0xFE, 0xFD, queryHandshake, 0}, "127.0.0.1:1000"},
+		{"magic", append([]byte{0xFE, 0xFE, queryHandshake}, testSessionID...), "127.0.0.1:1000"},
+		{"unknown type", queryRequest(1), "127.0.0.1:1000"},
+		{"missing token", queryRequest(queryStat), "127.0.0.1:1000"},
+		{"wrong token", queryRequest(queryStat, token[0]^1, token[1], token[2], token[3]), "127.0.0.1:1000"},
+		{"another address", queryRequest(queryStat, token...), "127.0.0.1:1001"},
+	} {
+		if resp := q.handle(tt.req, tt.from); resp != nil {
+			t.Errorf("%s: got response %q", tt.name, resp)
+		}
+	}
+}
+
+func TestQueryServer_basicStat(t *testing.T) {
+	q := newTestQueryServer()
+	token := handshake(t, q, "127.0.0.1:1000")
+	want := append([]byte{queryStat}, testSessionID...)
+	want = append(want, "A Minecraft Server\x00SMP\x00world\x001\x0020\x00\xDD\x63127.0.0.1\x00"...)
+	if got := q.handle(queryRequest(queryStat, token...), "127.0.0.1:1000"); !bytes.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestQueryServer_fullStat(t *testing.T) {
+	q := newTestQueryServer()
+	token := handshake(t, q, "127.0.0.1:1000")
+	want := append([]byte{queryStat}, testSessionID...)
+	want = append(want, "splitnum\x00\x80\x00"+
+		"hostname\x00A Minecraft Server\x00gametype\x00SMP\x00game_id\x00MINECRAFT\x00"+
+		"version\x00"+server.ProtocolName+"\x00plugins\x00go-mc\x00map\x00world\x00"+
+		"numplayers\x001\x00maxplayers\x0020\x00hostport\x0025565\x00hostip\x00127.0.0.1\x00\x00"+
+		"\x01player_\x00\x00Steve\x00\x00"...)
+	req := queryRequest(queryStat, append(token, 0, 0, 0, 0)...)
+	if got := q.handle(req, "127.0.0.1:1000"); !bytes.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// a new handshake replaces the token
+	if newToken := handshake(t, q, "127.0.0.1:1000"); !bytes.Equal(newToken, token) && q.handle(req, "127.0.0.1:1000") != nil {
+		t.Error("the old token is accepted")
+	}
+}
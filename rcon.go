@@ -0,0 +1,148 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+
+	"github.com/Tnze/go-mc/chat"
+	"github.com/Tnze/go-mc/net"
+	"github.com/go-mc/server/game"
+)
+
+// Types of the RCON packets
+const (
+	rconResponse     = 0
+	rconCommand      = 2
+	rconAuthResponse = 2
+	rconLogin        = 3
+)
+
+// rconMaxPayload is the max size of the payload in a response packet, longer responses are split into multiple packets.
+const rconMaxPayload = net.MaxRCONPackageSize - 4 - 4 - 2
+
+// runRCON accepts the RCON clients until the ctx is done.
+func runRCON(ctx context.Context, logger *zap.Logger, addr, password string, g *game.Game) {
+	listener, err := net.ListenRCON(addr)
+	if err != nil {
+		logger.Error("RCON listening error", zap.Error(err))
+		return
+	}
+	logger.Info("RCON running", zap.String("address", addr))
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error("RCON listening error", zap.Error(err))
+			}
+			return
+		}
+		go serveRCON(ctx, logger, conn.(*net.RCONConn), password, g)
+	}
+}
+
+func serveRCON(ctx context.Context, logger *zap.Logger, conn *net.RCONConn, password string, g *game.Game) {
+	logger = logger.With(zap.String("addr", conn.RemoteAddr().String()))
+	// the connection is closed when the server stops
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		_ = conn.Close()
+	}()
+
+	var authed bool
+	for {
+		id, typ, payload, err := conn.ReadPacket()
+		if err != nil {
+			logger.Debug("RCON connection closed", zap.Error(err))
+			return
+		}
+		switch {
+		case typ == rconLogin:
+			authed = subtle.ConstantTimeCompare([]byte(payload), []byte(password)) == 1
+			if !authed {
+				logger.Warn("RCON login with wrong password")
+				id = -1
+			}
+			err = conn.WritePacket(id, rconAuthResponse, "")
+		case typ == rconCommand && authed:
+			command := strings.TrimPrefix(payload, "/")
+			logger.Info("RCON issued command", zap.String("command", command))
+			var src rconSource
+			g.Commands().Execute(&src, command)
+			err = writeRCONResponse(conn, id, src.output.String())
+		case typ == rconCommand:
+			err = conn.WritePacket(-1, rconAuthResponse, "")
+		case typ == rconResponse:
+			// clients send an empty response after a command, and take it back as the end of a multi-packet response.
+			err = conn.WritePacket(id, rconResponse, "")
+		default:
+			err = conn.WritePacket(id, rconResponse, "Unknown request "+strconv.FormatInt(int64(typ), 16))
+		}
+		if err != nil {
+			logger.Debug("RCON write error", zap.Error(err))
+			return
+		}
+	}
+}
+
+// writeRCONResponse sends the response, split into packets if it's too long.
+func writeRCONResponse(conn *net.RCONConn, id int32, resp string) error {
+	for {
+		n := len(resp)
+		if n > rconMaxPayload {
+			// don't cut a UTF-8 character into two packets
+			n = rconMaxPayload
+			for n > 0 && !utf8.RuneStart(resp[n]) {
+				n--
+			}
+		}
+		if err := conn.WritePacket(id, rconResponse, resp[:n]); err != nil {
+			return err
+		}
+		if resp = resp[n:]; resp == "" {
+			return nil
+		}
+	}
+}
+
+// rconSource is the CommandSource of the commands sent by RCON clients, the messages are collected as the response.
+type rconSource struct {
+	output strings.Builder
+}
+
+func (*rconSource) Name() string           { return "Rcon" }
+func (*rconSource) PermissionLevel() int32 { return game.PermissionOwner }
+
+func (s *rconSource) SendMessage(msg chat.Message) {
+	s.output.WriteString(msg.ClearString())
+	s.output.WriteByte('\n')
+}
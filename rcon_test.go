@@ -0,0 +1,88 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	mcnet "github.com/Tnze/go-mc/net"
+)
+
+// readRCONResponse reads the packets of the response until the total length reaches n.
+func readRCONResponse(t *testing.T, conn *mcnet.RCONConn, n int) []string {
+	var payloads []string
+	for total := 0; total < n || len(payloads) == 0; {
+		id, typ, payload, err := conn.ReadPacket()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != 42 || typ != rconResponse {
+			t.Fatalf("got packet %d of type %d, want 42 of type %d", id, typ, rconResponse)
+		}
+		payloads = append(payloads, payload)
+		total += len(payload)
+	}
+	return payloads
+}
+
+func TestWriteRCONResponse(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		resp    string
+		packets int
+	}{
+		{"empty", "", 1},
+		{"short", "There are 0 of a max of 20 players online: \n", 1},
+		{"max", strings.Repeat("a", rconMaxPayload), 1},
+		{"split", strings.Repeat("a", rconMaxPayload+1), 2},
+		{"three packets", strings.Repeat("a", 2*rconMaxPayload+1), 3},
+		// the multi-byte characters cross the boundary of the packets
+		{"UTF-8", strings.Repeat("a", rconMaxPayload-1) + strings.Repeat("你好", 2000), 4},
+		{"emoji", strings.Repeat("😀", rconMaxPayload), 5},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer client.Close()
+			errCh := make(chan error, 1)
+			go func() {
+				errCh <- writeRCONResponse(&mcnet.RCONConn{Conn: server}, 42, tt.resp)
+				_ = server.Close()
+			}()
+			payloads := readRCONResponse(t, &mcnet.RCONConn{Conn: client}, len(tt.resp))
+			if err := <-errCh; err != nil {
+				t.Fatal(err)
+			}
+			if len(payloads) != tt.packets {
+				t.Errorf("got %d packets, want %d", len(payloads), tt.packets)
+			}
+			for i, v := range payloads {
+				if len(v) > rconMaxPayload {
+					t.Errorf("packet %d: %d bytes is too long", i, len(v))
+				}
+				if !utf8.ValidString(v) {
+					t.Errorf("packet %d isn't valid UTF-8", i)
+				}
+			}
+			if got := strings.Join(payloads, ""); got != tt.resp {
+				t.Error("the joined packets are different from the response")
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package world
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/Tnze/go-mc/level"
+	"github.com/Tnze/go-mc/level/block"
+)
+
+// BlockChange is a block state to be set at the position.
+type BlockChange struct {
+	Pos   [3]int32
+	State block.StateID
+}
+
+// GetBlock returns the block state at the position.
+// The second return value is false if the chunk isn't loaded or the position is out of the world.
+func (w *World) GetBlock(pos [3]int32) (block.StateID, bool) {
+	w.tickLock.Lock()
+	defer w.tickLock.Unlock()
+	return w.getBlock(pos)
+}
+
+// getBlock is GetBlock without locking the World, for the tick goroutine.
+func (w *World) getBlock(pos [3]int32) (block.StateID, bool) {
+	lc, ok := w.chunks[[2]int32{pos[0] >> 4, pos[2] >> 4}]
+	if !ok {
+		return 0, false
+	}
+	lc.Lock()
+	defer lc.Unlock()
+	sec, i, ok := w.blockIndex(lc.Chunk, pos)
+	if !ok {
+		return 0, false
+	}
+	return sec.GetBlock(i), true
+}
+
+// SetBlock sets the block at the position and notifies all viewers of the chunk.
+// It returns false if the chunk isn't loaded or the position is out of the world.
+func (w *World) SetBlock(pos [3]int32, state block.StateID) bool {
+	return w.SetBlocks([]BlockChange{{Pos: pos, State: state}}) == 1
+}
+
+// SetBlocks sets the blocks in batch and returns the number of blocks that are set.
+// Changes in the same chunk section are sent to the viewers with one packet.
+// Changes in chunks not loaded are ignored.
+//
+// SetBlock and SetBlocks lock the World, so they must not be called in the tick goroutine.
+func (w *World) SetBlocks(changes []BlockChange) (n int) {
+	w.tickLock.Lock()
+	defer w.tickLock.Unlock()
+	sections := make(map[[3]int32][]BlockChange)
+	for _, change := range changes {
+		secPos := [3]int32{change.Pos[0] >> 4, change.Pos[1] >> 4, change.Pos[2] >> 4}
+		sections[secPos] = append(sections[secPos], change)
+	}
+	for secPos, changes := range sections {
+		lc, ok := w.chunks[[2]int32{secPos[0], secPos[2]}]
+		if !ok {
+			continue
+		}
+		n += w.setSectionBlocks(lc, secPos, changes)
+	}
+	return
+}
+
+func (w *World) setSectionBlocks(lc *LoadedChunk, secPos [3]int32, changes []BlockChange) int {
+	lc.Lock()
+	defer lc.Unlock()
+	applied := changes[:0:0]
+	for _, change := range changes {
+		sec, i, ok := w.blockIndex(lc.Chunk, change.Pos)
+		if !ok {
+			continue
+		}
+		sec.SetBlock(i, change.State)
+		w.updateHeightMaps(lc.Chunk, change.Pos, change.State)
+		applied = append(applied, change)
+	}
+	if len(applied) == 0 {
+		return 0
+	}
+	lc.MarkDirty()
+	for _, viewer := range lc.viewers {
+		if len(applied) == 1 {
+			viewer.ViewBlockUpdate(applied[0].Pos, applied[0].State)
+		} else {
+			viewer.ViewSectionBlocksUpdate(secPos, applied)
+		}
+	}
+	return len(applied)
+}
+
+// blockIndex finds the section containing the position and the index of the block in the section.
+func (w *World) blockIndex(c *level.Chunk, pos [3]int32) (*level.Section, int, bool) {
+	y := pos[1] - w.minY
+	if y < 0 || int(y>>4) >= len(c.Sections) {
+		return nil, 0, false
+	}
+	return &c.Sections[y>>4], int((y&15)<<8 | (pos[2]&15)<<4 | pos[0]&15), true
+}
+
+// updateHeightMaps keeps the heightmaps of the chunk valid after the block at pos is set to state.
+// The heightmaps only used by the world generation are left unchanged.
+func (w *World) updateHeightMaps(c *level.Chunk, pos [3]int32, state block.StateID) {
+	for _, v := range [...]struct {
+		hm        *level.BitStorage
+		predicate func(block.StateID) bool
+	}{
+		{c.HeightMaps.WorldSurface, func(s block.StateID) bool { return !block.IsAir(s) }},
+		{c.HeightMaps.OceanFloor, func(s block.StateID) bool { return blockProperties[s]&blocksMotion != 0 }},
+		{c.HeightMaps.MotionBlocking, func(s block.StateID) bool { return blockProperties[s]&(blocksMotion|hasFluid) != 0 }},
+		{c.HeightMaps.MotionBlockingNoLeaves, func(s block.StateID) bool {
+			return blockProperties[s]&(blocksMotion|hasFluid) != 0 && blockProperties[s]&isLeaves == 0
+		}},
+	} {
+		w.updateHeightMap(c, v.hm, v.predicate, pos, state)
+	}
+}
+
+// updateHeightMap keeps the heightmap as the height above the highest block matching the predicate.
+func (w *World) updateHeightMap(c *level.Chunk, hm *level.BitStorage, predicate func(block.StateID) bool, pos [3]int32, state block.StateID) {
+	i := int((pos[2]&15)<<4 | pos[0]&15)
+	h := int(pos[1]-w.minY) + 1
+	height := hm.Get(i)
+	switch {
+	case predicate(state) && h > height:
+		height = h
+	case !predicate(state) && h == height:
+		// the top block is removed, find the next matching block below it.
+		for height--; height > 0; height-- {
+			sec, j, _ := w.blockIndex(c, [3]int32{pos[0], int32(height-1) + w.minY, pos[2]})
+			if predicate(sec.GetBlock(j)) {
+				break
+			}
+		}
+	default:
+		return
+	}
+	hm.Set(i, height)
+}
+
+// Properties of block states used by the heightmaps
+const (
+	blocksMotion = 1 << iota
+	hasFluid
+	isLeaves
+)
+
+// blockProperties is indexed by the block state ID.
+var blockProperties = func() []byte {
+	props := make([]byte, len(block.StateList))
+	for i, b := range block.StateList {
+		name := strings.TrimPrefix(b.ID(), "minecraft:")
+		if !block.IsAirBlock(b) && !isNonSolid(name) {
+			props[i] |= blocksMotion
+		}
+		switch name {
+		case "water", "lava", "bubble_column", "kelp", "kelp_plant", "seagrass", "tall_seagrass":
+			props[i] |= hasFluid
+		default:
+			if v := reflect.ValueOf(b).FieldByName("Waterlogged"); v.IsValid() && v.Bool() {
+				props[i] |= hasFluid
+			}
+		}
+		if strings.HasSuffix(name, "_leaves") {
+			props[i] |= isLeaves
+		}
+	}
+	return props
+}()
+
+// nonSolidBlocks are the blocks which don't block motion, like plants and decorations.
+// Blocks with these suffixes are also included.
+var nonSolidBlocks = map[string]bool{
+	"structure_void": true, "water": true, "lava": true, "bubble_column": true, "fire": true, "soul_fire": true,
+	"nether_portal": true, "end_portal": true, "end_gateway": true, "cobweb": true, "snow": true, "ladder": true,
+	"grass": true, "fern": true, "tall_grass": true, "large_fern": true, "dead_bush": true,
+	"seagrass": true, "tall_seagrass": true, "kelp": true, "kelp_plant": true,
+	"dandelion": true, "poppy": true, "blue_orchid": true, "allium": true, "azure_bluet": true,
+	"oxeye_daisy": true, "cornflower": true, "lily_of_the_valley": true, "wither_rose": true, "torchflower": true,
+	"sunflower": true, "lilac": true, "rose_bush": true, "peony": true, "mangrove_propagule": true,
+	"brown_mushroom": true, "red_mushroom": true, "crimson_fungus": true, "warped_fungus": true,
+	"crimson_roots": true, "warped_roots": true, "nether_sprouts": true, "hanging_roots": true, "spore_blossom": true,
+	"wheat": true, "carrots": true, "potatoes": true, "beetroots": true, "torchflower_crop": true, "nether_wart": true,
+	"melon_stem": true, "pumpkin_stem": true, "attached_melon_stem": true, "attached_pumpkin_stem": true,
+	"sweet_berry_bush": true, "sugar_cane": true, "vine": true, "glow_lichen": true, "sculk_vein": true,
+	"weeping_vines": true, "weeping_vines_plant": true, "twisting_vines": true, "twisting_vines_plant": true,
+	"cave_vines": true, "cave_vines_plant": true,
+	"torch": true, "wall_torch": true, "soul_torch": true, "soul_wall_torch": true,
+	"redstone_torch": true, "redstone_wall_torch": true, "lever": true, "redstone_wire": true,
+	"tripwire": true, "tripwire_hook": true, "rail": true, "powered_rail": true, "detector_rail": true, "activator_rail": true,
+	"repeater": true, "comparator": true, "flower_pot": true, "scaffolding": true,
+}
+
+var nonSolidSuffixes = []string{"_sapling", "_tulip", "_button", "_sign", "_carpet", "_head", "_skull"}
+
+func isNonSolid(name string) bool {
+	if nonSolidBlocks[name] || strings.HasPrefix(name, "potted_") {
+		return true
+	}
+	for _, suffix := range nonSolidSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package world
+
+import (
+	"testing"
+
+	"github.com/Tnze/go-mc/level"
+	"github.com/Tnze/go-mc/level/block"
+)
+
+// testChunkViewer records the block updates it receives.
+type testChunkViewer struct {
+	blocks   [][3]int32
+	sections [][]BlockChange
+}
+
+func (v *testChunkViewer) ViewChunkLoad(level.ChunkPos, *level.Chunk) {}
+func (v *testChunkViewer) ViewChunkUnload(level.ChunkPos)             {}
+func (v *testChunkViewer) ViewBlockUpdate(pos [3]int32, _ block.StateID) {
+	v.blocks = append(v.blocks, pos)
+}
+
+func (v *testChunkViewer) ViewSectionBlocksUpdate(_ [3]int32, changes []BlockChange) {
+	v.sections = append(v.sections, changes)
+}
+
+func TestWorld_SetBlock(t *testing.T) {
+	w := newTestWorld(t, newTestProvider(t))
+	if !w.loadChunk([2]int32{-1, 0}) {
+		t.Fatal("the chunk isn't loaded")
+	}
+	stone := block.ToStateID[block.Stone{}]
+	for _, tt := range []struct {
+		pos [3]int32
+		ok  bool
+	}{
+		{[3]int32{-16, -64, 0}, true},
+		{[3]int32{-1, 319, 15}, true},
+		{[3]int32{-8, 0, 8}, true},
+		{[3]int32{-8, -65, 8}, false},
+		{[3]int32{-8, 320, 8}, false},
+		{[3]int32{0, 0, 0}, false}, // not loaded
+	} {
+		if ok := w.SetBlock(tt.pos, stone); ok != tt.ok {
+			t.Errorf("SetBlock(%v) = %v, want %v", tt.pos, ok, tt.ok)
+		}
+		got, ok := w.GetBlock(tt.pos)
+		if ok != tt.ok || ok && got != stone {
+			t.Errorf("GetBlock(%v) = %d %v, want stone %v", tt.pos, got, ok, tt.ok)
+		}
+	}
+	if !w.chunks[[2]int32{-1, 0}].dirty {
+		t.Error("the chunk isn't marked dirty")
+	}
+}
+
+func TestWorld_SetBlocks(t *testing.T) {
+	w := newTestWorld(t, newTestProvider(t))
+	if !w.loadChunk([2]int32{0, 0}) {
+		t.Fatal("the chunk isn't loaded")
+	}
+	v := &testChunkViewer{}
+	w.chunks[[2]int32{0, 0}].AddViewer(v)
+	stone := block.ToStateID[block.Stone{}]
+	n := w.SetBlocks([]BlockChange{
+		{Pos: [3]int32{1, 1, 1}, State: stone},
+		{Pos: [3]int32{2, 2, 2}, State: stone},
+		{Pos: [3]int32{3, 16, 3}, State: stone},  // another section
+		{Pos: [3]int32{16, 1, 1}, State: stone},  // not loaded
+		{Pos: [3]int32{1, 400, 1}, State: stone}, // out of the world
+	})
+	if n != 3 {
+		t.Errorf("got %d blocks set, want 3", n)
+	}
+	if len(v.sections) != 1 || len(v.sections[0]) != 2 {
+		t.Errorf("got section updates %v, want one with 2 blocks", v.sections)
+	}
+	if len(v.blocks) != 1 || v.blocks[0] != [3]int32{3, 16, 3} {
+		t.Errorf("got block updates %v, want the one in another section", v.blocks)
+	}
+}
+
+func TestWorld_updateHeightMaps(t *testing.T) {
+	w := newTestWorld(t, newTestProvider(t))
+	if !w.loadChunk([2]int32{0, 0}) {
+		t.Fatal("the chunk isn't loaded")
+	}
+	hm := &w.chunks[[2]int32{0, 0}].HeightMaps
+	var leaves block.StateID
+	for i, b := range block.StateList {
+		if b.ID() == "minecraft:oak_leaves" {
+			leaves = block.StateID(i)
+			break
+		}
+	}
+	var (
+		stone = block.ToStateID[block.Stone{}]
+		grass = block.ToStateID[block.Grass{}]
+		water = block.ToStateID[block.Water{}]
+		air   = block.ToStateID[block.Air{}]
+	)
+	// the heights above the flat ground at Y -61
+	const ground = 4
+	i := 7*16 + 5
+	for _, tt := range []struct {
+		name  string
+		y     int32
+		state block.StateID
+		// WorldSurface, OceanFloor, MotionBlocking, MotionBlockingNoLeaves
+		want [4]int
+	}{
+		{"stone", 0, stone, [4]int{65, 65, 65, 65}},
+		{"grass", 10, grass, [4]int{75, 65, 65, 65}},
+		{"leaves", 20, leaves, [4]int{85, 85, 85, 65}},
+		{"water", 30, water, [4]int{95, 85, 95, 95}},
+		{"below the surface", 5, stone, [4]int{95, 85, 95, 95}},
+		{"remove water", 30, air, [4]int{85, 85, 85, 70}},
+		{"remove leaves", 20, air, [4]int{75, 70, 70, 70}},
+		{"remove grass", 10, air, [4]int{70, 70, 70, 70}},
+		{"remove stone below the surface", 5, air, [4]int{65, 65, 65, 65}},
+		{"remove stone", 0, air, [4]int{ground, ground, ground, ground}},
+	} {
+		if !w.SetBlock([3]int32{5, tt.y, 7}, tt.state) {
+			t.Fatalf("%s: the block isn't set", tt.name)
+		}
+		got := [4]int{hm.WorldSurface.Get(i), hm.OceanFloor.Get(i), hm.MotionBlocking.Get(i), hm.MotionBlockingNoLeaves.Get(i)}
+		if got != tt.want {
+			t.Errorf("%s: got heightmaps %v, want %v", tt.name, got, tt.want)
+		}
+		// the heightmaps of the world generation are not changed
+		if hm.WorldSurfaceWG.Get(i) != ground || hm.OceanFloorWG.Get(i) != ground {
+			t.Errorf("%s: the heightmaps of the world generation are changed", tt.name)
+		}
+		// other columns are not changed
+		if hm.WorldSurface.Get(i+1) != ground {
+			t.Errorf("%s: the heightmap of another column is changed", tt.name)
+		}
+	}
+}
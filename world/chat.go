@@ -16,17 +16,59 @@
 
 package world
 
-import "time"
+import (
+	"time"
 
-// SetLastChatTimestamp update the lastChatTimestamp and return true if new timestamp is newer than last one.
+	"github.com/Tnze/go-mc/chat/sign"
+)
+
+// SetLastChatTimestamp update the lastChatTimestamp and return true if new timestamp isn't older than last one.
 // Otherwise, didn't update the lastChatTimestamp and return false.
 func (p *Player) SetLastChatTimestamp(t time.Time) bool {
-	if p.lastChatTimestamp.Before(t) {
+	if !t.Before(p.lastChatTimestamp) {
 		p.lastChatTimestamp = t
 		return true
 	}
 	return false
 }
 
-func (p *Player) GetPrevChatSignature() []byte    { return p.lastChatSignature }
-func (p *Player) SetPrevChatSignature(sig []byte) { p.lastChatSignature = sig }
+// ChatSession returns the session signing the messages sent by the player, nil if the player doesn't have one.
+func (p *Player) ChatSession() *sign.Session {
+	p.chatLock.Lock()
+	defer p.chatLock.Unlock()
+	return p.chatSession
+}
+
+// SetChatSession changes the chat session of the player, and starts a new chain of messages.
+func (p *Player) SetChatSession(session *sign.Session) {
+	p.chatLock.Lock()
+	defer p.chatLock.Unlock()
+	p.chatSession = session
+	p.chatIndex = 0
+	p.chatBroken = false
+}
+
+// NextChatLink returns the link of the next signed message, ok is false if the chain is broken.
+// It's only called by the goroutine receiving packets of the player.
+func (p *Player) NextChatLink() (link sign.Prev, ok bool) {
+	p.chatLock.Lock()
+	defer p.chatLock.Unlock()
+	if p.chatSession == nil || p.chatBroken {
+		return sign.Prev{}, false
+	}
+	return sign.Prev{Index: p.chatIndex, Sender: p.UUID, Session: p.chatSession.SessionID}, true
+}
+
+// AdvanceChatChain moves to the next link after a signed message is accepted.
+func (p *Player) AdvanceChatChain() {
+	p.chatLock.Lock()
+	defer p.chatLock.Unlock()
+	p.chatIndex++
+}
+
+// BreakChatChain rejects all the following messages until the player starts a new chat session.
+func (p *Player) BreakChatChain() {
+	p.chatLock.Lock()
+	defer p.chatLock.Unlock()
+	p.chatBroken = true
+}
@@ -19,6 +19,10 @@ package world
 import (
 	"math"
 	"sync/atomic"
+
+	"github.com/google/uuid"
+
+	"github.com/go-mc/server/world/entity"
 )
 
 var entityCounter atomic.Int32
@@ -27,13 +31,50 @@ func NewEntityID() int32 {
 	return entityCounter.Add(1)
 }
 
+// Animations of ClientboundAnimate
+const (
+	AnimationSwingMainArm = 0
+	AnimationWakeUp       = 2
+	AnimationSwingOffhand = 3
+	// AnimationCriticalEffect and AnimationMagicCriticalEffect show the particles of critical hits and enchanted hits.
+	AnimationCriticalEffect      = 4
+	AnimationMagicCriticalEffect = 5
+)
+
 type Entity struct {
 	EntityID int32
 	Position
 	Rotation
 	OnGround
-	pos0 Position
-	rot0 Rotation
+	// Metadata is only accessed in the tick goroutine, the changes are sent to the viewers every tick.
+	Metadata entity.Metadata
+	pos0     Position
+	rot0     Rotation
+}
+
+// GenericEntity is an entity other than players, like items, projectiles and mobs, which is owned by a World.
+// After being added to the world, it's only accessed in the tick goroutine, see World.UpdateEntity.
+type GenericEntity struct {
+	Entity
+	UUID uuid.UUID
+	// Type is the ID of the entity type, see package github.com/Tnze/go-mc/data/entity.
+	Type int32
+	// Data is sent with the entity when it's added, the meaning depends on the type.
+	Data int32
+	// Velocity is in blocks per tick, the entity is moved by it every tick.
+	Velocity [3]float64
+}
+
+// Move changes the position and the rotation of the entity, which are sent to the players in the next tick.
+func (e *GenericEntity) Move(pos Position, rot Rotation) {
+	e.pos0, e.rot0 = pos, rot
+}
+
+// tickMovement moves the entity by the velocity.
+func (e *GenericEntity) tickMovement() {
+	for i := range e.pos0 {
+		e.pos0[i] += e.Velocity[i]
+	}
 }
 
 type (
@@ -0,0 +1,96 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package entity
+
+// Fields of all entities
+const (
+	SharedFlags       Field[Byte]    = 0
+	AirSupply         Field[VarInt]  = 1
+	CustomName        Field[OptChat] = 2
+	CustomNameVisible Field[Boolean] = 3
+	Silent            Field[Boolean] = 4
+	NoGravity         Field[Boolean] = 5
+	EntityPose        Field[Pose]    = 6
+	TicksFrozen       Field[VarInt]  = 7
+)
+
+// Bits of SharedFlags
+const (
+	FlagOnFire     Byte = 0x01
+	FlagCrouching  Byte = 0x02
+	FlagSprinting  Byte = 0x08
+	FlagSwimming   Byte = 0x10
+	FlagInvisible  Byte = 0x20
+	FlagGlowing    Byte = 0x40
+	FlagFallFlying Byte = 0x80
+)
+
+// Fields of living entities, following the fields of all entities
+const (
+	LivingFlags    Field[Byte]        = 8
+	Health         Field[Float]       = 9
+	EffectColor    Field[VarInt]      = 10
+	EffectAmbience Field[Boolean]     = 11
+	ArrowCount     Field[VarInt]      = 12
+	StingerCount   Field[VarInt]      = 13
+	SleepingPos    Field[OptBlockPos] = 14
+)
+
+// Bits of LivingFlags
+const (
+	FlagUsingItem     Byte = 0x01
+	FlagOffHand       Byte = 0x02
+	FlagSpinAttacking Byte = 0x04
+)
+
+// Fields of players, following the fields of living entities
+const (
+	AdditionalHearts Field[Float]  = 15
+	Score            Field[VarInt] = 16
+	SkinParts        Field[Byte]   = 17
+	MainHand         Field[Byte]   = 18
+	LeftShoulder     Field[NBT]    = 19
+	RightShoulder    Field[NBT]    = 20
+)
+
+// Fields of mobs, following the fields of living entities
+const (
+	MobFlags Field[Byte] = 15
+)
+
+// Bits of MobFlags
+const (
+	FlagNoAI       Byte = 0x01
+	FlagLeftHanded Byte = 0x02
+	FlagAggressive Byte = 0x04
+)
+
+// Fields of dropped items, following the fields of all entities
+const (
+	ItemStack Field[Slot] = 8
+)
+
+// SetFlag sets or clears the bits of a flags field.
+func SetFlag(m *Metadata, field Field[Byte], flag Byte, on bool) {
+	v := field.Get(m)
+	if on {
+		v |= flag
+	} else {
+		v &^= flag
+	}
+	field.Set(m, v)
+}
@@ -18,7 +18,12 @@ package entity
 
 import (
 	"io"
+	"reflect"
+	"sort"
 
+	"github.com/google/uuid"
+
+	"github.com/Tnze/go-mc/chat"
 	pk "github.com/Tnze/go-mc/net/packet"
 )
 
@@ -38,6 +43,7 @@ func (m MetadataSet) WriteTo(w io.Writer) (n int64, err error) {
 			return
 		}
 		tmpN, err = v.WriteTo(w)
+		n += tmpN
 		if err != nil {
 			return
 		}
@@ -55,31 +61,242 @@ func (m *MetadataField) WriteTo(w io.Writer) (n int64, err error) {
 	return n1 + n2, err
 }
 
+// MetadataValue is a value of the entity metadata, the TypeID is the ID of its serializer in the protocol.
 type MetadataValue interface {
 	TypeID() int32
-	pk.Field
+	pk.FieldEncoder
+}
+
+// Metadata is the metadata of an entity. The changed fields are tracked, so only they are sent to the viewers.
+// The zero value is empty and ready to use.
+type Metadata struct {
+	values map[byte]MetadataValue
+	dirty  map[byte]bool
+}
+
+// Get returns the value of the field, nil if it isn't set.
+func (m *Metadata) Get(index byte) MetadataValue { return m.values[index] }
+
+// Set changes the value of the field, which is marked dirty if the value is different.
+func (m *Metadata) Set(index byte, v MetadataValue) {
+	if old, ok := m.values[index]; ok && reflect.DeepEqual(old, v) {
+		return
+	}
+	if m.values == nil {
+		m.values = make(map[byte]MetadataValue)
+		m.dirty = make(map[byte]bool)
+	}
+	m.values[index] = v
+	m.dirty[index] = true
+}
+
+// All returns all the fields, which are sent when a viewer starts seeing the entity.
+func (m *Metadata) All() MetadataSet {
+	return m.collect(func(byte) bool { return true })
+}
+
+// Dirty returns the fields changed since the last call of ClearDirty.
+func (m *Metadata) Dirty() MetadataSet {
+	return m.collect(func(index byte) bool { return m.dirty[index] })
+}
+
+// ClearDirty marks all the fields unchanged, after the changes are sent to the viewers.
+func (m *Metadata) ClearDirty() {
+	for index := range m.dirty {
+		delete(m.dirty, index)
+	}
 }
 
+func (m *Metadata) collect(filter func(index byte) bool) MetadataSet {
+	var set MetadataSet
+	for index, v := range m.values {
+		if filter(index) {
+			set = append(set, MetadataField{Index: index, MetadataValue: v})
+		}
+	}
+	sort.Slice(set, func(i, j int) bool { return set[i].Index < set[j].Index })
+	return set
+}
+
+// Field is a metadata field of an entity class, the value of which has the type T.
+// The value is the index of the field.
+type Field[T MetadataValue] byte
+
+// Get returns the value of the field, or the zero value if it isn't set.
+func (f Field[T]) Get(m *Metadata) (v T) {
+	v, _ = m.Get(byte(f)).(T)
+	return
+}
+
+func (f Field[T]) Set(m *Metadata, v T) { m.Set(byte(f), v) }
+
+// Metadata serializers of the protocol
 type (
-	Byte struct{ pk.Byte }
-	// VarInt       struct{ pk.VarInt }
-	// Float        struct{ pk.Float }
-	// String       struct{ pk.String }
-	// Chat         struct{ chat.Message }
-	// OptionalChat struct {
-	// 	Exist   bool
-	// 	Message chat.Message
-	// }
-	// Slot     struct{}
-	// Boolean  struct{ pk.Boolean }
-	// Rotation [3]pk.Float
-	// Position struct{ pk.Position }
-
-	Pose int32
+	Byte    byte
+	VarInt  int32
+	VarLong int64
+	Float   float32
+	String  string
+	Chat    struct{ chat.Message }
+	// OptChat is absent if the Message is nil.
+	OptChat struct{ Message *chat.Message }
+	// Slot is an item stack, like world.ItemStack.
+	Slot      struct{ Item pk.FieldEncoder }
+	Boolean   bool
+	Rotations [3]float32
+	BlockPos  [3]int32
+	// OptBlockPos is absent if the Pos is nil.
+	OptBlockPos struct{ Pos *BlockPos }
+	Direction   int32
+	// OptUUID is absent if the UUID is nil.
+	OptUUID    struct{ UUID *uuid.UUID }
+	BlockState int32
+	// OptBlockState is absent if it's 0, which is air.
+	OptBlockState int32
+	NBT           struct{ V any }
+	// Particle is the ID of the particle type and the data depends on the type, which can be nil.
+	Particle struct {
+		ID   int32
+		Data pk.FieldEncoder
+	}
+	VillagerData struct{ Type, Profession, Level int32 }
+	// OptVarInt is absent if the Value is nil.
+	OptVarInt   struct{ Value *int32 }
+	Pose        int32
+	CatVariant  int32
+	FrogVariant int32
+	// OptGlobalPos is absent if the Dimension is empty.
+	OptGlobalPos struct {
+		Dimension string
+		Pos       BlockPos
+	}
+	PaintingVariant int32
+	SnifferState    int32
+	Vector3         [3]float32
+	Quaternion      [4]float32
 )
 
-func (b *Byte) TypeID() int32 { return 0 }
-func (p *Pose) TypeID() int32 { return 18 }
+func (Byte) TypeID() int32            { return 0 }
+func (VarInt) TypeID() int32          { return 1 }
+func (VarLong) TypeID() int32         { return 2 }
+func (Float) TypeID() int32           { return 3 }
+func (String) TypeID() int32          { return 4 }
+func (Chat) TypeID() int32            { return 5 }
+func (OptChat) TypeID() int32         { return 6 }
+func (Slot) TypeID() int32            { return 7 }
+func (Boolean) TypeID() int32         { return 8 }
+func (Rotations) TypeID() int32       { return 9 }
+func (BlockPos) TypeID() int32        { return 10 }
+func (OptBlockPos) TypeID() int32     { return 11 }
+func (Direction) TypeID() int32       { return 12 }
+func (OptUUID) TypeID() int32         { return 13 }
+func (BlockState) TypeID() int32      { return 14 }
+func (OptBlockState) TypeID() int32   { return 15 }
+func (NBT) TypeID() int32             { return 16 }
+func (Particle) TypeID() int32        { return 17 }
+func (VillagerData) TypeID() int32    { return 18 }
+func (OptVarInt) TypeID() int32       { return 19 }
+func (Pose) TypeID() int32            { return 20 }
+func (CatVariant) TypeID() int32      { return 21 }
+func (FrogVariant) TypeID() int32     { return 22 }
+func (OptGlobalPos) TypeID() int32    { return 23 }
+func (PaintingVariant) TypeID() int32 { return 24 }
+func (SnifferState) TypeID() int32    { return 25 }
+func (Vector3) TypeID() int32         { return 26 }
+func (Quaternion) TypeID() int32      { return 27 }
+
+func (v Byte) WriteTo(w io.Writer) (int64, error)    { return pk.UnsignedByte(v).WriteTo(w) }
+func (v VarInt) WriteTo(w io.Writer) (int64, error)  { return pk.VarInt(v).WriteTo(w) }
+func (v VarLong) WriteTo(w io.Writer) (int64, error) { return pk.VarLong(v).WriteTo(w) }
+func (v Float) WriteTo(w io.Writer) (int64, error)   { return pk.Float(v).WriteTo(w) }
+func (v String) WriteTo(w io.Writer) (int64, error)  { return pk.String(v).WriteTo(w) }
+func (v Chat) WriteTo(w io.Writer) (int64, error)    { return v.Message.WriteTo(w) }
+
+func (v OptChat) WriteTo(w io.Writer) (int64, error) {
+	return pk.OptionEncoder[chat.Message]{Has: v.Message != nil, Val: deref(v.Message)}.WriteTo(w)
+}
+
+func (v Slot) WriteTo(w io.Writer) (int64, error) {
+	if v.Item == nil {
+		return pk.Boolean(false).WriteTo(w)
+	}
+	return v.Item.WriteTo(w)
+}
+
+func (v Boolean) WriteTo(w io.Writer) (int64, error) { return pk.Boolean(v).WriteTo(w) }
+
+func (v Rotations) WriteTo(w io.Writer) (int64, error) {
+	return pk.Tuple{pk.Float(v[0]), pk.Float(v[1]), pk.Float(v[2])}.WriteTo(w)
+}
+
+func (v BlockPos) WriteTo(w io.Writer) (int64, error) {
+	return pk.Position{X: int(v[0]), Y: int(v[1]), Z: int(v[2])}.WriteTo(w)
+}
+
+func (v OptBlockPos) WriteTo(w io.Writer) (int64, error) {
+	return pk.OptionEncoder[BlockPos]{Has: v.Pos != nil, Val: deref(v.Pos)}.WriteTo(w)
+}
+
+func (v Direction) WriteTo(w io.Writer) (int64, error) { return pk.VarInt(v).WriteTo(w) }
+
+func (v OptUUID) WriteTo(w io.Writer) (int64, error) {
+	return pk.OptionEncoder[pk.UUID]{Has: v.UUID != nil, Val: pk.UUID(deref(v.UUID))}.WriteTo(w)
+}
+
+func (v BlockState) WriteTo(w io.Writer) (int64, error)    { return pk.VarInt(v).WriteTo(w) }
+func (v OptBlockState) WriteTo(w io.Writer) (int64, error) { return pk.VarInt(v).WriteTo(w) }
+func (v NBT) WriteTo(w io.Writer) (int64, error)           { return pk.NBT(v.V).WriteTo(w) }
+
+func (v Particle) WriteTo(w io.Writer) (int64, error) {
+	n, err := pk.VarInt(v.ID).WriteTo(w)
+	if err != nil || v.Data == nil {
+		return n, err
+	}
+	n1, err := v.Data.WriteTo(w)
+	return n + n1, err
+}
+
+func (v VillagerData) WriteTo(w io.Writer) (int64, error) {
+	return pk.Tuple{pk.VarInt(v.Type), pk.VarInt(v.Profession), pk.VarInt(v.Level)}.WriteTo(w)
+}
+
+// WriteTo encodes the value plus 1, and 0 if it's absent.
+func (v OptVarInt) WriteTo(w io.Writer) (int64, error) {
+	if v.Value == nil {
+		return pk.VarInt(0).WriteTo(w)
+	}
+	return pk.VarInt(*v.Value + 1).WriteTo(w)
+}
+
+func (v Pose) WriteTo(w io.Writer) (int64, error)        { return pk.VarInt(v).WriteTo(w) }
+func (v CatVariant) WriteTo(w io.Writer) (int64, error)  { return pk.VarInt(v).WriteTo(w) }
+func (v FrogVariant) WriteTo(w io.Writer) (int64, error) { return pk.VarInt(v).WriteTo(w) }
+
+func (v OptGlobalPos) WriteTo(w io.Writer) (int64, error) {
+	if v.Dimension == "" {
+		return pk.Boolean(false).WriteTo(w)
+	}
+	return pk.Tuple{pk.Boolean(true), pk.Identifier(v.Dimension), v.Pos}.WriteTo(w)
+}
+
+func (v PaintingVariant) WriteTo(w io.Writer) (int64, error) { return pk.VarInt(v).WriteTo(w) }
+func (v SnifferState) WriteTo(w io.Writer) (int64, error)    { return pk.VarInt(v).WriteTo(w) }
+
+func (v Vector3) WriteTo(w io.Writer) (int64, error) {
+	return pk.Tuple{pk.Float(v[0]), pk.Float(v[1]), pk.Float(v[2])}.WriteTo(w)
+}
+
+func (v Quaternion) WriteTo(w io.Writer) (int64, error) {
+	return pk.Tuple{pk.Float(v[0]), pk.Float(v[1]), pk.Float(v[2]), pk.Float(v[3])}.WriteTo(w)
+}
+
+// deref returns the value of the pointer, or the zero value if it's nil.
+func deref[T any](p *T) (v T) {
+	if p != nil {
+		v = *p
+	}
+	return
+}
 
 const (
 	Standing Pose = iota
@@ -92,11 +309,9 @@ const (
 	Dying
 	Croaking
 	UsingTongue
+	Sitting
 	Roaring
 	Sniffing
 	Emerging
 	Digging
 )
-
-func (p Pose) WriteTo(w io.Writer) (n int64, err error)   { return pk.VarInt(p).WriteTo(w) }
-func (p *Pose) ReadFrom(r io.Reader) (n int64, err error) { return (*pk.VarInt)(p).ReadFrom(r) }
@@ -0,0 +1,115 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package entity
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/Tnze/go-mc/chat"
+)
+
+func TestMetadataField_WriteTo(t *testing.T) {
+	five := int32(5)
+	pos := BlockPos{1, 2, 3}
+	id := uuid.UUID{15: 1}
+	msg := chat.Text("")
+	for _, tt := range []struct {
+		value MetadataValue
+		want  []byte
+	}{
+		{Byte(0x22), []byte{0, 0x22}},
+		{VarInt(300), []byte{1, 0xAC, 0x02}},
+		{VarLong(-1), []byte{2, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x01}},
+		{Float(1), []byte{3, 0x3F, 0x80, 0, 0}},
+		{String("hi"), []byte{4, 2, 'h', 'i'}},
+		{OptChat{}, []byte{6, 0}},
+		{OptChat{Message: &msg}, append([]byte{6, 1}, encode(t, msg)...)},
+		{Slot{}, []byte{7, 0}},
+		{Boolean(true), []byte{8, 1}},
+		{Rotations{0, 0, -2}, []byte{9, 0, 0, 0, 0, 0, 0, 0, 0, 0xC0, 0, 0, 0}},
+		{pos, []byte{10, 0, 0, 0, 0x40, 0, 0, 0x30, 0x02}},
+		{OptBlockPos{}, []byte{11, 0}},
+		{OptBlockPos{Pos: &pos}, []byte{11, 1, 0, 0, 0, 0x40, 0, 0, 0x30, 0x02}},
+		{Direction(5), []byte{12, 5}},
+		{OptUUID{}, []byte{13, 0}},
+		{OptUUID{UUID: &id}, []byte{13, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}},
+		{BlockState(1), []byte{14, 1}},
+		{OptBlockState(0), []byte{15, 0}},
+		{Particle{ID: 3}, []byte{17, 3}},
+		{Particle{ID: 14, Data: BlockState(1)}, []byte{17, 14, 1}},
+		{VillagerData{1, 2, 3}, []byte{18, 1, 2, 3}},
+		{OptVarInt{}, []byte{19, 0}},
+		{OptVarInt{Value: &five}, []byte{19, 6}},
+		{Sleeping, []byte{20, 2}},
+		{OptGlobalPos{}, []byte{23, 0}},
+		{OptGlobalPos{Dimension: "minecraft:overworld", Pos: pos}, append(append([]byte{23, 1, 19}, "minecraft:overworld"...), 0, 0, 0, 0x40, 0, 0, 0x30, 0x02)},
+		{SnifferState(2), []byte{25, 2}},
+		{Vector3{0, 1, 0}, []byte{26, 0, 0, 0, 0, 0x3F, 0x80, 0, 0, 0, 0, 0, 0}},
+		{Quaternion{0, 0, 0, 1}, []byte{27, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x3F, 0x80, 0, 0}},
+	} {
+		field := MetadataField{Index: 0, MetadataValue: tt.value}
+		if got := encode(t, &field); !bytes.Equal(got, tt.want) {
+			t.Errorf("%T %v: got % x, want % x", tt.value, tt.value, got, tt.want)
+		}
+	}
+}
+
+func encode(t *testing.T, v io.WriterTo) []byte {
+	var buf bytes.Buffer
+	if _, err := v.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestMetadata(t *testing.T) {
+	var m Metadata
+	if got := encode(t, m.All()); !bytes.Equal(got, []byte{0xFF}) {
+		t.Errorf("got % x for the empty metadata", got)
+	}
+	if got := Health.Get(&m); got != 0 {
+		t.Errorf("got health %v before it's set", got)
+	}
+	Health.Set(&m, 20)
+	SharedFlags.Set(&m, FlagCrouching)
+	EntityPose.Set(&m, Crouching)
+	want := []byte{0, 0, 0x02, 6, 20, 5, 9, 3, 0x41, 0xA0, 0, 0, 0xFF}
+	if got := encode(t, m.Dirty()); !bytes.Equal(got, want) {
+		t.Errorf("got dirty fields % x, want % x", got, want)
+	}
+	m.ClearDirty()
+	if got := m.Dirty(); len(got) != 0 {
+		t.Errorf("got dirty fields %v after clearing", got)
+	}
+
+	// setting the same value doesn't make the field dirty
+	Health.Set(&m, 20)
+	EntityPose.Set(&m, Standing)
+	if got := encode(t, m.Dirty()); !bytes.Equal(got, []byte{6, 20, 0, 0xFF}) {
+		t.Errorf("got dirty fields % x, want only the pose", got)
+	}
+	if got := len(m.All()); got != 3 {
+		t.Errorf("got %d fields, want 3", got)
+	}
+	if got := Health.Get(&m); got != 20 {
+		t.Errorf("got health %v, want 20", got)
+	}
+}
@@ -0,0 +1,202 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package world
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Tnze/go-mc/level"
+	"github.com/Tnze/go-mc/level/block"
+)
+
+// ChunkGenerator generates the chunks which don't exist in the ChunkProvider.
+// Generate is called in the tick goroutine of the World, so it shouldn't block too long.
+type ChunkGenerator interface {
+	Generate(pos [2]int32) (*level.Chunk, error)
+}
+
+// GeneratorContext describes the world which the generator generates chunks for.
+type GeneratorContext struct {
+	Seed int64
+	// MinY is the Y coordinate of the lowest block, and Height is the number of blocks in a column.
+	// Both are multiples of 16, same as the dimension type.
+	MinY, Height int32
+}
+
+func (ctx *GeneratorContext) sections() int { return int(ctx.Height / 16) }
+
+// GeneratorFactory creates a ChunkGenerator with the world context and the settings read from the config file.
+// The settings may be nil if the user doesn't provide any.
+type GeneratorFactory func(ctx GeneratorContext, settings map[string]any) (ChunkGenerator, error)
+
+var (
+	generatorsLock sync.RWMutex
+	generators     = map[string]GeneratorFactory{
+		"flat":  newFlatGenerator,
+		"void":  newVoidGenerator,
+		"noise": newNoiseGenerator,
+	}
+)
+
+// RegisterGenerator makes a chunk generator available by the provided name.
+// If RegisterGenerator is called twice with the same name, the latter one replaces the former.
+func RegisterGenerator(name string, factory GeneratorFactory) {
+	generatorsLock.Lock()
+	defer generatorsLock.Unlock()
+	generators[name] = factory
+}
+
+// NewGenerator creates the chunk generator registered with the name.
+func NewGenerator(name string, ctx GeneratorContext, settings map[string]any) (ChunkGenerator, error) {
+	generatorsLock.RLock()
+	factory, ok := generators[name]
+	generatorsLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown chunk generator: %q", name)
+	}
+	return factory(ctx, settings)
+}
+
+// VoidGenerator generates nothing but air.
+type VoidGenerator struct {
+	Sections int
+}
+
+func newVoidGenerator(ctx GeneratorContext, _ map[string]any) (ChunkGenerator, error) {
+	return VoidGenerator{Sections: ctx.sections()}, nil
+}
+
+func (g VoidGenerator) Generate([2]int32) (*level.Chunk, error) {
+	c := level.EmptyChunk(g.Sections)
+	c.Status = level.StatusFull
+	return c, nil
+}
+
+// FlatGenerator generates superflat terrain, every chunk is filled by the same layers.
+type FlatGenerator struct {
+	Sections int
+	// Layers are the blocks from the bottom of the world to the top, one block per layer.
+	Layers []block.StateID
+	Biome  level.BiomesState
+}
+
+// DefaultFlatLayers is the layers used when "layers" isn't set in the generator settings.
+const DefaultFlatLayers = "minecraft:bedrock,2*minecraft:dirt,minecraft:grass_block"
+
+// newFlatGenerator reads the settings like:
+//
+//	layers = "minecraft:bedrock,2*minecraft:dirt,minecraft:grass_block"
+//	biome = "minecraft:plains"
+func newFlatGenerator(ctx GeneratorContext, settings map[string]any) (ChunkGenerator, error) {
+	layers, biome := DefaultFlatLayers, "minecraft:plains"
+	if v, ok := settings["layers"]; ok {
+		if layers, ok = v.(string); !ok {
+			return nil, errors.New("flat generator: layers must be a string")
+		}
+	}
+	if v, ok := settings["biome"]; ok {
+		if biome, ok = v.(string); !ok {
+			return nil, errors.New("flat generator: biome must be a string")
+		}
+	}
+	g := &FlatGenerator{Sections: ctx.sections()}
+	var err error
+	if g.Layers, err = ParseFlatLayers(layers); err != nil {
+		return nil, fmt.Errorf("flat generator: %w", err)
+	}
+	if len(g.Layers) > int(ctx.Height) {
+		return nil, fmt.Errorf("flat generator: too many layers: %d", len(g.Layers))
+	}
+	if err = g.Biome.UnmarshalText([]byte(biome)); err != nil {
+		return nil, fmt.Errorf("flat generator: %w: %q", err, biome)
+	}
+	return g, nil
+}
+
+// ParseFlatLayers parses the layers in the format of vanilla superflat preset,
+// which is a comma separated list of block IDs, each may be prefixed by "<height>*".
+func ParseFlatLayers(s string) (layers []block.StateID, err error) {
+	for _, layer := range strings.Split(s, ",") {
+		layer = strings.TrimSpace(layer)
+		height := 1
+		if i := strings.IndexByte(layer, '*'); i >= 0 {
+			height, err = strconv.Atoi(layer[:i])
+			if err != nil || height < 1 {
+				return nil, fmt.Errorf("invalid layer height: %q", layer)
+			}
+			layer = layer[i+1:]
+		}
+		if !strings.Contains(layer, ":") {
+			layer = "minecraft:" + layer
+		}
+		b, ok := block.FromID[layer]
+		if !ok {
+			return nil, fmt.Errorf("unknown block: %q", layer)
+		}
+		state, ok := block.ToStateID[b]
+		if !ok {
+			return nil, fmt.Errorf("unknown block state: %q", layer)
+		}
+		for i := 0; i < height; i++ {
+			layers = append(layers, state)
+		}
+	}
+	return
+}
+
+func (g *FlatGenerator) Generate([2]int32) (*level.Chunk, error) {
+	c := level.EmptyChunk(g.Sections)
+	for i := range c.Sections {
+		c.Sections[i].Biomes = level.NewBiomesPaletteContainer(4*4*4, g.Biome)
+	}
+	top := 0
+	for y, state := range g.Layers {
+		if block.IsAir(state) {
+			continue
+		}
+		top = y + 1
+		sec := &c.Sections[y/16]
+		for i := 0; i < 16*16; i++ {
+			sec.SetBlock((y%16)*16*16+i, state)
+		}
+	}
+	var heights [16 * 16]int
+	for i := range heights {
+		heights[i] = top
+	}
+	setHeightMaps(c, &heights, &heights)
+	c.Status = level.StatusFull
+	return c, nil
+}
+
+// setHeightMaps fills all heightmaps of the chunk.
+// The heights are indexed by z*16+x, and counted from the bottom of the world to the first air block above the surface.
+// The surface includes fluids, while the floor doesn't.
+func setHeightMaps(c *level.Chunk, surface, floor *[16 * 16]int) {
+	for i := range surface {
+		c.HeightMaps.WorldSurfaceWG.Set(i, surface[i])
+		c.HeightMaps.WorldSurface.Set(i, surface[i])
+		c.HeightMaps.OceanFloorWG.Set(i, floor[i])
+		c.HeightMaps.OceanFloor.Set(i, floor[i])
+		c.HeightMaps.MotionBlocking.Set(i, surface[i])
+		c.HeightMaps.MotionBlockingNoLeaves.Set(i, surface[i])
+	}
+}
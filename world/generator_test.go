@@ -0,0 +1,164 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package world
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/Tnze/go-mc/level"
+	"github.com/Tnze/go-mc/level/block"
+)
+
+// checkSurface checks the WorldSurface heightmap of the generated chunk is the height above the highest non-air block.
+func checkSurface(t *testing.T, c *level.Chunk, height int) {
+	t.Helper()
+	if len(c.Sections) != height/16 {
+		t.Fatalf("got %d sections, want %d", len(c.Sections), height/16)
+	}
+	for i := 0; i < 16*16; i++ {
+		h := c.HeightMaps.WorldSurface.Get(i)
+		if h < 0 || h > height {
+			t.Fatalf("column %d: heightmap %d is out of the world", i, h)
+		}
+		if h > 0 && block.IsAir(c.Sections[(h-1)/16].GetBlock((h-1)%16*256+i)) {
+			t.Errorf("column %d: the block below the surface %d is air", i, h)
+		}
+		for y := h; y < height; y++ {
+			if !block.IsAir(c.Sections[y/16].GetBlock(y%16*256 + i)) {
+				t.Errorf("column %d: the block at %d above the surface %d isn't air", i, y, h)
+				break
+			}
+		}
+	}
+}
+
+func TestNoiseGenerator_dimensions(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		ctx  GeneratorContext
+	}{
+		{"overworld", GeneratorContext{Seed: 1, MinY: -64, Height: 384}},
+		{"nether", GeneratorContext{Seed: 1, MinY: 0, Height: 256}},
+		{"below sea level", GeneratorContext{Seed: 1, MinY: 0, Height: 32}},
+		{"above sea level", GeneratorContext{Seed: 1, MinY: 64, Height: 128}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewNoiseGenerator(tt.ctx)
+			// find a deep ocean, the ground of which is below the bottom of the dimension starting at 64
+			var ocean [2]int32
+			found := false
+			for x := 0; x < 1<<18 && !found; x += 256 {
+				if g.sampleColumn(x, 0).height < 48 {
+					ocean, found = [2]int32{int32(x / 16), 0}, true
+				}
+			}
+			if !found {
+				t.Fatal("no deep ocean is found")
+			}
+			for _, pos := range [][2]int32{{0, 0}, {-1, 5}, {100, -100}, ocean} {
+				c, err := g.Generate(pos)
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkSurface(t, c, int(tt.ctx.Height))
+				if got := c.Sections[0].GetBlock(0); got != bedrockState {
+					t.Errorf("chunk %v: got block %d at the bottom, want bedrock", pos, got)
+				}
+			}
+		})
+	}
+}
+
+func TestFlatGenerator(t *testing.T) {
+	layers, err := ParseFlatLayers("minecraft:bedrock,2*minecraft:dirt,minecraft:grass_block")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &FlatGenerator{Sections: 24, Layers: layers}
+	c, err := g.Generate([2]int32{3, -7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []block.Block{block.Bedrock{}, block.Dirt{}, block.Dirt{}, block.GrassBlock{}, block.Air{}}
+	for y, b := range want {
+		for i := 0; i < 16*16; i++ {
+			if got := c.Sections[0].GetBlock(y*256 + i); got != block.ToStateID[b] {
+				t.Fatalf("block %d at %d: got %d, want %s", i, y, got, b.ID())
+			}
+		}
+	}
+	checkSurface(t, c, 24*16)
+	if h := c.HeightMaps.WorldSurface.Get(0); h != 4 {
+		t.Errorf("got surface %d, want 4", h)
+	}
+}
+
+func TestParseFlatLayers(t *testing.T) {
+	for _, tt := range []struct {
+		input   string
+		want    int
+		wantErr bool
+	}{
+		{"minecraft:bedrock,2*minecraft:dirt,minecraft:grass_block", 4, false},
+		{"bedrock,3*stone", 4, false},
+		{"minecraft:unknown_block", 0, true},
+		{"0*minecraft:dirt", 0, true},
+		{"x*minecraft:dirt", 0, true},
+	} {
+		layers, err := ParseFlatLayers(tt.input)
+		if (err != nil) != tt.wantErr || len(layers) != tt.want {
+			t.Errorf("ParseFlatLayers(%q) = %d layers, %v", tt.input, len(layers), err)
+		}
+	}
+}
+
+func TestVoidGenerator(t *testing.T) {
+	g, err := NewGenerator("void", GeneratorContext{MinY: -64, Height: 384}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := g.Generate([2]int32{0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Sections) != 24 {
+		t.Fatalf("got %d sections, want 24", len(c.Sections))
+	}
+	checkSurface(t, c, 24*16)
+}
+
+func TestNew_defaultGenerator(t *testing.T) {
+	for _, tt := range []struct {
+		dimType string
+		want    int
+	}{
+		{"minecraft:overworld", 24},
+		{"minecraft:the_nether", 16},
+		{"minecraft:the_end", 16},
+	} {
+		w := New(zap.NewNop(), ChunkProvider{}, Config{DimensionType: tt.dimType})
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		g, ok := w.config.Generator.(VoidGenerator)
+		if !ok || g.Sections != tt.want {
+			t.Errorf("%s: got generator %#v, want %d sections of air", tt.dimType, w.config.Generator, tt.want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package noise implements the seeded gradient noise used by the terrain generator.
+package noise
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Perlin is an improved Perlin noise whose permutation table is shuffled by a seed.
+// The output is roughly in range [-1, 1].
+type Perlin struct {
+	perm [512]uint8
+	// offset moves the sampling point, so the noise isn't always zero at the integer coordinates.
+	offset [3]float64
+}
+
+func NewPerlin(seed int64) *Perlin {
+	r := rand.New(rand.NewSource(seed))
+	p := new(Perlin)
+	p.offset = [3]float64{r.Float64() * 256, r.Float64() * 256, r.Float64() * 256}
+	for i := 0; i < 256; i++ {
+		p.perm[i] = uint8(i)
+	}
+	r.Shuffle(256, func(i, j int) { p.perm[i], p.perm[j] = p.perm[j], p.perm[i] })
+	copy(p.perm[256:], p.perm[:256])
+	return p
+}
+
+// Noise3 samples the noise at (x, y, z).
+func (p *Perlin) Noise3(x, y, z float64) float64 {
+	x, y, z = x+p.offset[0], y+p.offset[1], z+p.offset[2]
+	fx, fy, fz := math.Floor(x), math.Floor(y), math.Floor(z)
+	X, Y, Z := int(fx)&255, int(fy)&255, int(fz)&255
+	x, y, z = x-fx, y-fy, z-fz
+	u, v, w := fade(x), fade(y), fade(z)
+
+	perm := &p.perm
+	A := int(perm[X]) + Y
+	AA, AB := int(perm[A])+Z, int(perm[A+1])+Z
+	B := int(perm[X+1]) + Y
+	BA, BB := int(perm[B])+Z, int(perm[B+1])+Z
+
+	return lerp(w,
+		lerp(v,
+			lerp(u, grad(perm[AA], x, y, z), grad(perm[BA], x-1, y, z)),
+			lerp(u, grad(perm[AB], x, y-1, z), grad(perm[BB], x-1, y-1, z)),
+		),
+		lerp(v,
+			lerp(u, grad(perm[AA+1], x, y, z-1), grad(perm[BA+1], x-1, y, z-1)),
+			lerp(u, grad(perm[AB+1], x, y-1, z-1), grad(perm[BB+1], x-1, y-1, z-1)),
+		),
+	)
+}
+
+// Noise2 samples the noise at (x, z) on a plane.
+func (p *Perlin) Noise2(x, z float64) float64 { return p.Noise3(x, 0, z) }
+
+func fade(t float64) float64       { return t * t * t * (t*(t*6-15) + 10) }
+func lerp(t, a, b float64) float64 { return a + t*(b-a) }
+
+func grad(hash uint8, x, y, z float64) float64 {
+	switch hash & 15 {
+	case 0, 12:
+		return x + y
+	case 1, 14:
+		return -x + y
+	case 2:
+		return x - y
+	case 3:
+		return -x - y
+	case 4:
+		return x + z
+	case 5:
+		return -x + z
+	case 6:
+		return x - z
+	case 7:
+		return -x - z
+	case 8:
+		return y + z
+	case 9, 13:
+		return -y + z
+	case 10:
+		return y - z
+	default: // 11, 15
+		return -y - z
+	}
+}
+
+// Octaves is the fractal sum of several Perlin noises.
+// Each octave doubles the frequency and halves the amplitude of the previous one.
+type Octaves struct {
+	octaves []*Perlin
+	// scale is applied to the input coordinates, which is the frequency of the first octave.
+	scale float64
+	// norm keeps the output in the same range as a single Perlin noise.
+	norm float64
+}
+
+// NewOctaves creates n octaves with the first octave sampled at the frequency of scale.
+// Each octave is seeded by the seed of its previous one, so the whole noise is determined by seed.
+func NewOctaves(seed int64, n int, scale float64) *Octaves {
+	r := rand.New(rand.NewSource(seed))
+	o := &Octaves{octaves: make([]*Perlin, n), scale: scale}
+	amplitude := 1.0
+	for i := range o.octaves {
+		o.octaves[i] = NewPerlin(r.Int63())
+		o.norm += amplitude
+		amplitude /= 2
+	}
+	return o
+}
+
+func (o *Octaves) Noise3(x, y, z float64) (sum float64) {
+	x, y, z = x*o.scale, y*o.scale, z*o.scale
+	amplitude := 1.0
+	for _, p := range o.octaves {
+		sum += p.Noise3(x, y, z) * amplitude
+		x, y, z = x*2, y*2, z*2
+		amplitude /= 2
+	}
+	return sum / o.norm
+}
+
+func (o *Octaves) Noise2(x, z float64) float64 { return o.Noise3(x, 0, z) }
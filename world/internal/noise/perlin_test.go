@@ -0,0 +1,61 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package noise
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestPerlin_deterministic(t *testing.T) {
+	a, b := NewOctaves(42, 4, 1.0/64), NewOctaves(42, 4, 1.0/64)
+	c := NewOctaves(43, 4, 1.0/64)
+	var differ bool
+	for i := 0; i < 1000; i++ {
+		x, y, z := rand.Float64()*1e4, rand.Float64()*256, rand.Float64()*1e4
+		if a.Noise3(x, y, z) != b.Noise3(x, y, z) {
+			t.Fatalf("noise with the same seed differs at (%v, %v, %v)", x, y, z)
+		}
+		if a.Noise3(x, y, z) != c.Noise3(x, y, z) {
+			differ = true
+		}
+	}
+	if !differ {
+		t.Error("noise with different seeds are the same")
+	}
+}
+
+func TestPerlin_range(t *testing.T) {
+	p := NewPerlin(0)
+	for i := 0; i < 100000; i++ {
+		x, y, z := rand.NormFloat64()*1e3, rand.NormFloat64()*1e3, rand.NormFloat64()*1e3
+		if v := p.Noise3(x, y, z); v < -1.1 || v > 1.1 {
+			t.Fatalf("noise out of range at (%v, %v, %v): %v", x, y, z, v)
+		}
+	}
+}
+
+func TestPerlin_continuous(t *testing.T) {
+	p := NewPerlin(1)
+	const step = 1e-3
+	for i := 0; i < 10000; i++ {
+		x, z := rand.Float64()*100, rand.Float64()*100
+		if d := p.Noise2(x, z) - p.Noise2(x+step, z); d > 0.01 || d < -0.01 {
+			t.Fatalf("noise isn't continuous at (%v, %v): %v", x, z, d)
+		}
+	}
+}
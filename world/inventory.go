@@ -0,0 +1,380 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package world
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+
+	"github.com/Tnze/go-mc/data/item"
+)
+
+// Slots of the player inventory window
+const (
+	SlotCraftingResult = 0
+	SlotCraftingStart  = 1 // the 2x2 crafting grid
+	SlotArmorStart     = 5 // head, chest, legs and feet
+	SlotMainStart      = 9
+	SlotHotbarStart    = 36
+	SlotOffhand        = 45
+	InventorySize      = 46
+)
+
+// Modes of ServerboundContainerClick
+const (
+	ClickPickup = iota
+	ClickQuickMove
+	ClickSwap
+	ClickClone
+	ClickThrow
+	ClickQuickCraft
+	ClickPickupAll
+)
+
+// ClickOutside is the slot number of clicking outside the window.
+const ClickOutside = -999
+
+// Inventory is the items of a player, indexed by the slots of the player inventory window.
+// It's accessed by the goroutine receiving packets of the player and the one saving the player, so it must be locked.
+type Inventory struct {
+	sync.Mutex
+	Slots [InventorySize]ItemStack
+	// Carried is the item stack held by the cursor when the window is open.
+	Carried ItemStack
+	// StateID is increased every time the server sends the content of the window,
+	// and the clicks based on an old state are answered with the whole content.
+	StateID int32
+
+	// dragging is the slots in the current ClickQuickCraft, nil if not dragging.
+	dragging   []int
+	dragButton int8
+}
+
+// NextStateID increases the StateID, wrapping around like vanilla.
+func (inv *Inventory) NextStateID() int32 {
+	inv.StateID = (inv.StateID + 1) & 0x7FFF
+	return inv.StateID
+}
+
+// Hotbar returns the item in the hotbar slot, from 0 to 8.
+func (inv *Inventory) Hotbar(i int16) ItemStack {
+	inv.Lock()
+	defer inv.Unlock()
+	return inv.Slots[SlotHotbarStart+int(i)]
+}
+
+// Click applies the click of the player on the slot, as vanilla does.
+// It returns false if the click is invalid or not supported, then the items are not changed.
+func (inv *Inventory) Click(slot int16, button int8, mode int32, creative bool) bool {
+	if mode != ClickQuickCraft && inv.dragging != nil {
+		inv.dragging = nil
+	}
+	if slot == ClickOutside {
+		// dropping items and closing the window by clicking outside are not yet supported
+		return mode == ClickQuickCraft && inv.drag(ClickOutside, button, creative)
+	}
+	if slot < 0 || slot >= InventorySize {
+		return false
+	}
+	i := int(slot)
+	switch mode {
+	case ClickPickup:
+		return inv.pickup(i, button)
+	case ClickQuickMove:
+		return button <= 1 && inv.quickMove(i)
+	case ClickSwap:
+		return inv.swap(i, button)
+	case ClickClone:
+		if !creative || !inv.Carried.IsEmpty() || inv.Slots[i].IsEmpty() {
+			return false
+		}
+		inv.Carried = inv.Slots[i]
+		inv.Carried.Count = maxStackSize(inv.Carried.ID)
+		return true
+	case ClickQuickCraft:
+		return inv.drag(i, button, creative)
+	case ClickPickupAll:
+		return button == 0 && inv.pickupAll(i)
+	default:
+		return false
+	}
+}
+
+func (inv *Inventory) pickup(i int, button int8) bool {
+	if button != 0 && button != 1 {
+		return false
+	}
+	s, carried := &inv.Slots[i], &inv.Carried
+	switch {
+	case carried.IsEmpty():
+		if s.IsEmpty() {
+			return true
+		}
+		n := s.Count
+		if button == 1 {
+			n = (n + 1) / 2
+		}
+		*carried = s.split(n)
+	case !mayPlace(i, *carried):
+		return false
+	case s.IsEmpty() || s.Stackable(*carried):
+		n := carried.Count
+		if button == 1 {
+			n = 1
+		}
+		inv.place(i, carried, n)
+	default:
+		*s, *carried = *carried, *s
+	}
+	return true
+}
+
+func (inv *Inventory) quickMove(i int) bool {
+	s := &inv.Slots[i]
+	if s.IsEmpty() {
+		return true
+	}
+	switch {
+	case i < SlotMainStart || i == SlotOffhand:
+		inv.moveTo(s, SlotMainStart, SlotOffhand)
+	default:
+		if armor := armorSlot(s.ID); armor >= 0 && inv.Slots[armor].IsEmpty() {
+			inv.place(armor, s, 1)
+		} else if i < SlotHotbarStart {
+			inv.moveTo(s, SlotHotbarStart, SlotOffhand)
+		} else {
+			inv.moveTo(s, SlotMainStart, SlotHotbarStart)
+		}
+	}
+	return true
+}
+
+func (inv *Inventory) swap(i int, button int8) bool {
+	var j int
+	switch {
+	case button >= 0 && button < 9:
+		j = SlotHotbarStart + int(button)
+	case button == 40:
+		j = SlotOffhand
+	default:
+		return false
+	}
+	if !mayPlace(i, inv.Slots[j]) || !mayPlace(j, inv.Slots[i]) {
+		return false
+	}
+	inv.Slots[i], inv.Slots[j] = inv.Slots[j], inv.Slots[i]
+	return true
+}
+
+// drag handles the three stages of ClickQuickCraft: starting, adding slots and ending.
+// The button is 4*type+stage, the types are splitting evenly, one item each and full stacks in creative mode.
+func (inv *Inventory) drag(i int, button int8, creative bool) bool {
+	typ, stage := button>>2, button&3
+	if typ > 2 || typ == 2 && !creative {
+		return false
+	}
+	switch stage {
+	case 0:
+		if i != ClickOutside || inv.dragging != nil || inv.Carried.IsEmpty() {
+			return false
+		}
+		inv.dragging, inv.dragButton = []int{}, typ
+		return true
+	case 1:
+		if inv.dragging == nil || typ != inv.dragButton || i < 0 {
+			return false
+		}
+		s := inv.Slots[i]
+		if i == SlotCraftingResult || !mayPlace(i, inv.Carried) || !s.IsEmpty() && !s.Stackable(inv.Carried) {
+			return false
+		}
+		for _, j := range inv.dragging {
+			if j == i {
+				return true
+			}
+		}
+		// every slot gets at least one item, unless in creative mode
+		if typ == 2 || len(inv.dragging) < int(inv.Carried.Count) {
+			inv.dragging = append(inv.dragging, i)
+		}
+		return true
+	case 2:
+		slots := inv.dragging
+		inv.dragging = nil
+		if slots == nil || typ != inv.dragButton || i != ClickOutside || len(slots) == 0 {
+			return false
+		}
+		var each int8
+		switch typ {
+		case 0:
+			each = inv.Carried.Count / int8(len(slots))
+		case 1:
+			each = 1
+		case 2:
+			each = maxStackSize(inv.Carried.ID)
+		}
+		for _, j := range slots {
+			if inv.Carried.IsEmpty() {
+				break
+			}
+			if typ == 2 {
+				stack := inv.Carried
+				stack.Count = each
+				inv.Slots[j] = stack
+				continue
+			}
+			inv.place(j, &inv.Carried, each)
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// pickupAll collects the same items to the carried stack, the partial stacks first.
+func (inv *Inventory) pickupAll(i int) bool {
+	carried := &inv.Carried
+	if carried.IsEmpty() || !inv.Slots[i].IsEmpty() {
+		return true
+	}
+	limit := maxStackSize(carried.ID)
+	for _, full := range [...]bool{false, true} {
+		for j := SlotCraftingStart; j < InventorySize && carried.Count < limit; j++ {
+			s := &inv.Slots[j]
+			if s.IsEmpty() || !s.Stackable(*carried) || (s.Count >= maxStackSize(s.ID)) != full {
+				continue
+			}
+			n := limit - carried.Count
+			if n > s.Count {
+				n = s.Count
+			}
+			s.split(n)
+			carried.Count += n
+		}
+	}
+	return true
+}
+
+// Add puts the stack into the main inventory and the hotbar, and returns what doesn't fit.
+func (inv *Inventory) Add(stack ItemStack) ItemStack {
+	inv.moveTo(&stack, SlotHotbarStart, SlotOffhand)
+	inv.moveTo(&stack, SlotMainStart, SlotHotbarStart)
+	return stack
+}
+
+// moveTo moves the items from the stack to the slots in [start, end),
+// filling the same items first and then the empty slots.
+func (inv *Inventory) moveTo(stack *ItemStack, start, end int) {
+	for i := start; i < end && !stack.IsEmpty(); i++ {
+		if !inv.Slots[i].IsEmpty() && inv.Slots[i].Stackable(*stack) {
+			inv.place(i, stack, stack.Count)
+		}
+	}
+	for i := start; i < end && !stack.IsEmpty(); i++ {
+		if inv.Slots[i].IsEmpty() {
+			inv.place(i, stack, stack.Count)
+		}
+	}
+}
+
+// place moves at most n items from the stack to the slot, which is empty or has the same item.
+func (inv *Inventory) place(i int, from *ItemStack, n int8) {
+	s := &inv.Slots[i]
+	limit := maxStackSize(from.ID)
+	if i >= SlotArmorStart && i < SlotMainStart {
+		limit = 1
+	}
+	if n > limit-s.Count {
+		n = limit - s.Count
+	}
+	if n <= 0 {
+		return
+	}
+	if s.IsEmpty() {
+		*s = from.split(n)
+	} else {
+		from.split(n)
+		s.Count += n
+	}
+}
+
+// ReturnCrafting moves the items in the crafting grid and the cursor back to the inventory when the window is closed.
+// Items that don't fit are kept where they are.
+func (inv *Inventory) ReturnCrafting() {
+	inv.dragging = nil
+	inv.Carried = inv.Add(inv.Carried)
+	for i := SlotCraftingStart; i < SlotArmorStart; i++ {
+		inv.Slots[i] = inv.Add(inv.Slots[i])
+	}
+}
+
+// split removes n items from the stack and returns them.
+func (s *ItemStack) split(n int8) ItemStack {
+	taken := *s
+	taken.Count = n
+	if s.Count -= n; s.Count <= 0 {
+		*s = ItemStack{}
+	}
+	return taken
+}
+
+// Stackable reports whether the two stacks are the same item with the same data, so they can be merged.
+func (s *ItemStack) Stackable(o ItemStack) bool {
+	return s.ID == o.ID && s.Tag.Type == o.Tag.Type && bytes.Equal(s.Tag.Data, o.Tag.Data)
+}
+
+func maxStackSize(id item.ID) int8 {
+	if it, ok := item.ByID[id]; ok {
+		return int8(it.StackSize)
+	}
+	return 64
+}
+
+// mayPlace reports whether the stack can be put into the slot.
+// The crafting result can only be taken, and the armor slots only accept the armors of them.
+func mayPlace(i int, stack ItemStack) bool {
+	switch {
+	case stack.IsEmpty():
+		return true
+	case i == SlotCraftingResult:
+		return false
+	case i >= SlotArmorStart && i < SlotMainStart:
+		return armorSlot(stack.ID) == i
+	}
+	return true
+}
+
+// armorSlot returns the armor slot the item can be worn in, or -1 if it isn't an armor.
+func armorSlot(id item.ID) int {
+	it, ok := item.ByID[id]
+	if !ok {
+		return -1
+	}
+	switch name := it.Name; {
+	case strings.HasSuffix(name, "_helmet"), strings.HasSuffix(name, "_head"), strings.HasSuffix(name, "_skull"),
+		name == "carved_pumpkin":
+		return SlotArmorStart
+	case strings.HasSuffix(name, "_chestplate"), name == "elytra":
+		return SlotArmorStart + 1
+	case strings.HasSuffix(name, "_leggings"):
+		return SlotArmorStart + 2
+	case strings.HasSuffix(name, "_boots"):
+		return SlotArmorStart + 3
+	}
+	return -1
+}
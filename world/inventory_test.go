@@ -0,0 +1,231 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package world
+
+import (
+	"testing"
+
+	"github.com/Tnze/go-mc/data/item"
+)
+
+func stack(it item.Item, count int8) ItemStack { return ItemStack{ID: it.ID, Count: count} }
+
+func TestInventory_pickup(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		slot, carried ItemStack
+		button        int8
+		wantSlot      ItemStack
+		wantCarried   ItemStack
+	}{
+		{"take all", stack(item.Stone, 10), ItemStack{}, 0, ItemStack{}, stack(item.Stone, 10)},
+		{"take half", stack(item.Stone, 11), ItemStack{}, 1, stack(item.Stone, 5), stack(item.Stone, 6)},
+		{"place all", ItemStack{}, stack(item.Stone, 10), 0, stack(item.Stone, 10), ItemStack{}},
+		{"place one", ItemStack{}, stack(item.Stone, 10), 1, stack(item.Stone, 1), stack(item.Stone, 9)},
+		{"merge", stack(item.Stone, 60), stack(item.Stone, 10), 0, stack(item.Stone, 64), stack(item.Stone, 6)},
+		{"merge unstackable", stack(item.Bucket, 16), stack(item.Bucket, 1), 0, stack(item.Bucket, 16), stack(item.Bucket, 1)},
+		{"swap", stack(item.Dirt, 3), stack(item.Stone, 10), 0, stack(item.Stone, 10), stack(item.Dirt, 3)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var inv Inventory
+			inv.Slots[SlotMainStart], inv.Carried = tt.slot, tt.carried
+			if !inv.Click(SlotMainStart, tt.button, ClickPickup, false) {
+				t.Fatal("click is rejected")
+			}
+			if !inv.Slots[SlotMainStart].Equal(tt.wantSlot) || !inv.Carried.Equal(tt.wantCarried) {
+				t.Errorf("got slot %v and carried %v, want %v and %v", inv.Slots[SlotMainStart], inv.Carried, tt.wantSlot, tt.wantCarried)
+			}
+		})
+	}
+}
+
+func TestInventory_pickupRestricted(t *testing.T) {
+	var inv Inventory
+	inv.Carried = stack(item.Stone, 1)
+	if inv.Click(SlotCraftingResult, 0, ClickPickup, false) {
+		t.Error("items are placed into the crafting result")
+	}
+	if inv.Click(SlotArmorStart, 0, ClickPickup, false) {
+		t.Error("stone is placed into the helmet slot")
+	}
+	inv.Carried = stack(item.IronHelmet, 1)
+	if !inv.Click(SlotArmorStart, 0, ClickPickup, false) || inv.Slots[SlotArmorStart].ID != item.IronHelmet.ID {
+		t.Error("helmet isn't placed into the helmet slot")
+	}
+}
+
+func TestInventory_drag(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		typ         int8
+		creative    bool
+		carried     int8
+		slots       []int16
+		wantEach    int8
+		wantCarried int8
+	}{
+		{"split evenly", 0, false, 10, []int16{9, 10, 11}, 3, 1},
+		{"one each", 1, false, 10, []int16{9, 10, 11}, 1, 7},
+		{"more slots than items", 0, false, 2, []int16{9, 10, 11}, 1, 0},
+		{"full stacks", 2, true, 1, []int16{9, 10}, 64, 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var inv Inventory
+			inv.Carried = stack(item.Stone, tt.carried)
+			if !inv.Click(ClickOutside, tt.typ<<2, ClickQuickCraft, tt.creative) {
+				t.Fatal("start is rejected")
+			}
+			for _, slot := range tt.slots {
+				if !inv.Click(slot, tt.typ<<2|1, ClickQuickCraft, tt.creative) {
+					t.Fatalf("adding slot %d is rejected", slot)
+				}
+			}
+			if !inv.Click(ClickOutside, tt.typ<<2|2, ClickQuickCraft, tt.creative) {
+				t.Fatal("end is rejected")
+			}
+			var placed int
+			for _, slot := range tt.slots {
+				if s := inv.Slots[slot]; !s.IsEmpty() {
+					placed++
+					if s.Count != tt.wantEach {
+						t.Errorf("slot %d has %d items, want %d", slot, s.Count, tt.wantEach)
+					}
+				}
+			}
+			if placed == 0 {
+				t.Error("nothing is placed")
+			}
+			if inv.Carried.Count != tt.wantCarried && !(tt.wantCarried == 0 && inv.Carried.IsEmpty()) {
+				t.Errorf("carried %v, want %d items", inv.Carried, tt.wantCarried)
+			}
+		})
+	}
+}
+
+func TestInventory_dragCreativeOnly(t *testing.T) {
+	var inv Inventory
+	inv.Carried = stack(item.Stone, 1)
+	if inv.Click(ClickOutside, 2<<2, ClickQuickCraft, false) {
+		t.Error("full stack dragging is allowed in survival mode")
+	}
+}
+
+func TestInventory_quickMove(t *testing.T) {
+	var inv Inventory
+	inv.Slots[20] = stack(item.IronChestplate, 1)
+	inv.Slots[21] = stack(item.Stone, 10)
+	inv.Slots[SlotHotbarStart] = stack(item.Stone, 60)
+	inv.Slots[SlotHotbarStart+1] = stack(item.Dirt, 5)
+
+	if !inv.Click(20, 0, ClickQuickMove, false) || inv.Slots[SlotArmorStart+1].ID != item.IronChestplate.ID {
+		t.Error("chestplate isn't moved to the chest slot")
+	}
+	// the stone is merged into the hotbar first, and the rest goes to an empty slot
+	if !inv.Click(21, 0, ClickQuickMove, false) ||
+		inv.Slots[SlotHotbarStart].Count != 64 || !inv.Slots[SlotHotbarStart+2].Equal(stack(item.Stone, 6)) {
+		t.Errorf("stone isn't moved to the hotbar: %v", inv.Slots[SlotHotbarStart:SlotOffhand])
+	}
+	if !inv.Click(SlotHotbarStart+1, 0, ClickQuickMove, false) || !inv.Slots[SlotMainStart].Equal(stack(item.Dirt, 5)) {
+		t.Error("dirt isn't moved from the hotbar to the main inventory")
+	}
+	if !inv.Click(SlotArmorStart+1, 0, ClickQuickMove, false) || !inv.Slots[SlotArmorStart+1].IsEmpty() {
+		t.Error("chestplate isn't taken off")
+	}
+}
+
+func TestInventory_swap(t *testing.T) {
+	var inv Inventory
+	inv.Slots[10] = stack(item.Stone, 1)
+	inv.Slots[SlotOffhand] = stack(item.Shield, 1)
+	if !inv.Click(10, 40, ClickSwap, false) ||
+		inv.Slots[10].ID != item.Shield.ID || inv.Slots[SlotOffhand].ID != item.Stone.ID {
+		t.Error("items aren't swapped with the off hand")
+	}
+	if !inv.Click(10, 3, ClickSwap, false) || inv.Slots[SlotHotbarStart+3].ID != item.Shield.ID || !inv.Slots[10].IsEmpty() {
+		t.Error("items aren't swapped with the hotbar")
+	}
+	if inv.Click(SlotArmorStart, 3, ClickSwap, false) {
+		t.Error("shield is swapped into the helmet slot")
+	}
+	if inv.Click(10, 9, ClickSwap, false) {
+		t.Error("invalid hotbar button is accepted")
+	}
+}
+
+func TestInventory_pickupAll(t *testing.T) {
+	var inv Inventory
+	inv.Carried = stack(item.Stone, 10)
+	inv.Slots[9] = stack(item.Stone, 64)
+	inv.Slots[10] = stack(item.Stone, 30)
+	inv.Slots[11] = stack(item.Dirt, 30)
+	if !inv.Click(12, 0, ClickPickupAll, false) {
+		t.Fatal("click is rejected")
+	}
+	// the partial stack is collected before the full one
+	if inv.Carried.Count != 64 || !inv.Slots[10].IsEmpty() || inv.Slots[9].Count != 40 || inv.Slots[11].Count != 30 {
+		t.Errorf("carried %v, slots %v", inv.Carried, inv.Slots[9:12])
+	}
+}
+
+func TestInventory_returnCrafting(t *testing.T) {
+	var inv Inventory
+	inv.Slots[SlotCraftingStart] = stack(item.Stone, 3)
+	inv.Carried = stack(item.Dirt, 2)
+	inv.ReturnCrafting()
+	if !inv.Carried.IsEmpty() || !inv.Slots[SlotCraftingStart].IsEmpty() {
+		t.Fatal("items are left in the crafting grid or on the cursor")
+	}
+	if !inv.Slots[SlotHotbarStart].Equal(stack(item.Dirt, 2)) || !inv.Slots[SlotHotbarStart+1].Equal(stack(item.Stone, 3)) {
+		t.Errorf("items aren't returned to the hotbar: %v", inv.Slots[SlotHotbarStart:SlotOffhand])
+	}
+}
+
+func TestInventory_dataSlots(t *testing.T) {
+	for _, tt := range []struct {
+		window int
+		data   int8
+	}{
+		{SlotHotbarStart, 0},
+		{SlotHotbarStart + 8, 8},
+		{SlotMainStart, 9},
+		{SlotHotbarStart - 1, 35},
+		{SlotArmorStart, 103},     // head
+		{SlotArmorStart + 3, 100}, // feet
+		{SlotOffhand, -106},
+	} {
+		if got, ok := dataSlot(tt.window); !ok || got != tt.data {
+			t.Errorf("dataSlot(%d) = %d, %v, want %d", tt.window, got, ok, tt.data)
+		}
+	}
+	for i := 0; i < InventorySize; i++ {
+		d, ok := dataSlot(i)
+		if !ok {
+			if i >= SlotArmorStart {
+				t.Errorf("slot %d isn't saved", i)
+			}
+			continue
+		}
+		if w, ok := windowSlot(d); !ok || w != i {
+			t.Errorf("slot %d is saved as %d, which is loaded as %d", i, d, w)
+		}
+	}
+	for _, d := range []int8{36, 99, 104, -1} {
+		if _, ok := windowSlot(d); ok {
+			t.Errorf("invalid data slot %d is loaded", d)
+		}
+	}
+}
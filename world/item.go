@@ -0,0 +1,90 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package world
+
+import (
+	"io"
+
+	"github.com/Tnze/go-mc/data/item"
+	"github.com/Tnze/go-mc/nbt"
+	pk "github.com/Tnze/go-mc/net/packet"
+)
+
+// itemIDs maps the item names without the "minecraft:" prefix to the item IDs.
+var itemIDs = func() map[string]item.ID {
+	ids := make(map[string]item.ID, len(item.ByID))
+	for id, it := range item.ByID {
+		ids[it.Name] = id
+	}
+	return ids
+}()
+
+// ItemStack is the content of an inventory slot. The zero value is an empty slot.
+type ItemStack struct {
+	ID    item.ID
+	Count int8
+	// Tag is the NBT data of the item, the Type is TagEnd if the item has no data.
+	Tag nbt.RawMessage
+}
+
+func (s *ItemStack) IsEmpty() bool { return s.ID == 0 || s.Count <= 0 }
+
+// Equal reports whether the two stacks are both empty, or the same items with the same count.
+func (s *ItemStack) Equal(o ItemStack) bool {
+	if s.IsEmpty() || o.IsEmpty() {
+		return s.IsEmpty() && o.IsEmpty()
+	}
+	return s.Count == o.Count && s.Stackable(o)
+}
+
+// WriteTo encodes the ItemStack in the Slot format of the protocol.
+func (s ItemStack) WriteTo(w io.Writer) (n int64, err error) {
+	if s.IsEmpty() {
+		return pk.Boolean(false).WriteTo(w)
+	}
+	var tag pk.Field = pk.NBT(nil)
+	if s.Tag.Type != nbt.TagEnd {
+		tag = pk.NBT(s.Tag)
+	}
+	return pk.Tuple{
+		pk.Boolean(true),
+		pk.VarInt(s.ID),
+		pk.Byte(s.Count),
+		tag,
+	}.WriteTo(w)
+}
+
+// ReadFrom decodes the ItemStack from the Slot format of the protocol.
+func (s *ItemStack) ReadFrom(r io.Reader) (n int64, err error) {
+	var present pk.Boolean
+	n, err = present.ReadFrom(r)
+	if err != nil || !present {
+		*s = ItemStack{}
+		return
+	}
+	var (
+		id  pk.VarInt
+		tag nbt.RawMessage
+	)
+	n1, err := pk.Tuple{
+		&id,
+		(*pk.Byte)(&s.Count),
+		pk.NBTField{V: &tag, AllowUnknownFields: true},
+	}.ReadFrom(r)
+	s.ID, s.Tag = item.ID(id), tag
+	return n + n1, err
+}
@@ -19,10 +19,12 @@ package world
 import (
 	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 
+	"github.com/Tnze/go-mc/chat/sign"
 	pk "github.com/Tnze/go-mc/net/packet"
 	"github.com/Tnze/go-mc/yggdrasil/user"
 )
@@ -49,12 +51,27 @@ type Player struct {
 	Latency    time.Duration
 
 	lastChatTimestamp time.Time
-	lastChatSignature []byte
+	// chatSession signs the messages sent by the player, and the messages are chained by the chatIndex.
+	chatLock    sync.Mutex
+	chatSession *sign.Session
+	chatIndex   int
+	chatBroken  bool
 
+	// Dimension is the name of the world the player is in.
+	Dimension    string
 	ChunkPos     [3]int32
 	ViewDistance int32
 
-	Gamemode       int32
+	// gamemode is changed by commands while the goroutine receiving packets of the player reads it.
+	gamemode atomic.Int32
+	// permissionLevel is from 0 to 4, players with higher levels can use more commands.
+	permissionLevel atomic.Int32
+	// Inventory is the items of the player, Inputs.HeldSlot selects the one of the hotbar in the main hand.
+	Inventory Inventory
+	// digging is the block the player is breaking in survival mode, nil if not digging.
+	diggingLock sync.Mutex
+	digging     *Digging
+
 	EntitiesInView map[int32]*Entity
 	view           *playerViewNode
 	teleport       *TeleportRequest
@@ -62,6 +79,59 @@ type Player struct {
 	Inputs Inputs
 }
 
+// Gamemode returns the game mode of the player.
+func (p *Player) Gamemode() int32 { return p.gamemode.Load() }
+
+// SetGamemode changes the game mode of the player, and stops the digging.
+func (p *Player) SetGamemode(mode int32) {
+	p.diggingLock.Lock()
+	defer p.diggingLock.Unlock()
+	p.gamemode.Store(mode)
+	p.digging = nil
+}
+
+// PermissionLevel returns the permission level of the player, from 0 to 4.
+func (p *Player) PermissionLevel() int32 { return p.permissionLevel.Load() }
+
+// SetPermissionLevel changes the permission level of the player.
+func (p *Player) SetPermissionLevel(level int32) { p.permissionLevel.Store(level) }
+
+// StartDigging records that the player starts breaking the block at pos.
+func (p *Player) StartDigging(pos [3]int32) {
+	p.diggingLock.Lock()
+	defer p.diggingLock.Unlock()
+	p.digging = &Digging{Pos: pos, Start: time.Now()}
+}
+
+// StopDigging clears and returns the block the player is breaking, nil if not digging.
+func (p *Player) StopDigging() *Digging {
+	p.diggingLock.Lock()
+	defer p.diggingLock.Unlock()
+	d := p.digging
+	p.digging = nil
+	return d
+}
+
+// HeldItem returns the item in the main hand of the player.
+func (p *Player) HeldItem() ItemStack {
+	p.Inputs.Lock()
+	slot := p.Inputs.HeldSlot
+	p.Inputs.Unlock()
+	return p.Inventory.Hotbar(slot)
+}
+
+// ConsumeHeldItem removes one item from the main hand of the player, if it's still the same item as stack.
+func (p *Player) ConsumeHeldItem(stack ItemStack) {
+	p.Inputs.Lock()
+	slot := p.Inputs.HeldSlot
+	p.Inputs.Unlock()
+	p.Inventory.Lock()
+	defer p.Inventory.Unlock()
+	if held := &p.Inventory.Slots[SlotHotbarStart+int(slot)]; !held.IsEmpty() && held.Stackable(stack) {
+		held.split(1)
+	}
+}
+
 func (p *Player) chunkPosition() [2]int32 { return [2]int32{p.ChunkPos[0], p.ChunkPos[2]} }
 func (p *Player) chunkRadius() int32      { return p.ViewDistance }
 
@@ -74,6 +144,11 @@ func (p *Player) getView() aabb3d {
 	}
 }
 
+type Digging struct {
+	Pos   [3]int32
+	Start time.Time
+}
+
 type TeleportRequest struct {
 	ID int32
 	Position
@@ -88,8 +163,19 @@ type Inputs struct {
 	OnGround
 	Latency    time.Duration
 	TeleportID int32
+	HeldSlot   int16
+	// Sneaking and Sprinting are the states sent by the player commands.
+	Sneaking  bool
+	Sprinting bool
 }
 
+// Values of ClientInfo.ChatMode
+const (
+	ChatModeEnabled = iota
+	ChatModeCommandsOnly
+	ChatModeHidden
+)
+
 type ClientInfo struct {
 	Locale              string
 	ViewDistance        int8
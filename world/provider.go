@@ -17,17 +17,24 @@
 package world
 
 import (
+	"bytes"
 	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/google/uuid"
 	"golang.org/x/time/rate"
 
+	"github.com/Tnze/go-mc/data/item"
 	"github.com/Tnze/go-mc/level"
+	"github.com/Tnze/go-mc/nbt"
 	"github.com/Tnze/go-mc/save"
 	"github.com/Tnze/go-mc/save/region"
 	"github.com/Tnze/go-mc/yggdrasil/user"
@@ -35,23 +42,37 @@ import (
 
 // ChunkProvider implements chunk storage
 type ChunkProvider struct {
-	dir     string
-	limiter *rate.Limiter
+	dir string
+	// minSectionY is the Y index of the lowest section in the dimension.
+	minSectionY int32
+	limiter     *rate.Limiter
 }
 
-func NewProvider(dir string, limiter *rate.Limiter) ChunkProvider {
-	return ChunkProvider{dir: dir, limiter: limiter}
+func NewProvider(dir string, minSectionY int32, limiter *rate.Limiter) ChunkProvider {
+	return ChunkProvider{dir: dir, minSectionY: minSectionY, limiter: limiter}
 }
 
 var ErrReachRateLimit = errors.New("reach rate limit")
 
-func (p *ChunkProvider) GetChunk(pos [2]int32) (c *level.Chunk, errRet error) {
+// dataVersion is the DataVersion of Minecraft 1.19.4, recorded in each chunk we save.
+const dataVersion = 3337
+
+// ChunkExtra is the data of a chunk not tracked by level.Chunk, like structures and scheduled ticks.
+// It's written back unchanged when the chunk is saved.
+type ChunkExtra struct {
+	BlockTicks     nbt.RawMessage
+	FluidTicks     nbt.RawMessage
+	PostProcessing nbt.RawMessage
+	Structures     nbt.RawMessage
+}
+
+func (p *ChunkProvider) GetChunk(pos [2]int32) (c *level.Chunk, extra ChunkExtra, errRet error) {
 	if !p.limiter.Allow() {
-		return nil, ErrReachRateLimit
+		return nil, extra, ErrReachRateLimit
 	}
 	r, err := p.getRegion(region.At(int(pos[0]), int(pos[1])))
 	if err != nil {
-		return nil, fmt.Errorf("open region fail: %w", err)
+		return nil, extra, fmt.Errorf("open region fail: %w", err)
 	}
 	defer func(r *region.Region) {
 		err2 := r.Close()
@@ -62,24 +83,30 @@ func (p *ChunkProvider) GetChunk(pos [2]int32) (c *level.Chunk, errRet error) {
 
 	x, z := region.In(int(pos[0]), int(pos[1]))
 	if !r.ExistSector(x, z) {
-		return nil, errChunkNotExist
+		return nil, extra, errChunkNotExist
 	}
 
 	data, err := r.ReadSector(x, z)
 	if err != nil {
-		return nil, fmt.Errorf("read sector fail: %w", err)
+		return nil, extra, fmt.Errorf("read sector fail: %w", err)
 	}
 
 	var chunk save.Chunk
 	if err := chunk.Load(data); err != nil {
-		return nil, fmt.Errorf("parse chunk data fail: %w", err)
+		return nil, extra, fmt.Errorf("parse chunk data fail: %w", err)
 	}
 
 	c, err = level.ChunkFromSave(&chunk)
 	if err != nil {
-		return nil, fmt.Errorf("load chunk data fail: %w", err)
+		return nil, extra, fmt.Errorf("load chunk data fail: %w", err)
+	}
+	extra = ChunkExtra{
+		BlockTicks:     chunk.BlockTicks,
+		FluidTicks:     chunk.FluidTicks,
+		PostProcessing: chunk.PostProcessing,
+		Structures:     chunk.Structures,
 	}
-	return c, nil
+	return c, extra, nil
 }
 
 func (p *ChunkProvider) getRegion(rx, rz int) (*region.Region, error) {
@@ -92,70 +119,131 @@ func (p *ChunkProvider) getRegion(rx, rz int) (*region.Region, error) {
 	return r, err
 }
 
-func (p *ChunkProvider) PutChunk(pos [2]int32, c *level.Chunk) (err error) {
-	//var chunk save.Chunk
-	//err = level.ChunkToSave(c, &chunk)
-	//if err != nil {
-	//	return fmt.Errorf("encode chunk data fail: %w", err)
-	//}
-	//
-	//data, err := chunk.Data(1)
-	//if err != nil {
-	//	return fmt.Errorf("record chunk data fail: %w", err)
-	//}
-	//
-	//r, err := p.getRegion(region.At(int(pos[0]), int(pos[1])))
-	//if err != nil {
-	//	return fmt.Errorf("open region fail: %w", err)
-	//}
-	//defer func(r *region.Region) {
-	//	err2 := r.Close()
-	//	if err == nil && err2 != nil {
-	//		err = fmt.Errorf("open region fail: %w", err)
-	//	}
-	//}(r)
-	//
-	//x, z := region.In(int(pos[0]), int(pos[1]))
-	//err = r.WriteSector(x, z, data)
-	//if err != nil {
-	//	return fmt.Errorf("write sector fail: %w", err)
-	//}
+// PutChunk encodes the chunk and writes it back to the region file it belongs to.
+// The extra data loaded with the chunk is kept, and the empty ones are written for generated chunks.
+func (p *ChunkProvider) PutChunk(pos [2]int32, c *level.Chunk, extra ChunkExtra) (errRet error) {
+	chunk := save.Chunk{
+		DataVersion:    dataVersion,
+		XPos:           pos[0],
+		YPos:           p.minSectionY,
+		ZPos:           pos[1],
+		Heightmaps:     make(map[string][]uint64),
+		BlockTicks:     orEmpty(extra.BlockTicks, emptyList),
+		FluidTicks:     orEmpty(extra.FluidTicks, emptyList),
+		PostProcessing: orEmpty(extra.PostProcessing, emptyList),
+		Structures:     orEmpty(extra.Structures, emptyCompound),
+	}
+	err := level.ChunkToSave(c, &chunk)
+	if err != nil {
+		return fmt.Errorf("encode chunk data fail: %w", err)
+	}
+	chunk.BlockEntities = make([]nbt.RawMessage, len(c.BlockEntity))
+	for i, v := range c.BlockEntity {
+		chunk.BlockEntities[i] = v.Data
+	}
 
+	data, err := encodeChunk(&chunk)
+	if err != nil {
+		return fmt.Errorf("record chunk data fail: %w", err)
+	}
+
+	r, err := p.getRegion(region.At(int(pos[0]), int(pos[1])))
+	if err != nil {
+		return fmt.Errorf("open region fail: %w", err)
+	}
+	defer func(r *region.Region) {
+		err2 := r.Close()
+		if errRet == nil && err2 != nil {
+			errRet = fmt.Errorf("close region fail: %w", err2)
+		}
+	}(r)
+
+	x, z := region.In(int(pos[0]), int(pos[1]))
+	err = r.WriteSector(x, z, data)
+	if err != nil {
+		return fmt.Errorf("write sector fail: %w", err)
+	}
 	return nil
 }
 
+// encodeChunk serializes the chunk as the zlib compressed sector data.
+// save.Chunk.Data is not used because it never flushes the compressor.
+func encodeChunk(c *save.Chunk) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte(2) // compression type: zlib
+	w := zlib.NewWriter(&buf)
+	if err := nbt.NewEncoder(w).Encode(c, ""); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var (
+	emptyList     = nbt.RawMessage{Type: nbt.TagList, Data: []byte{nbt.TagEnd, 0, 0, 0, 0}}
+	emptyCompound = nbt.RawMessage{Type: nbt.TagCompound, Data: []byte{nbt.TagEnd}}
+)
+
+// orEmpty returns the tag, or the empty one if it doesn't exist, since the encoder requires valid tags.
+func orEmpty(tag, empty nbt.RawMessage) nbt.RawMessage {
+	if tag.Type == nbt.TagEnd {
+		return empty
+	}
+	return tag
+}
+
 var errChunkNotExist = errors.New("ErrChunkNotExist")
 
 type PlayerProvider struct {
-	dir string
+	dir   string
+	saves *playerSaves
 }
 
 func NewPlayerProvider(dir string) PlayerProvider {
-	return PlayerProvider{dir: dir}
+	return PlayerProvider{dir: dir, saves: &playerSaves{players: make(map[uuid.UUID]*playerSave)}}
+}
+
+// playerSaves serializes the writes of each player,
+// so the autosave and the save on leave don't read and write the same file concurrently.
+type playerSaves struct {
+	sync.Mutex
+	version uint64
+	players map[uuid.UUID]*playerSave
+}
+
+// playerSave is the write lock of a player and the version of its latest written data.
+// They are never removed, since a delayed older snapshot must still be skipped after the player left.
+type playerSave struct {
+	sync.Mutex
+	version uint64
+}
+
+// nextVersion returns the version of a new snapshot of player data, greater than all previous ones.
+func (s *playerSaves) nextVersion() uint64 {
+	s.Lock()
+	defer s.Unlock()
+	s.version++
+	return s.version
+}
+
+func (s *playerSaves) player(id uuid.UUID) *playerSave {
+	s.Lock()
+	defer s.Unlock()
+	save, ok := s.players[id]
+	if !ok {
+		save = new(playerSave)
+		s.players[id] = save
+	}
+	return save
 }
 
 func (p *PlayerProvider) GetPlayer(name string, id uuid.UUID, pubKey *user.PublicKey, properties []user.Property) (player *Player, errRet error) {
-	f, err := os.Open(filepath.Join(p.dir, id.String()+".dat"))
-	if err != nil {
+	var data playerData
+	if err := p.readPlayerData(id, &data); err != nil {
 		return nil, err
 	}
-	defer func(f *os.File) {
-		err2 := f.Close()
-		if errRet == nil && err2 != nil {
-			errRet = fmt.Errorf("close player data fail: %w", err2)
-		}
-	}(f)
-	r, err := gzip.NewReader(f)
-	if err != nil {
-		return nil, fmt.Errorf("open gzip reader fail: %w", err)
-	}
-	data, err := save.ReadPlayerData(r)
-	if err != nil {
-		return nil, fmt.Errorf("read player data fail: %w", err)
-	}
-	if err := r.Close(); err != nil {
-		return nil, fmt.Errorf("close gzip reader fail: %w", err)
-	}
 	player = &Player{
 		Entity: Entity{
 			EntityID: NewEntityID(),
@@ -171,9 +259,280 @@ func (p *PlayerProvider) GetPlayer(name string, id uuid.UUID, pubKey *user.Publi
 			int32(data.Pos[1]) >> 5,
 			int32(data.Pos[2]) >> 5,
 		},
-		Gamemode:       data.PlayerGameType,
+		Dimension:      data.Dimension,
 		EntitiesInView: make(map[int32]*Entity),
 		ViewDistance:   10,
 	}
+	player.OnGround = data.OnGround != 0
+	player.SetGamemode(data.PlayerGameType)
+	if data.SelectedItemSlot >= 0 && data.SelectedItemSlot < 9 {
+		player.Inputs.HeldSlot = int16(data.SelectedItemSlot)
+	}
+	for _, v := range data.Inventory {
+		slot, ok := windowSlot(v.Slot)
+		if !ok {
+			continue
+		}
+		id, ok := itemIDs[strings.TrimPrefix(v.ID, "minecraft:")]
+		if !ok {
+			continue
+		}
+		stack := ItemStack{ID: id, Count: v.Count}
+		if v.Tag != nil {
+			stack.Tag = *v.Tag
+		}
+		player.Inventory.Slots[slot] = stack
+	}
 	return
 }
+
+// readPlayerData decodes the <uuid>.dat file to v.
+func (p *PlayerProvider) readPlayerData(id uuid.UUID, v any) (errRet error) {
+	f, err := os.Open(filepath.Join(p.dir, id.String()+".dat"))
+	if err != nil {
+		return err
+	}
+	defer func(f *os.File) {
+		err2 := f.Close()
+		if errRet == nil && err2 != nil {
+			errRet = fmt.Errorf("close player data fail: %w", err2)
+		}
+	}(f)
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("open gzip reader fail: %w", err)
+	}
+	if _, err := nbt.NewDecoder(r).Decode(v); err != nil {
+		return fmt.Errorf("read player data fail: %w", err)
+	}
+	if err := r.Close(); err != nil {
+		return fmt.Errorf("close gzip reader fail: %w", err)
+	}
+	return nil
+}
+
+// PutPlayer writes the player data to the <uuid>.dat file in the same format as vanilla.
+// The data is written to a temporary file and then renamed,
+// so the old file is still complete if the server crashes while writing.
+func (p *PlayerProvider) PutPlayer(player *Player) error {
+	version := p.saves.nextVersion()
+	return p.putPlayerData(player.UUID, newPlayerData(player, player.Dimension), version)
+}
+
+// putPlayerData merges the data into the <uuid>.dat file.
+// Only the fields of playerData are replaced, others like the health, effects and ender items are kept as they are.
+// The data is skipped if it's older than the version already written, like an autosave finishing after the player left.
+func (p *PlayerProvider) putPlayerData(id uuid.UUID, data *playerData, version uint64) error {
+	save := p.saves.player(id)
+	save.Lock()
+	defer save.Unlock()
+	if version < save.version {
+		return nil
+	}
+	if err := p.writePlayerData(id, data); err != nil {
+		return err
+	}
+	save.version = version
+	return nil
+}
+
+func (p *PlayerProvider) writePlayerData(id uuid.UUID, data *playerData) (errRet error) {
+	tags, err := p.mergePlayerData(id, data)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(p.dir, 0o755); err != nil {
+		return fmt.Errorf("create player data directory fail: %w", err)
+	}
+	f, err := os.CreateTemp(p.dir, id.String()+"-*.dat")
+	if err != nil {
+		return fmt.Errorf("create temporary player data fail: %w", err)
+	}
+	defer func() {
+		// the temporary file is removed unless it has been renamed successfully.
+		if errRet != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	w := gzip.NewWriter(f)
+	if err := nbt.NewEncoder(w).Encode(tags, ""); err != nil {
+		return fmt.Errorf("write player data fail: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("close gzip writer fail: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("sync player data fail: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close player data fail: %w", err)
+	}
+	if err := os.Rename(f.Name(), filepath.Join(p.dir, id.String()+".dat")); err != nil {
+		return fmt.Errorf("rename player data fail: %w", err)
+	}
+	return nil
+}
+
+// mergePlayerData returns the tags of the existing player data file with the fields of data replaced.
+// For a new player, the fields not tracked by Player are set to the values of a newly spawned vanilla player.
+func (p *PlayerProvider) mergePlayerData(id uuid.UUID, data *playerData) (map[string]nbt.RawMessage, error) {
+	tags := make(map[string]nbt.RawMessage)
+	if err := p.readPlayerData(id, &tags); errors.Is(err, fs.ErrNotExist) {
+		if err := mergeTags(tags, newPlayerDefaults); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	if err := mergeTags(tags, data); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// mergeTags encodes v as a compound tag, and puts its fields to the tags.
+func mergeTags(tags map[string]nbt.RawMessage, v any) error {
+	var buf bytes.Buffer
+	if err := nbt.NewEncoder(&buf).Encode(v, ""); err != nil {
+		return fmt.Errorf("encode player data fail: %w", err)
+	}
+	var fields map[string]nbt.RawMessage
+	if _, err := nbt.NewDecoder(&buf).Decode(&fields); err != nil {
+		return fmt.Errorf("decode player data fail: %w", err)
+	}
+	for k, v := range fields {
+		tags[k] = v
+	}
+	return nil
+}
+
+// newPlayerDefaults is the data not tracked by Player, which is only written for new players.
+var newPlayerDefaults = struct {
+	Motion         [3]float64
+	Health         float32
+	FoodLevel      int32   `nbt:"foodLevel"`
+	FoodSaturation float32 `nbt:"foodSaturationLevel"`
+}{Health: 20, FoodLevel: 20, FoodSaturation: 5}
+
+// playerData is the part of save.PlayerData tracked by Player, with the item tags stored as raw NBT.
+type playerData struct {
+	DataVersion int32
+
+	Dimension string
+	Pos       [3]float64
+	Rotation  [2]float32
+	OnGround  byte
+	UUID      [4]int32
+
+	PlayerGameType   int32 `nbt:"playerGameType"`
+	SelectedItemSlot int32
+	Inventory        []playerItem
+
+	Abilities struct {
+		FlySpeed     float32 `nbt:"flySpeed"`
+		WalkSpeed    float32 `nbt:"walkSpeed"`
+		Flying       byte    `nbt:"flying"`
+		InstantBuild byte    `nbt:"instabuild"`
+		Invulnerable byte    `nbt:"invulnerable"`
+		MayBuild     byte    `nbt:"mayBuild"`
+		MayFly       byte    `nbt:"mayfly"`
+	} `nbt:"abilities"`
+}
+
+// The slots in the player data are numbered differently from the inventory window:
+// 0-8 for the hotbar, 9-35 for the main inventory, 100-103 for the armors from feet to head and -106 for the off hand.
+const (
+	dataSlotArmorStart = 100
+	dataSlotOffhand    = -106
+)
+
+// windowSlot converts the slot in the player data to the slot of the inventory window.
+func windowSlot(slot int8) (int, bool) {
+	switch {
+	case slot >= 0 && slot < 9:
+		return SlotHotbarStart + int(slot), true
+	case slot >= 9 && slot < 36:
+		return int(slot), true
+	case slot >= dataSlotArmorStart && slot < dataSlotArmorStart+4:
+		return SlotArmorStart + 3 - int(slot-dataSlotArmorStart), true
+	case slot == dataSlotOffhand:
+		return SlotOffhand, true
+	}
+	return 0, false
+}
+
+// dataSlot converts the slot of the inventory window to the slot in the player data.
+// The crafting grid isn't saved.
+func dataSlot(slot int) (int8, bool) {
+	switch {
+	case slot >= SlotHotbarStart && slot < SlotOffhand:
+		return int8(slot - SlotHotbarStart), true
+	case slot >= SlotMainStart && slot < SlotHotbarStart:
+		return int8(slot), true
+	case slot >= SlotArmorStart && slot < SlotMainStart:
+		return int8(dataSlotArmorStart + 3 - (slot - SlotArmorStart)), true
+	case slot == SlotOffhand:
+		return dataSlotOffhand, true
+	}
+	return 0, false
+}
+
+type playerItem struct {
+	Count int8
+	Slot  int8
+	ID    string          `nbt:"id"`
+	Tag   *nbt.RawMessage `nbt:"tag,omitempty"`
+}
+
+// newPlayerData records the player as it is in the dimension.
+func newPlayerData(p *Player, dimension string) *playerData {
+	p.Inputs.Lock()
+	heldSlot := p.Inputs.HeldSlot
+	p.Inputs.Unlock()
+
+	data := &playerData{
+		DataVersion:      dataVersion,
+		Dimension:        dimension,
+		Pos:              p.Position,
+		Rotation:         p.Rotation,
+		PlayerGameType:   p.Gamemode(),
+		SelectedItemSlot: int32(heldSlot),
+		Inventory:        []playerItem{},
+	}
+	if p.OnGround {
+		data.OnGround = 1
+	}
+	for i := range data.UUID {
+		data.UUID[i] = int32(binary.BigEndian.Uint32(p.UUID[i*4:]))
+	}
+	p.Inventory.Lock()
+	slots := p.Inventory.Slots
+	p.Inventory.Unlock()
+	for i, stack := range slots {
+		it, ok := item.ByID[stack.ID]
+		slot, saved := dataSlot(i)
+		if stack.IsEmpty() || !ok || !saved {
+			continue
+		}
+		v := playerItem{Count: stack.Count, Slot: slot, ID: "minecraft:" + it.Name}
+		if stack.Tag.Type == nbt.TagCompound {
+			tag := stack.Tag
+			v.Tag = &tag
+		}
+		data.Inventory = append(data.Inventory, v)
+	}
+
+	abilities := &data.Abilities
+	abilities.FlySpeed, abilities.WalkSpeed = 0.05, 0.1
+	switch p.Gamemode() {
+	case 0: // survival
+		abilities.MayBuild = 1
+	case 1: // creative
+		abilities.MayBuild, abilities.InstantBuild, abilities.Invulnerable, abilities.MayFly = 1, 1, 1, 1
+	case 3: // spectator
+		abilities.Flying, abilities.Invulnerable, abilities.MayFly = 1, 1, 1
+	}
+	return data
+}
@@ -0,0 +1,78 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package world
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPlayerProvider_staleSnapshot(t *testing.T) {
+	p := NewPlayerProvider(t.TempDir())
+	id := uuid.New()
+
+	// the autosave copies the data before the player leaves, but writes it after the save on leave.
+	snapshot := p.saves.nextVersion()
+	player := &Player{UUID: id, Entity: Entity{Position: [3]float64{1, 2, 3}}, Dimension: "minecraft:overworld"}
+	if err := p.PutPlayer(player); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.putPlayerData(id, &playerData{Dimension: "minecraft:overworld", Pos: [3]float64{4, 5, 6}}, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	var data playerData
+	if err := p.readPlayerData(id, &data); err != nil {
+		t.Fatal(err)
+	}
+	if data.Pos != player.Position {
+		t.Errorf("position is %v, want the one saved on leave %v", data.Pos, player.Position)
+	}
+
+	// a newer snapshot is written as usual.
+	if err := p.putPlayerData(id, &playerData{Dimension: "minecraft:overworld", Pos: [3]float64{7, 8, 9}}, p.saves.nextVersion()); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.readPlayerData(id, &data); err != nil {
+		t.Fatal(err)
+	}
+	if want := [3]float64{7, 8, 9}; data.Pos != want {
+		t.Errorf("position is %v, want %v", data.Pos, want)
+	}
+}
+
+func TestPlayerProvider_concurrentWrites(t *testing.T) {
+	p := NewPlayerProvider(t.TempDir())
+	id := uuid.New()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			player := &Player{UUID: id, Entity: Entity{Position: [3]float64{float64(i), 0, 0}}}
+			if err := p.PutPlayer(player); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	var data playerData
+	if err := p.readPlayerData(id, &data); err != nil {
+		t.Fatal(err)
+	}
+}
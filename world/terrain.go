@@ -0,0 +1,284 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package world
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/Tnze/go-mc/level"
+	"github.com/Tnze/go-mc/level/block"
+	"github.com/go-mc/server/world/internal/noise"
+)
+
+// seaLevel is the Y coordinate of the first air block above the sea.
+const seaLevel = 63
+
+// NoiseGenerator generates the terrain with several layers of Perlin noise.
+// The result is determined by the seed, so every chunk can be generated independently and in any order.
+type NoiseGenerator struct {
+	GeneratorContext
+
+	continentalness *noise.Octaves
+	hills           *noise.Octaves
+	detail          *noise.Octaves
+	temperature     *noise.Octaves
+	humidity        *noise.Octaves
+	spaghetti       [2]*noise.Octaves
+	cheese          *noise.Octaves
+}
+
+func newNoiseGenerator(ctx GeneratorContext, _ map[string]any) (ChunkGenerator, error) {
+	return NewNoiseGenerator(ctx), nil
+}
+
+func NewNoiseGenerator(ctx GeneratorContext) *NoiseGenerator {
+	r := rand.New(rand.NewSource(ctx.Seed))
+	return &NoiseGenerator{
+		GeneratorContext: ctx,
+		continentalness:  noise.NewOctaves(r.Int63(), 4, 1.0/512),
+		hills:            noise.NewOctaves(r.Int63(), 4, 1.0/128),
+		detail:           noise.NewOctaves(r.Int63(), 3, 1.0/32),
+		temperature:      noise.NewOctaves(r.Int63(), 3, 1.0/1024),
+		humidity:         noise.NewOctaves(r.Int63(), 3, 1.0/1024),
+		spaghetti: [2]*noise.Octaves{
+			noise.NewOctaves(r.Int63(), 2, 1.0/64),
+			noise.NewOctaves(r.Int63(), 2, 1.0/64),
+		},
+		cheese: noise.NewOctaves(r.Int63(), 2, 1.0/96),
+	}
+}
+
+var (
+	caveAirState   = block.ToStateID[block.CaveAir{}]
+	stoneState     = block.ToStateID[block.Stone{}]
+	deepslateState = block.ToStateID[block.Deepslate{Axis: block.Y}]
+	bedrockState   = block.ToStateID[block.Bedrock{}]
+	dirtState      = block.ToStateID[block.Dirt{}]
+	grassState     = block.ToStateID[block.GrassBlock{}]
+	sandState      = block.ToStateID[block.Sand{}]
+	sandstoneState = block.ToStateID[block.Sandstone{}]
+	gravelState    = block.ToStateID[block.Gravel{}]
+	snowState      = block.ToStateID[block.SnowBlock{}]
+	iceState       = block.ToStateID[block.Ice{}]
+	waterState     = block.ToStateID[block.Water{}]
+	lavaState      = block.ToStateID[block.Lava{}]
+)
+
+// terrainBiome describes how the surface of a biome is built.
+type terrainBiome struct {
+	id         level.BiomesState
+	top, under block.StateID
+	// frozen biomes have their water surface turned into ice
+	frozen bool
+}
+
+func newTerrainBiome(name string, top, under block.StateID, frozen bool) (b terrainBiome) {
+	if err := b.id.UnmarshalText([]byte(name)); err != nil {
+		panic(err)
+	}
+	b.top, b.under, b.frozen = top, under, frozen
+	return
+}
+
+var (
+	biomeOcean       = newTerrainBiome("minecraft:ocean", gravelState, gravelState, false)
+	biomeDeepOcean   = newTerrainBiome("minecraft:deep_ocean", gravelState, gravelState, false)
+	biomeFrozenOcean = newTerrainBiome("minecraft:frozen_ocean", gravelState, gravelState, true)
+	biomeWarmOcean   = newTerrainBiome("minecraft:warm_ocean", sandState, sandState, false)
+	biomeBeach       = newTerrainBiome("minecraft:beach", sandState, sandState, false)
+	biomeSnowyBeach  = newTerrainBiome("minecraft:snowy_beach", sandState, sandState, true)
+	biomePlains      = newTerrainBiome("minecraft:plains", grassState, dirtState, false)
+	biomeForest      = newTerrainBiome("minecraft:forest", grassState, dirtState, false)
+	biomeTaiga       = newTerrainBiome("minecraft:taiga", grassState, dirtState, false)
+	biomeSnowyPlains = newTerrainBiome("minecraft:snowy_plains", snowState, dirtState, true)
+	biomeSnowyTaiga  = newTerrainBiome("minecraft:snowy_taiga", snowState, dirtState, true)
+	biomeDesert      = newTerrainBiome("minecraft:desert", sandState, sandstoneState, false)
+	biomeSavanna     = newTerrainBiome("minecraft:savanna", grassState, dirtState, false)
+	biomeJungle      = newTerrainBiome("minecraft:jungle", grassState, dirtState, false)
+	biomeStonyPeaks  = newTerrainBiome("minecraft:stony_peaks", stoneState, stoneState, false)
+	biomeSnowySlopes = newTerrainBiome("minecraft:snowy_slopes", snowState, stoneState, true)
+)
+
+// column is the result of sampling the 2D noises at a (x, z) position.
+type column struct {
+	height int
+	biome  *terrainBiome
+}
+
+func (g *NoiseGenerator) sampleColumn(x, z int) column {
+	fx, fz := float64(x), float64(z)
+	cont := g.continentalness.Noise2(fx, fz)
+	hills := g.hills.Noise2(fx, fz)
+	detail := g.detail.Noise2(fx, fz)
+	// the inland is higher and hillier than the coast
+	height := seaLevel + cont*96 + hills*48*math.Max(0, cont+0.25) + detail*4
+	col := column{height: int(height)}
+
+	temperature := g.temperature.Noise2(fx, fz)
+	humidity := g.humidity.Noise2(fx, fz)
+	switch {
+	case col.height < seaLevel-16:
+		if temperature < -0.2 {
+			col.biome = &biomeFrozenOcean
+		} else {
+			col.biome = &biomeDeepOcean
+		}
+	case col.height < seaLevel-1:
+		switch {
+		case temperature < -0.2:
+			col.biome = &biomeFrozenOcean
+		case temperature > 0.25:
+			col.biome = &biomeWarmOcean
+		default:
+			col.biome = &biomeOcean
+		}
+	case col.height <= seaLevel+1:
+		if temperature < -0.2 {
+			col.biome = &biomeSnowyBeach
+		} else {
+			col.biome = &biomeBeach
+		}
+	case col.height > seaLevel+72:
+		if temperature < 0 {
+			col.biome = &biomeSnowySlopes
+		} else {
+			col.biome = &biomeStonyPeaks
+		}
+	case temperature < -0.2:
+		if humidity > 0 {
+			col.biome = &biomeSnowyTaiga
+		} else {
+			col.biome = &biomeSnowyPlains
+		}
+	case temperature > 0.25:
+		switch {
+		case humidity < -0.1:
+			col.biome = &biomeDesert
+		case humidity > 0.2:
+			col.biome = &biomeJungle
+		default:
+			col.biome = &biomeSavanna
+		}
+	case humidity > 0.2:
+		col.biome = &biomeTaiga
+	case humidity > 0:
+		col.biome = &biomeForest
+	default:
+		col.biome = &biomePlains
+	}
+	return col
+}
+
+// isCave reports whether the block at (x, y, z) should be carved out.
+func (g *NoiseGenerator) isCave(x, y, z int) bool {
+	fx, fy, fz := float64(x), float64(y)*2, float64(z)
+	// spaghetti caves are the tunnels where two noises are both close to zero.
+	a := g.spaghetti[0].Noise3(fx, fy, fz)
+	b := g.spaghetti[1].Noise3(fx, fy, fz)
+	if a*a+b*b < 0.002 {
+		return true
+	}
+	// cheese caves are the large caverns where the noise is low enough.
+	return g.cheese.Noise3(fx, float64(y), fz) < -0.42
+}
+
+func (g *NoiseGenerator) Generate(pos [2]int32) (*level.Chunk, error) {
+	c := level.EmptyChunk(g.sections())
+	baseX, baseZ := int(pos[0])*16, int(pos[1])*16
+	minY, maxY := int(g.MinY), int(g.MinY+g.Height)-1
+	// caves are carved above the bedrock layers, and filled with lava at the bottom.
+	caveMinY, lavaLevel := minY+6, minY+10
+	// bedrock is placed with a random generator seeded by the chunk position, so it is the same each time.
+	r := rand.New(rand.NewSource(g.Seed ^ int64(pos[0])*341873128712 ^ int64(pos[1])*132897987541))
+
+	var columns [16 * 16]column
+	for z := 0; z < 16; z++ {
+		for x := 0; x < 16; x++ {
+			columns[z*16+x] = g.sampleColumn(baseX+x, baseZ+z)
+		}
+	}
+
+	var surface, floor [16 * 16]int
+	for i, col := range columns {
+		x, z := i%16, i/16
+		// the ground and the sea are clamped to the dimension, which may be lower or higher than the overworld.
+		height := col.height
+		if height > maxY {
+			height = maxY
+		} else if height < minY {
+			height = minY
+		}
+		top := height
+		if top < seaLevel-1 {
+			top = seaLevel - 1
+		}
+		if top > maxY {
+			top = maxY
+		}
+		surface[i], floor[i] = height-minY+1, height-minY+1
+		for y := minY; y <= top; y++ {
+			var state block.StateID
+			switch {
+			case y == minY || y < minY+5 && r.Intn(y-minY+1) == 0:
+				state = bedrockState
+			case y > height:
+				// above the ground but below the sea
+				if y == seaLevel-1 && col.biome.frozen {
+					state = iceState
+				} else {
+					state = waterState
+				}
+				surface[i] = y - minY + 1
+			case y >= caveMinY && y < height-4 && g.isCave(baseX+x, y, baseZ+z):
+				if y <= lavaLevel {
+					state = lavaState
+				} else {
+					state = caveAirState
+				}
+			case y == height:
+				state = col.biome.top
+				if height < seaLevel-1 && state == snowState {
+					state = col.biome.under
+				}
+			case y > height-4:
+				state = col.biome.under
+			case y < 0:
+				state = deepslateState
+			default:
+				state = stoneState
+			}
+			c.Sections[(y-minY)/16].SetBlock(((y-minY)%16)*16*16+z*16+x, state)
+		}
+	}
+	setHeightMaps(c, &surface, &floor)
+
+	// biomes are stored in 4x4x4 cells, each cell uses the biome at its center column.
+	for i := range c.Sections {
+		biomes := c.Sections[i].Biomes
+		for z := 0; z < 4; z++ {
+			for x := 0; x < 4; x++ {
+				id := columns[(z*4+2)*16+x*4+2].biome.id
+				for y := 0; y < 4; y++ {
+					biomes.Set((y*4+z)*4+x, id)
+				}
+			}
+		}
+	}
+	c.Status = level.StatusFull
+	return c, nil
+}
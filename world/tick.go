@@ -23,17 +23,62 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/Tnze/go-mc/chat"
+	"github.com/Tnze/go-mc/level/block"
+	"github.com/go-mc/server/world/entity"
 	"github.com/go-mc/server/world/internal/bvh"
 )
 
+const (
+	TicksPerSecond = 20
+	tickDuration   = time.Second / TicksPerSecond
+	// maxTickLag is how long the world can fall behind the schedule before skipping ticks.
+	// Within the limit, the missed ticks are run as fast as possible to catch up, same as vanilla.
+	maxTickLag = 2 * time.Second
+)
+
 func (w *World) tickLoop() {
+	defer close(w.stopped)
 	var n uint
-	for range time.Tick(time.Microsecond * 20) {
+	next := time.Now()
+	for {
+		start := time.Now()
+		if scheduled := scheduleTick(next, start); scheduled != next {
+			lag := start.Sub(next)
+			w.log.Warn("Can't keep up! Is the server overloaded?",
+				zap.Duration("behind", lag),
+				zap.Int64("skipped ticks", int64(lag/tickDuration)),
+			)
+			next = scheduled
+		}
 		w.tick(n)
+		w.tickStats.record(start, time.Since(start))
 		n++
+
+		next = next.Add(tickDuration)
+		wait := time.Until(next)
+		if wait < 0 {
+			wait = 0
+		}
+		select {
+		case <-w.stop:
+			return
+		case <-time.After(wait):
+		}
 	}
 }
 
+// scheduleTick returns the time the tick starting at now is scheduled at, which is next unless
+// the world falls behind more than maxTickLag, then the missed ticks are skipped.
+func scheduleTick(next, now time.Time) time.Time {
+	if now.Sub(next) > maxTickLag {
+		return now
+	}
+	return next
+}
+
+// TickStats returns the TPS and MSPT statistics of the world.
+func (w *World) TickStats() *TickStats { return w.tickStats }
+
 func (w *World) tick(n uint) {
 	w.tickLock.Lock()
 	defer w.tickLock.Unlock()
@@ -108,6 +153,9 @@ func (w *World) subtickUpdatePlayers() {
 			p.ViewDistance = int32(inputs.ViewDistance)
 			p.view = w.playerViews.Insert(p.getView(), w.playerViews.Delete(p.view))
 		}
+		// the settings of the client shown to other players.
+		entity.SkinParts.Set(&p.Metadata, entity.Byte(inputs.DisplayedSkinParts))
+		entity.MainHand.Set(&p.Metadata, entity.Byte(inputs.MainHand))
 		// delete entities that not in range from entities lists of each player.
 		for id, e := range p.EntitiesInView {
 			if !p.view.Box.WithIn(vec3d(e.Position)) {
@@ -149,81 +197,159 @@ func (w *World) subtickUpdatePlayers() {
 				c.SendDisconnect(chat.TranslateMsg("multiplayer.disconnect.invalid_player_movement"))
 			}
 		}
+		w.updatePose(p, inputs.Sneaking, inputs.Sprinting)
 		p.Inputs.Unlock()
 	}
 }
 
+// updatePose sets the pose and the shared flags of the player, which are sent to the viewers as metadata.
+// Players start swimming when sprinting with their eyes in water, and keep swimming until leaving the water.
+func (w *World) updatePose(p *Player, sneaking, sprinting bool) {
+	swimming := false
+	if sprinting {
+		eyeHeight := 1.62
+		if entity.EntityPose.Get(&p.Metadata) == entity.Swimming {
+			eyeHeight = 0
+		}
+		swimming = w.isWater(p.pos0[0], p.pos0[1]+eyeHeight, p.pos0[2])
+	}
+	entity.SetFlag(&p.Metadata, entity.SharedFlags, entity.FlagCrouching, sneaking)
+	entity.SetFlag(&p.Metadata, entity.SharedFlags, entity.FlagSprinting, sprinting)
+	entity.SetFlag(&p.Metadata, entity.SharedFlags, entity.FlagSwimming, swimming)
+	switch {
+	case swimming:
+		entity.EntityPose.Set(&p.Metadata, entity.Swimming)
+	case sneaking:
+		entity.EntityPose.Set(&p.Metadata, entity.Crouching)
+	default:
+		entity.EntityPose.Set(&p.Metadata, entity.Standing)
+	}
+}
+
+func (w *World) isWater(x, y, z float64) bool {
+	state, ok := w.getBlock([3]int32{int32(math.Floor(x)), int32(math.Floor(y)), int32(math.Floor(z))})
+	if !ok {
+		return false
+	}
+	_, water := block.StateList[state].(block.Water)
+	return water
+}
+
 func (w *World) subtickUpdateEntities() {
-	// TODO: entity list should be traversed here, but players are the only entities now.
-	for _, e := range w.players {
-		// sending Update Entity Position pack to every player who can see it, when it moves.
-		var delta [3]int16
-		var rot [2]int8
-		if e.Position != e.pos0 { // TODO: send Teleport Entity pack instead when moving distance is greater than 8.
-			delta = [3]int16{
-				int16((e.pos0[0] - e.Position[0]) * 32 * 128),
-				int16((e.pos0[1] - e.Position[1]) * 32 * 128),
-				int16((e.pos0[2] - e.Position[2]) * 32 * 128),
+	for c, p := range w.players {
+		w.updateEntity(&p.Entity, func(v EntityViewer) {
+			v.ViewAddPlayer(p)
+			sendAllEntityData(v, &p.Entity)
+		})
+		w.sendEntityData(&p.Entity, c)
+	}
+	for _, e := range w.entities {
+		e.tickMovement()
+		w.updateEntity(&e.Entity, func(v EntityViewer) {
+			v.ViewAddEntity(e)
+			sendAllEntityData(v, &e.Entity)
+		})
+		w.sendEntityData(&e.Entity, nil)
+	}
+}
+
+// sendEntityData sends the changed metadata of the entity to the players who can see it,
+// and to the player itself if self isn't nil.
+func (w *World) sendEntityData(e *Entity, self EntityViewer) {
+	dirty := e.Metadata.Dirty()
+	if len(dirty) == 0 {
+		return
+	}
+	e.Metadata.ClearDirty()
+	if self != nil {
+		self.ViewSetEntityData(e.EntityID, dirty)
+	}
+	w.playerViews.Find(bvh.TouchPoint[vec3d, aabb3d](vec3d(e.Position)),
+		func(n *playerViewNode) bool {
+			if _, ok := n.Value.EntitiesInView[e.EntityID]; ok {
+				n.Value.ViewSetEntityData(e.EntityID, dirty)
 			}
+			return true
+		},
+	)
+}
+
+// sendAllEntityData sends all the metadata of the entity to a new viewer.
+func sendAllEntityData(v EntityViewer, e *Entity) {
+	if data := e.Metadata.All(); len(data) > 0 {
+		v.ViewSetEntityData(e.EntityID, data)
+	}
+}
+
+// updateEntity sends the movement of the entity to the players who can see it.
+// The entity is added to the players who can see it but haven't, by the spawn function.
+func (w *World) updateEntity(e *Entity, spawn func(v EntityViewer)) {
+	// sending Update Entity Position pack to every player who can see it, when it moves.
+	var delta [3]int16
+	var rot [2]int8
+	if e.Position != e.pos0 { // TODO: send Teleport Entity pack instead when moving distance is greater than 8.
+		delta = [3]int16{
+			int16((e.pos0[0] - e.Position[0]) * 32 * 128),
+			int16((e.pos0[1] - e.Position[1]) * 32 * 128),
+			int16((e.pos0[2] - e.Position[2]) * 32 * 128),
 		}
-		if e.Rotation != e.rot0 {
-			rot = [2]int8{
-				int8(e.rot0[0] * 256 / 360),
-				int8(e.rot0[1] * 256 / 360),
-			}
+	}
+	if e.Rotation != e.rot0 {
+		rot = [2]int8{
+			int8(e.rot0[0] * 256 / 360),
+			int8(e.rot0[1] * 256 / 360),
 		}
-		cond := bvh.TouchPoint[vec3d, aabb3d](vec3d(e.Position))
-		w.playerViews.Find(cond,
-			func(n *playerViewNode) bool {
-				if n.Value.Player == e {
-					return true // don't send the player self to the player
-				}
-				// check if the current entity is in range of player visual. if so, moving data will be forwarded.
-				if _, ok := n.Value.EntitiesInView[e.EntityID]; !ok {
-					// add the entity to the entity list of the player
-					n.Value.ViewAddPlayer(e)
-					n.Value.EntitiesInView[e.EntityID] = &e.Entity
-				}
-				return true
-			},
-		)
-		var sendMove func(v EntityViewer)
-		switch {
-		case e.Position != e.pos0 && e.Rotation != e.rot0:
-			sendMove = func(v EntityViewer) {
-				v.ViewMoveEntityPosAndRot(e.EntityID, delta, rot, bool(e.OnGround))
-				v.ViewRotateHead(e.EntityID, rot[0])
-			}
-		case e.Position != e.pos0:
-			sendMove = func(v EntityViewer) {
-				v.ViewMoveEntityPos(e.EntityID, delta, bool(e.OnGround))
+	}
+	cond := bvh.TouchPoint[vec3d, aabb3d](vec3d(e.Position))
+	w.playerViews.Find(cond,
+		func(n *playerViewNode) bool {
+			if &n.Value.Player.Entity == e {
+				return true // don't send the player self to the player
 			}
-		case e.Rotation != e.rot0:
-			sendMove = func(v EntityViewer) {
-				v.ViewMoveEntityRot(e.EntityID, rot, bool(e.OnGround))
-				v.ViewRotateHead(e.EntityID, rot[0])
+			// check if the current entity is in range of player visual. if so, moving data will be forwarded.
+			if _, ok := n.Value.EntitiesInView[e.EntityID]; !ok {
+				// add the entity to the entity list of the player
+				spawn(n.Value.EntityViewer)
+				n.Value.EntitiesInView[e.EntityID] = e
 			}
-		default:
-			continue
+			return true
+		},
+	)
+	var sendMove func(v EntityViewer)
+	switch {
+	case e.Position != e.pos0 && e.Rotation != e.rot0:
+		sendMove = func(v EntityViewer) {
+			v.ViewMoveEntityPosAndRot(e.EntityID, delta, rot, bool(e.OnGround))
+			v.ViewRotateHead(e.EntityID, rot[0])
 		}
-		e.Position = e.pos0
-		e.Rotation = e.rot0
-		w.playerViews.Find(cond,
-			func(n *playerViewNode) bool {
-				if n.Value.Player == e {
-					return true // not sending self movements to player self.
-				}
-				// check if the current entity is in the player visual entities list. if so, moving data will be forwarded.
-				if _, ok := n.Value.EntitiesInView[e.EntityID]; ok {
-					sendMove(n.Value.EntityViewer)
-				} else {
-					// or the entity will be add to the entities list of the player
-					// TODO: deal with the situation that the entity is not a player
-					n.Value.ViewAddPlayer(e)
-					n.Value.EntitiesInView[e.EntityID] = &e.Entity
-				}
-				return true
-			},
-		)
+	case e.Position != e.pos0:
+		sendMove = func(v EntityViewer) {
+			v.ViewMoveEntityPos(e.EntityID, delta, bool(e.OnGround))
+		}
+	case e.Rotation != e.rot0:
+		sendMove = func(v EntityViewer) {
+			v.ViewMoveEntityRot(e.EntityID, rot, bool(e.OnGround))
+			v.ViewRotateHead(e.EntityID, rot[0])
+		}
+	default:
+		return
 	}
+	e.Position = e.pos0
+	e.Rotation = e.rot0
+	w.playerViews.Find(cond,
+		func(n *playerViewNode) bool {
+			if &n.Value.Player.Entity == e {
+				return true // not sending self movements to player self.
+			}
+			// check if the current entity is in the player visual entities list. if so, moving data will be forwarded.
+			if _, ok := n.Value.EntitiesInView[e.EntityID]; ok {
+				sendMove(n.Value.EntityViewer)
+			} else {
+				// or the entity will be add to the entities list of the player
+				spawn(n.Value.EntityViewer)
+				n.Value.EntitiesInView[e.EntityID] = e
+			}
+			return true
+		},
+	)
 }
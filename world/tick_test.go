@@ -0,0 +1,105 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package world
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// simulateTicks runs the schedule of the tick loop with a fake clock, the tick after the first 10 ticks stalls the world.
+// It returns the number of ticks started without waiting, which are catching up.
+func simulateTicks(stall time.Duration) (catchUp int) {
+	now := time.Unix(0, 0)
+	next := now
+	for i := 0; i < 200; i++ {
+		next = scheduleTick(next, now)
+		if i == 10 {
+			now = now.Add(stall)
+		}
+		next = next.Add(tickDuration)
+		if wait := next.Sub(now); wait > 0 {
+			now = now.Add(wait)
+		} else {
+			catchUp++
+		}
+	}
+	return
+}
+
+func TestScheduleTick(t *testing.T) {
+	for _, tt := range []struct {
+		stall time.Duration
+		want  int
+	}{
+		{0, 0},
+		{tickDuration, 1},
+		// the missed ticks are run at once
+		{time.Second, TicksPerSecond},
+		{maxTickLag, int(maxTickLag / tickDuration)},
+		// too far behind, the missed ticks are skipped
+		{3 * time.Second, 1},
+	} {
+		if got := simulateTicks(tt.stall); got != tt.want {
+			t.Errorf("stall %v: %d ticks are run without waiting, want %d", tt.stall, got, tt.want)
+		}
+	}
+}
+
+// recordTicks records n ticks started every interval, each spends d.
+func recordTicks(s *TickStats, start time.Time, n int, interval, d time.Duration) time.Time {
+	for i := 0; i < n; i++ {
+		s.record(start, d)
+		start = start.Add(interval)
+	}
+	return start
+}
+
+func TestTickStats(t *testing.T) {
+	s := newTickStats()
+	if got := s.MSPT(); got != 0 {
+		t.Errorf("got MSPT %v before any tick", got)
+	}
+	now := recordTicks(s, time.Unix(0, 0), 60*TicksPerSecond, tickDuration, 10*time.Millisecond)
+	if got := s.TPS(); got != [3]float64{20, 20, 20} {
+		t.Errorf("got TPS %v, want 20", got)
+	}
+	if got := s.MSPT(); got != 10*time.Millisecond {
+		t.Errorf("got MSPT %v, want 10ms", got)
+	}
+
+	// catching up doesn't make TPS higher than 20
+	now = recordTicks(s, now, 10*TicksPerSecond, tickDuration/2, 10*time.Millisecond)
+	if got := s.TPS(); got != [3]float64{20, 20, 20} {
+		t.Errorf("got TPS %v after catching up, want 20", got)
+	}
+
+	// lagging, the 1-minute average drops faster than the others
+	recordTicks(s, now, 60*TicksPerSecond, 2*tickDuration, 30*time.Millisecond)
+	tps := s.TPS()
+	if !(tps[0] < tps[1] && tps[1] < tps[2] && tps[2] < 20) {
+		t.Errorf("got TPS %v, want decreasing averages below 20", tps)
+	}
+	if want := 10 + 10*math.Exp(-1); math.Abs(tps[0]-want) > 0.1 {
+		t.Errorf("got 1-minute TPS %v, want %v", tps[0], want)
+	}
+	// MSPT only counts the last 100 ticks
+	if got := s.MSPT(); got != 30*time.Millisecond {
+		t.Errorf("got MSPT %v, want 30ms", got)
+	}
+}
@@ -0,0 +1,93 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package world
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// tpsSampleTicks is the number of ticks between two TPS samples, which is one second if the world isn't lagging.
+const tpsSampleTicks = TicksPerSecond
+
+// tpsDecay are the factors of the exponential moving averages over 1, 5 and 15 minutes,
+// each sample is taken every second.
+var tpsDecay = [3]float64{
+	math.Exp(-1.0 / 60),
+	math.Exp(-1.0 / (5 * 60)),
+	math.Exp(-1.0 / (15 * 60)),
+}
+
+// TickStats records the time spent by the ticks of a World.
+type TickStats struct {
+	lock sync.Mutex
+	// tps is the rolling average TPS over 1, 5 and 15 minutes.
+	tps [3]float64
+	// durations is a ring buffer of the time spent by the last 100 ticks, for MSPT.
+	durations [100]time.Duration
+	n         int
+	// sampleStart is the start time of the first tick in the current TPS sample.
+	sampleStart time.Time
+}
+
+func newTickStats() *TickStats {
+	return &TickStats{tps: [3]float64{TicksPerSecond, TicksPerSecond, TicksPerSecond}}
+}
+
+// record is called after every tick, start is the time the tick started and d is the time it spent.
+func (s *TickStats) record(start time.Time, d time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.n%tpsSampleTicks == 0 {
+		if !s.sampleStart.IsZero() {
+			elapsed := start.Sub(s.sampleStart)
+			tps := math.Min(TicksPerSecond, float64(tpsSampleTicks)/elapsed.Seconds())
+			for i, decay := range tpsDecay {
+				s.tps[i] = s.tps[i]*decay + tps*(1-decay)
+			}
+		}
+		s.sampleStart = start
+	}
+	s.durations[s.n%len(s.durations)] = d
+	s.n++
+}
+
+// TPS returns the average ticks per second in the last 1, 5 and 15 minutes. The maximum is 20.
+func (s *TickStats) TPS() [3]float64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.tps
+}
+
+// MSPT returns the average time spent by the last 100 ticks.
+func (s *TickStats) MSPT() time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	count := s.n
+	if count > len(s.durations) {
+		count = len(s.durations)
+	}
+	if count == 0 {
+		return 0
+	}
+	var sum time.Duration
+	for _, d := range s.durations[:count] {
+		sum += d
+	}
+	return sum / time.Duration(count)
+}
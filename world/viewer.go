@@ -19,6 +19,8 @@ package world
 import (
 	"github.com/Tnze/go-mc/chat"
 	"github.com/Tnze/go-mc/level"
+	"github.com/Tnze/go-mc/level/block"
+	"github.com/go-mc/server/world/entity"
 )
 
 type Client interface {
@@ -32,10 +34,16 @@ type Client interface {
 type ChunkViewer interface {
 	ViewChunkLoad(pos level.ChunkPos, c *level.Chunk)
 	ViewChunkUnload(pos level.ChunkPos)
+	ViewBlockUpdate(pos [3]int32, state block.StateID)
+	ViewSectionBlocksUpdate(sectionPos [3]int32, changes []BlockChange)
 }
 
 type EntityViewer interface {
 	ViewAddPlayer(p *Player)
+	ViewAddEntity(e *GenericEntity)
+	ViewSetEntityData(id int32, data entity.MetadataSet)
+	ViewAnimate(id int32, animation byte)
+	ViewHurtAnimation(id int32, yaw float32)
 	ViewRemoveEntities(entityIDs []int32)
 	ViewMoveEntityPos(id int32, delta [3]int16, onGround bool)
 	ViewMoveEntityPosAndRot(id int32, delta [3]int16, rot [2]int8, onGround bool)
@@ -17,14 +17,16 @@
 package world
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
 	"errors"
 	"sync"
 
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 	"golang.org/x/time/rate"
 
 	"github.com/Tnze/go-mc/level"
-	"github.com/Tnze/go-mc/level/block"
 	"github.com/go-mc/server/world/internal/bvh"
 )
 
@@ -33,20 +35,34 @@ type World struct {
 	config        Config
 	chunkProvider ChunkProvider
 
-	chunks   map[[2]int32]*LoadedChunk
-	loaders  map[ChunkViewer]*loader
-	tickLock sync.Mutex
+	// minY is the Y coordinate of the lowest block in the dimension.
+	minY      int32
+	chunks    map[[2]int32]*LoadedChunk
+	loaders   map[ChunkViewer]*loader
+	tickLock  sync.Mutex
+	tickStats *TickStats
+	// stop is closed to stop the tick loop, and stopped is closed when the tick loop exits.
+	stop, stopped chan struct{}
 
 	// playerViews is a BVH tree，storing the visual range collision boxes of each player.
 	// the data structure is used to determine quickly which players to send notify when entity moves.
 	playerViews playerViewTree
 	players     map[Client]*Player
+	// entities are the non-player entities in the world, keyed by the entity IDs.
+	entities map[int32]*GenericEntity
 }
 
 type Config struct {
+	// Name is the dimension name of the world, like "minecraft:overworld".
+	Name string
+	// DimensionType is one of the dimension types in the NetworkCodec.
+	DimensionType string
 	ViewDistance  int32
 	SpawnAngle    float32
 	SpawnPosition [3]int32
+	Seed          int64
+	// Generator generates the chunks not exist in the provider. Nothing but air is generated if it's nil.
+	Generator ChunkGenerator
 }
 
 type playerView struct {
@@ -62,28 +78,49 @@ type (
 )
 
 func New(logger *zap.Logger, provider ChunkProvider, config Config) (w *World) {
+	var minY, height int32
+	if _, dimType := NetworkCodec.DimensionType.Find(config.DimensionType); dimType != nil {
+		minY, height = dimType.MinY, dimType.Height
+	}
+	if config.Generator == nil {
+		config.Generator = VoidGenerator{Sections: int(height / 16)}
+	}
 	w = &World{
 		log:           logger,
 		config:        config,
+		minY:          minY,
 		chunks:        make(map[[2]int32]*LoadedChunk),
 		loaders:       make(map[ChunkViewer]*loader),
 		players:       make(map[Client]*Player),
+		entities:      make(map[int32]*GenericEntity),
 		chunkProvider: provider,
+		tickStats:     newTickStats(),
+		stop:          make(chan struct{}),
+		stopped:       make(chan struct{}),
 	}
 	go w.tickLoop()
 	return
 }
 
 func (w *World) Name() string {
-	return "minecraft:overworld"
+	return w.config.Name
+}
+
+func (w *World) DimensionType() string {
+	return w.config.DimensionType
 }
 
 func (w *World) SpawnPositionAndAngle() ([3]int32, float32) {
 	return w.config.SpawnPosition, w.config.SpawnAngle
 }
 
-func (w *World) HashedSeed() [8]byte {
-	return [8]byte{}
+// HashedSeed returns the first 8 bytes of the SHA-256 hash of the seed, which is sent to clients for biome noise.
+// Same as vanilla, both the seed and the hash are little-endian.
+func (w *World) HashedSeed() int64 {
+	var seed [8]byte
+	binary.LittleEndian.PutUint64(seed[:], uint64(w.config.Seed))
+	hash := sha256.Sum256(seed[:])
+	return int64(binary.LittleEndian.Uint64(hash[:8]))
 }
 
 func (w *World) AddPlayer(c Client, p *Player, limiter *rate.Limiter) {
@@ -119,30 +156,204 @@ func (w *World) RemovePlayer(c Client, p *Player) {
 			return true
 		},
 	)
+	// the entities of this world are no longer visible to the player.
+	p.EntitiesInView = make(map[int32]*Entity)
+	p.teleport = nil
+}
+
+// AddEntity spawns the entity in the world, it's shown to the players who can see it in the next tick.
+// The EntityID and the UUID are generated if they are not set.
+func (w *World) AddEntity(e *GenericEntity) {
+	if e.EntityID == 0 {
+		e.EntityID = NewEntityID()
+	}
+	if e.UUID == uuid.Nil {
+		e.UUID = uuid.New()
+	}
+	e.pos0, e.rot0 = e.Position, e.Rotation
+	w.tickLock.Lock()
+	defer w.tickLock.Unlock()
+	w.entities[e.EntityID] = e
+}
+
+// RemoveEntity despawns the entity, and reports whether it's in the world.
+func (w *World) RemoveEntity(id int32) bool {
+	w.tickLock.Lock()
+	defer w.tickLock.Unlock()
+	e, ok := w.entities[id]
+	if !ok {
+		return false
+	}
+	delete(w.entities, id)
+	w.playerViews.Find(
+		bvh.TouchPoint[vec3d, aabb3d](vec3d(e.Position)),
+		func(n *playerViewNode) bool {
+			if _, ok := n.Value.EntitiesInView[id]; ok {
+				n.Value.ViewRemoveEntities([]int32{id})
+				delete(n.Value.EntitiesInView, id)
+			}
+			return true
+		},
+	)
+	return true
+}
+
+// UpdateEntity calls the function with the entity in the tick goroutine, so it's safe to modify the entity.
+// The entity should be moved by GenericEntity.Move, so the movement is sent to the players in the next tick.
+// It reports whether the entity is in the world.
+func (w *World) UpdateEntity(id int32, f func(e *GenericEntity)) bool {
+	w.tickLock.Lock()
+	defer w.tickLock.Unlock()
+	e, ok := w.entities[id]
+	if ok {
+		f(e)
+	}
+	return ok
+}
+
+// Animate plays the animation of the entity to the players who can see it, one of the Animation* values.
+// Like SetBlock, it locks the World, so it must not be called in the tick goroutine.
+func (w *World) Animate(e *Entity, animation byte) {
+	w.tickLock.Lock()
+	defer w.tickLock.Unlock()
+	w.forEachViewer(e, func(v EntityViewer) { v.ViewAnimate(e.EntityID, animation) })
+}
+
+// HurtAnimation tilts the camera or the model of the entity, as it's damaged from the direction of yaw.
+// Like SetBlock, it locks the World, so it must not be called in the tick goroutine.
+func (w *World) HurtAnimation(e *Entity, yaw float32) {
+	w.tickLock.Lock()
+	defer w.tickLock.Unlock()
+	w.forEachViewer(e, func(v EntityViewer) { v.ViewHurtAnimation(e.EntityID, yaw) })
+}
+
+// forEachViewer calls f with the players who have the entity in their EntitiesInView.
+func (w *World) forEachViewer(e *Entity, f func(v EntityViewer)) {
+	w.playerViews.Find(
+		bvh.TouchPoint[vec3d, aabb3d](vec3d(e.Position)),
+		func(n *playerViewNode) bool {
+			if _, ok := n.Value.EntitiesInView[e.EntityID]; ok {
+				f(n.Value.EntityViewer)
+			}
+			return true
+		},
+	)
+}
+
+// NearbyPlayers returns the clients of the players within the radius of the player in the world, including the player itself.
+// Nothing is returned if the player isn't in the world.
+func (w *World) NearbyPlayers(p *Player, radius float64) []Client {
+	w.tickLock.Lock()
+	defer w.tickLock.Unlock()
+	if p.view == nil || w.players[p.view.Value.EntityViewer.(Client)] != p {
+		return nil
+	}
+	center := vec3d(p.Position)
+	r := vec3d{radius, radius, radius}
+	var clients []Client
+	// the view box of a player always contains the position of it, so the boxes touching the range are the candidates.
+	w.playerViews.Find(
+		bvh.TouchBound(aabb3d{Upper: center.Add(r), Lower: center.Sub(r)}),
+		func(n *playerViewNode) bool {
+			if vec3d(n.Value.Position).Sub(center).Norm() <= radius {
+				clients = append(clients, n.Value.EntityViewer.(Client))
+			}
+			return true
+		},
+	)
+	return clients
+}
+
+// PlayerPosition returns the position and the rotation of the player, which are changed by the tick.
+func (w *World) PlayerPosition(p *Player) (Position, Rotation) {
+	w.tickLock.Lock()
+	defer w.tickLock.Unlock()
+	return p.Position, p.Rotation
+}
+
+// TeleportPlayer moves the player to the position.
+// Movements from the client are ignored until it confirms the teleport.
+func (w *World) TeleportPlayer(c Client, p *Player, pos Position, rot Rotation) {
+	w.tickLock.Lock()
+	defer w.tickLock.Unlock()
+	p.teleport = &TeleportRequest{
+		ID:       c.SendPlayerPosition(pos, rot),
+		Position: pos,
+		Rotation: rot,
+	}
+}
+
+// Close stops ticking the world and saves all loaded chunks.
+// The world must not be used after Close.
+func (w *World) Close() error {
+	close(w.stop)
+	<-w.stopped
+	return w.SaveChunks()
+}
+
+// SaveChunks writes all modified chunks back to the provider, without unloading them.
+func (w *World) SaveChunks() error {
+	w.tickLock.Lock()
+	defer w.tickLock.Unlock()
+	var errRet error
+	for pos, c := range w.chunks {
+		if err := w.saveChunk(pos, c); err != nil {
+			w.log.Error("Store chunk data error", zap.Int32("x", pos[0]), zap.Int32("z", pos[1]), zap.Error(err))
+			if errRet == nil {
+				errRet = err
+			}
+		}
+	}
+	return errRet
+}
+
+// SavePlayers writes the data of all players in the world to the provider.
+// The data is copied in the tick goroutine, and written after that, so the ticks are not blocked by the disk.
+// A player leaving in between is saved by PutPlayer with a newer version, so the copy doesn't overwrite it.
+func (w *World) SavePlayers(provider *PlayerProvider) error {
+	w.tickLock.Lock()
+	version := provider.saves.nextVersion()
+	data := make(map[uuid.UUID]*playerData, len(w.players))
+	for _, p := range w.players {
+		data[p.UUID] = newPlayerData(p, w.config.Name)
+	}
+	w.tickLock.Unlock()
+
+	var errRet error
+	for id, v := range data {
+		if err := provider.putPlayerData(id, v, version); err != nil {
+			w.log.Error("Save player data error", zap.String("uuid", id.String()), zap.Error(err))
+			if errRet == nil {
+				errRet = err
+			}
+		}
+	}
+	return errRet
 }
 
 func (w *World) loadChunk(pos [2]int32) bool {
 	logger := w.log.With(zap.Int32("x", pos[0]), zap.Int32("z", pos[1]))
 	logger.Debug("Loading chunk")
-	c, err := w.chunkProvider.GetChunk(pos)
+	c, extra, err := w.chunkProvider.GetChunk(pos)
+	var dirty bool
 	if err != nil {
 		if errors.Is(err, errChunkNotExist) {
 			logger.Debug("Generate chunk")
-			// TODO: because there is no chunk generator，generate an empty chunk and mark it as generated
-			c = level.EmptyChunk(24)
-			stone := block.ToStateID[block.Stone{}]
-			for s := range c.Sections {
-				for i := 0; i < 16*16*16; i++ {
-					c.Sections[s].SetBlock(i, stone)
-				}
+			c, err = w.config.Generator.Generate(pos)
+			if err != nil {
+				logger.Error("Generate chunk error", zap.Error(err))
+				return false
 			}
-			c.Status = level.StatusFull
-		} else if !errors.Is(err, ErrReachRateLimit) {
+			// the generated chunk exists only in memory, make sure it will be saved.
+			dirty = true
+		} else if errors.Is(err, ErrReachRateLimit) {
+			return false
+		} else {
 			logger.Error("GetChunk error", zap.Error(err))
 			return false
 		}
 	}
-	w.chunks[pos] = &LoadedChunk{Chunk: c}
+	w.chunks[pos] = &LoadedChunk{Chunk: c, extra: extra, dirty: dirty}
 	return true
 }
 
@@ -158,19 +369,41 @@ func (w *World) unloadChunk(pos [2]int32) {
 		viewer.ViewChunkUnload(pos)
 	}
 	// move the chunk to provider and save
-	err := w.chunkProvider.PutChunk(pos, c.Chunk)
-	if err != nil {
+	if err := w.saveChunk(pos, c); err != nil {
+		// keep the chunk in memory, so we can retry next time instead of losing the changes.
 		logger.Error("Store chunk data error", zap.Error(err))
+		return
 	}
 	delete(w.chunks, pos)
 }
 
+// saveChunk writes the chunk back to the provider if it has been modified since it was loaded.
+func (w *World) saveChunk(pos [2]int32, c *LoadedChunk) error {
+	c.Lock()
+	defer c.Unlock()
+	if !c.dirty {
+		return nil
+	}
+	if err := w.chunkProvider.PutChunk(pos, c.Chunk, c.extra); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
+
 type LoadedChunk struct {
 	sync.Mutex
 	viewers []ChunkViewer
+	// dirty is set when the chunk is modified, only dirty chunks are written back to the provider.
+	dirty bool
+	// extra is saved with the chunk unchanged.
+	extra ChunkExtra
 	*level.Chunk
 }
 
+// MarkDirty marks the chunk as modified. The caller must hold the lock of the chunk.
+func (lc *LoadedChunk) MarkDirty() { lc.dirty = true }
+
 func (lc *LoadedChunk) AddViewer(v ChunkViewer) {
 	lc.Lock()
 	defer lc.Unlock()
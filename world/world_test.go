@@ -0,0 +1,165 @@
+// This file is part of go-mc/server project.
+// Copyright (C) 2023.  Tnze
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package world
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+
+	"github.com/Tnze/go-mc/level/block"
+	"github.com/Tnze/go-mc/nbt"
+)
+
+// newTestWorld creates an overworld without starting the tick loop, the chunks are generated by a flat generator.
+// The chunks are loaded and unloaded by calling the methods directly.
+func newTestWorld(t *testing.T, provider ChunkProvider) *World {
+	layers, err := ParseFlatLayers(DefaultFlatLayers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &World{
+		log:           zap.NewNop(),
+		config:        Config{Generator: &FlatGenerator{Sections: 24, Layers: layers}},
+		minY:          -64,
+		chunks:        make(map[[2]int32]*LoadedChunk),
+		loaders:       make(map[ChunkViewer]*loader),
+		players:       make(map[Client]*Player),
+		entities:      make(map[int32]*GenericEntity),
+		chunkProvider: provider,
+		tickStats:     newTickStats(),
+	}
+}
+
+func newTestProvider(t *testing.T) ChunkProvider {
+	return NewProvider(t.TempDir(), -4, rate.NewLimiter(rate.Inf, 1))
+}
+
+// rawTag encodes the value as an NBT tag.
+func rawTag(t *testing.T, v any) nbt.RawMessage {
+	data, err := nbt.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tag nbt.RawMessage
+	if err := nbt.Unmarshal(data, &tag); err != nil {
+		t.Fatal(err)
+	}
+	return tag
+}
+
+func TestChunkProvider_extra(t *testing.T) {
+	type scheduledTick struct {
+		I          string `nbt:"i"`
+		X, Y, Z, T int32  `nbt:"x,y,z,t"`
+	}
+	extra := ChunkExtra{
+		BlockTicks: rawTag(t, []scheduledTick{{I: "minecraft:repeater", X: 1, Y: 2, Z: 3, T: 4}}),
+		Structures: rawTag(t, map[string]any{"References": map[string]any{}, "starts": map[string]any{"village": "x"}}),
+	}
+	p := newTestProvider(t)
+	w := newTestWorld(t, p)
+	c, err := w.config.Generator.Generate([2]int32{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.PutChunk([2]int32{1, 2}, c, extra); err != nil {
+		t.Fatal(err)
+	}
+	c2, got, err := p.GetChunk([2]int32{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c2.Sections[0].GetBlock(0) != c.Sections[0].GetBlock(0) {
+		t.Errorf("got block %d, want %d", c2.Sections[0].GetBlock(0), c.Sections[0].GetBlock(0))
+	}
+	for _, v := range []struct {
+		name      string
+		got, want nbt.RawMessage
+	}{
+		{"BlockTicks", got.BlockTicks, extra.BlockTicks},
+		{"Structures", got.Structures, extra.Structures},
+		{"FluidTicks", got.FluidTicks, emptyList},
+		{"PostProcessing", got.PostProcessing, emptyList},
+	} {
+		if v.got.Type != v.want.Type || !bytes.Equal(v.got.Data, v.want.Data) {
+			t.Errorf("%s: got %v, want %v", v.name, v.got, v.want)
+		}
+	}
+}
+
+func TestWorld_unloadChunk(t *testing.T) {
+	p := newTestProvider(t)
+	w := newTestWorld(t, p)
+	stone := block.ToStateID[block.Stone{}]
+	pos := [2]int32{-3, 7}
+	if _, _, err := p.GetChunk(pos); err != errChunkNotExist {
+		t.Fatalf("got error %v before generating the chunk", err)
+	}
+	if !w.loadChunk(pos) {
+		t.Fatal("the chunk isn't loaded")
+	}
+	if !w.SetBlock([3]int32{-48, 100, 112}, stone) {
+		t.Fatal("the block isn't set")
+	}
+	w.unloadChunk(pos)
+	if _, ok := w.chunks[pos]; ok {
+		t.Fatal("the chunk is still loaded")
+	}
+	c, _, err := p.GetChunk(pos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec, i, _ := w.blockIndex(c, [3]int32{-48, 100, 112})
+	if got := sec.GetBlock(i); got != stone {
+		t.Errorf("got block %d in the saved chunk, want stone", got)
+	}
+
+	// loaded again from the region file
+	if !w.loadChunk(pos) {
+		t.Fatal("the chunk isn't loaded again")
+	}
+	if got, _ := w.GetBlock([3]int32{-48, 100, 112}); got != stone {
+		t.Errorf("got block %d in the loaded chunk, want stone", got)
+	}
+	if w.chunks[pos].dirty {
+		t.Error("the chunk loaded from the region file is dirty")
+	}
+}
+
+func TestWorld_unloadChunkError(t *testing.T) {
+	// the region files can't be created in a file
+	dir := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(dir, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w := newTestWorld(t, NewProvider(dir, -4, rate.NewLimiter(rate.Inf, 1)))
+	pos := [2]int32{0, 0}
+	c, err := w.config.Generator.Generate(pos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.chunks[pos] = &LoadedChunk{Chunk: c, dirty: true}
+	w.unloadChunk(pos)
+	if lc, ok := w.chunks[pos]; !ok || !lc.dirty {
+		t.Error("the chunk failed to save is unloaded")
+	}
+}